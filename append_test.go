@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.log")
+	for _, input := range []string{"a\"b", "c\\d"} {
+		var stdout, stderr bytes.Buffer
+		if exitCode := run([]string{"-l", "--append", "-o", out}, strings.NewReader(input), &stdout, &stderr); exitCode != 0 {
+			t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+		}
+	}
+	if got, _ := os.ReadFile(out); string(got) != "a\\\"b\nc\\\\d\n" {
+		t.Errorf("output = %q", got)
+	}
+
+	// The byte order mark only starts the file
+	bom := filepath.Join(t.TempDir(), "bom.log")
+	for _, input := range []string{"one", "two"} {
+		var stdout, stderr bytes.Buffer
+		if exitCode := run([]string{"--append", "--output-encoding", "utf-8-bom", "-o", bom}, strings.NewReader(input), &stdout, &stderr); exitCode != 0 {
+			t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+		}
+	}
+	if got, _ := os.ReadFile(bom); string(got) != "\xef\xbb\xbfone\ntwo\n" {
+		t.Errorf("output = %q", got)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// atomicFile is the --output file under --atomic. It is written under a
+// temporary name in the same directory and only renamed over the real one
+// by commit, so a failed run leaves any earlier output where it was.
+type atomicFile struct {
+	*os.File
+	path      string
+	committed bool
+}
+
+// createAtomic creates the temporary file for path. Like os.Create, it
+// keeps the mode of a file already at path and otherwise applies the umask.
+func createAtomic(path string) (*atomicFile, error) {
+	perm := os.FileMode(0o666)
+	info, statErr := os.Stat(path)
+	if statErr == nil {
+		perm = info.Mode().Perm()
+	}
+	dir, base := filepath.Split(path)
+	for try := 0; ; try++ {
+		tmp := filepath.Join(dir, fmt.Sprintf(".%s.%08x.tmp", base, rand.Uint32()))
+		f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if errors.Is(err, os.ErrExist) && try < 100 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Keep the mode even where the umask would have narrowed it
+		if statErr == nil {
+			if err := f.Chmod(perm); err != nil {
+				f.Close()
+				os.Remove(tmp)
+				return nil, err
+			}
+		}
+		return &atomicFile{File: f, path: path}, nil
+	}
+}
+
+// commit closes the temporary file and renames it over the output file
+func (a *atomicFile) commit() error {
+	err := a.File.Close()
+	if err == nil {
+		err = os.Rename(a.Name(), a.path)
+	}
+	if err != nil {
+		os.Remove(a.Name())
+		return err
+	}
+	a.committed = true
+	return nil
+}
+
+// discard removes the temporary file unless it was committed
+func (a *atomicFile) discard() {
+	if !a.committed {
+		a.File.Close()
+		os.Remove(a.Name())
+	}
+}
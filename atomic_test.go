@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAtomicOutput(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.txt")
+	os.WriteFile(out, []byte("old\n"), 0o640)
+
+	var stdout, stderr bytes.Buffer
+	if exitCode := run([]string{"-l", "--atomic", "-o", out}, strings.NewReader("a\"b\nc\n"), &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	if got, _ := os.ReadFile(out); string(got) != "a\\\"b\nc\n" {
+		t.Errorf("output = %q", got)
+	}
+	if info, err := os.Stat(out); err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %v, want it kept at 0640", info.Mode())
+	}
+
+	// A failed run leaves the earlier output as it was
+	if exitCode := run([]string{"-u", "-l", "--atomic", "-o", out}, strings.NewReader("fine\nbad \\q\n"), &stdout, &stderr); exitCode != 1 {
+		t.Errorf("exit code = %d, want 1", exitCode)
+	}
+	if got, _ := os.ReadFile(out); string(got) != "a\\\"b\nc\n" {
+		t.Errorf("output = %q after a failed run, want it unchanged", got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files in the directory, want no temporary file left", len(entries))
+	}
+}
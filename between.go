@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// betweenMarkers delimit the regions --between transforms. Literal markers
+// are compiled as quoted patterns so both kinds are searched the same way.
+type betweenMarkers struct {
+	start *regexp.Regexp
+	end   *regexp.Regexp
+}
+
+// regionFlag names the option that limits transformation to parts of the
+// input, if one is set
+func regionFlag(config *Config) string {
+	switch {
+	case config.Between != nil:
+		return "--between"
+	case config.Subst != nil:
+		return "--subst"
+	}
+	return ""
+}
+
+// parseBetween compiles the START and END markers of --between, or of
+// --between-regex when regex is set
+func parseBetween(start, end string, regex bool) (*betweenMarkers, error) {
+	flag := "--between"
+	if regex {
+		flag = "--between-regex"
+	}
+	var m betweenMarkers
+	for _, marker := range []struct {
+		text string
+		re   **regexp.Regexp
+	}{{start, &m.start}, {end, &m.end}} {
+		pattern := marker.text
+		if !regex {
+			pattern = regexp.QuoteMeta(pattern)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s marker %q: %v", flag, marker.text, err)
+		}
+		// A marker that can match nothing would never move past itself
+		if re.MatchString("") {
+			return nil, fmt.Errorf("%s marker %q matches empty text", flag, marker.text)
+		}
+		*marker.re = re
+	}
+	return &m, nil
+}
+
+// processBetween transforms the text between each START and the next END
+// marker in r, passing the markers and everything outside them through
+// unchanged. Each region is a record. Nothing is written unless every
+// region transforms cleanly, so a failed input leaves no half-done copy.
+func (p *Processor) processBetween(r io.Reader, source string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return msgf("reading input: %w", err)
+	}
+	text := string(data)
+	m := p.Config.Between
+
+	var out strings.Builder
+	pos := 0
+	for {
+		loc := m.start.FindStringIndex(text[pos:])
+		if loc == nil {
+			break
+		}
+		open := pos + loc[1]
+		rec := Record{
+			Source: source,
+			Line:   1 + strings.Count(text[:open], "\n"),
+			Offset: int64(open),
+		}
+		endLoc := m.end.FindStringIndex(text[open:])
+		if endLoc == nil {
+			return &locationError{rec.location(), errors.New("start marker without an end marker after it")}
+		}
+		close := open + endLoc[0]
+
+		result, err := p.transformRegion(text[open:close], rec)
+		if err != nil {
+			return err
+		}
+		out.WriteString(text[pos:open])
+		out.WriteString(result)
+		out.WriteString(text[close : open+endLoc[1]])
+		pos = open + endLoc[1]
+	}
+	out.WriteString(text[pos:])
+
+	if _, err := io.WriteString(p.Output, out.String()); err != nil {
+		return &writeError{err}
+	}
+	return nil
+}
+
+// transformRegion escapes or unescapes one region found by --between,
+// accounting for it as a record
+func (p *Processor) transformRegion(s string, rec Record) (string, error) {
+	start := time.Now()
+	rec.Index = p.count
+	p.record = rec
+	result, err := p.transform(s)
+	p.noteStats(s, result, err != nil)
+	if err != nil {
+		p.traceRecord(rec, "", start, err)
+		return "", &locationError{rec.location(), err}
+	}
+
+	p.count++
+	p.record.Changed = result != s
+	p.noteRecord(p.record.Changed, false)
+	action := traceEscaped
+	if p.Config.Unescape {
+		action = traceUnescaped
+	}
+	p.traceRecord(p.record, action, start, nil)
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+		exitCode int
+	}{
+		{
+			"escapes each region",
+			[]string{"--between", "<<", ">>"},
+			"a \"x\" <<say \"hi\"\n>> b <<\t>>\n",
+			"a \"x\" <<say \\\"hi\\\"\\n>> b <<\\t>>\n",
+			0,
+		},
+		{
+			"markers are literal",
+			[]string{"--between", "[*", "*]"},
+			"[*a\tb*] [*\"*]",
+			"[*a\\tb*] [*\\\"*]",
+			0,
+		},
+		{
+			"unescape with regex markers",
+			[]string{"-u", "--between-regex", `BEGIN\n`, `\nEND`},
+			"keep \\n\nBEGIN\nline\\none\nEND\n",
+			"keep \\n\nBEGIN\nline\none\nEND\n",
+			0,
+		},
+		{"no markers", []string{"--between", "<<", ">>"}, "untouched \"text\"\n", "untouched \"text\"\n", 0},
+		{"unterminated region", []string{"--between", "<<", ">>"}, "<<ok>> <<open", "", 1},
+		{"invalid region", []string{"-u", "--between", "<<", ">>"}, "<<bad \\q>>", "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append(tt.args, "--stdin")
+			exitCode := run(args, strings.NewReader(tt.input), &stdout, &stderr)
+			if exitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", exitCode, tt.exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestBetweenLocation(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	input := "line one\n<<ok>>\nline three <<bad \\q>>\n"
+	run([]string{"-u", "--between", "<<", ">>", "--stdin"}, strings.NewReader(input), &stdout, &stderr)
+	if !strings.Contains(stderr.String(), "-:3: unescaping") {
+		t.Errorf("stderr = %q, want the region's line", stderr.String())
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import "container/list"
+
+// Default number of records --cache remembers
+const defaultCacheSize = 4096
+
+// Records longer than this are never cached: repeats are rare among them,
+// and leaving them out bounds the memory a cache of a given size takes
+const cacheMaxRecord = 4 * 1024
+
+// escapeCache remembers the results of recent transformations for --cache,
+// evicting the least recently used once it holds size of them
+type escapeCache struct {
+	size    int
+	entries map[string]*list.Element
+	order   *list.List // of *cacheEntry, most recently used first
+}
+
+type cacheEntry struct {
+	in, out string
+}
+
+func newEscapeCache(size int) *escapeCache {
+	return &escapeCache{
+		size:    size,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// get returns the cached result for in, if there is one
+func (c *escapeCache) get(in string) (string, bool) {
+	e, ok := c.entries[in]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheEntry).out, true
+}
+
+// put caches out as the result for in
+func (c *escapeCache) put(in, out string) {
+	if len(in) > cacheMaxRecord {
+		return
+	}
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		delete(c.entries, oldest.Value.(*cacheEntry).in)
+		c.order.Remove(oldest)
+	}
+	c.entries[in] = c.order.PushFront(&cacheEntry{in, out})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEscapeCacheEviction(t *testing.T) {
+	c := newEscapeCache(2)
+	c.put("a", "A")
+	c.put("b", "B")
+	c.get("a") // b is now the least recently used
+	c.put("c", "C")
+
+	for in, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := c.get(in); ok != want {
+			t.Errorf("get(%q) found = %v, want %v", in, ok, want)
+		}
+	}
+
+	c.put(strings.Repeat("x", cacheMaxRecord+1), "long")
+	if _, ok := c.get(strings.Repeat("x", cacheMaxRecord+1)); ok {
+		t.Error("a record over cacheMaxRecord was cached")
+	}
+}
+
+func TestCacheMatchesUncached(t *testing.T) {
+	input := strings.Repeat("dup \"line\"\n\tother\nbad \\q\ncafé\n", 20)
+	for _, flags := range [][]string{{"-l"}, {"-l", "--ascii"}, {"-l", "-u", "--keep-going"}} {
+		var want, got, stderr bytes.Buffer
+		wantCode := run(append(flags, "--stdin"), strings.NewReader(input), &want, &stderr)
+		gotCode := run(append(flags, "--stdin", "--cache=2"), strings.NewReader(input), &got, &stderr)
+		if gotCode != wantCode || got.String() != want.String() {
+			t.Errorf("%v with --cache = %d, %.60q, want %d, %.60q", flags, gotCode, got.String(), wantCode, want.String())
+		}
+	}
+}
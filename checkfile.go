@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/user/jsonescape/pkg/jsonescape"
+)
+
+// Nagios plugin states, which check-file --format nagios uses as its exit
+// codes
+const (
+	nagiosOK       = 0
+	nagiosWarning  = 1
+	nagiosCritical = 2
+	nagiosUnknown  = 3
+)
+
+var nagiosStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// nagiosRank orders the states by how bad they are: a file that could not
+// be read is only worse than one that is OK
+var nagiosRank = []int{nagiosOK: 0, nagiosUnknown: 1, nagiosWarning: 2, nagiosCritical: 3}
+
+// checkOptions holds the arguments of the check-file subcommand
+type checkOptions struct {
+	Format   string // text or nagios
+	NDJSON   bool   // lines are JSON documents rather than escaped strings
+	Warning  int    // invalid records that make a file WARNING
+	Critical int    // and CRITICAL (at least Warning)
+	Files    []string
+}
+
+// fileCheck is the result of checking one file
+type fileCheck struct {
+	path    string
+	records int
+	invalid int
+	first   string // the first problem, with its line
+	err     error  // the file could not be read
+}
+
+func (c *fileCheck) state(opts *checkOptions) int {
+	switch {
+	case c.err != nil:
+		return nagiosUnknown
+	case c.invalid >= opts.Critical:
+		return nagiosCritical
+	case c.invalid >= opts.Warning:
+		return nagiosWarning
+	}
+	return nagiosOK
+}
+
+// checkFile implements the check-file subcommand, which validates that each
+// line of the files is a properly escaped JSON string body (or, with
+// --ndjson, a JSON document) and reports the results for monitoring
+func checkFile(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, err := parseCheckArgs(args)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		fmt.Fprintf(stderr, "Usage: %s check-file [--format text|nagios] [--ndjson] [--warning N] [--critical N] FILE...\n", name)
+		return exitUsageError
+	}
+
+	checks := make([]*fileCheck, len(opts.Files))
+	worst := nagiosOK
+	for i, path := range opts.Files {
+		checks[i] = checkLines(path, opts.NDJSON)
+		if state := checks[i].state(opts); nagiosRank[state] > nagiosRank[worst] {
+			worst = state
+		}
+	}
+
+	if opts.Format == "nagios" {
+		writeNagios(stdout, checks, worst, opts)
+		return worst
+	}
+	for _, c := range checks {
+		if c.err != nil {
+			fmt.Fprintf(stdout, "%s: %s: %v\n", c.path, nagiosStates[nagiosUnknown], c.err)
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: %s: %d records, %d invalid\n", c.path, nagiosStates[c.state(opts)], c.records, c.invalid)
+		if c.first != "" {
+			fmt.Fprintf(stdout, "  first: %s\n", c.first)
+		}
+	}
+	if worst != nagiosOK {
+		return exitError
+	}
+	return exitSuccess
+}
+
+// writeNagios prints a plugin status line with performance data, followed
+// by one line per file as long output
+func writeNagios(w io.Writer, checks []*fileCheck, worst int, opts *checkOptions) {
+	records, invalid := 0, 0
+	for _, c := range checks {
+		records += c.records
+		invalid += c.invalid
+	}
+	fmt.Fprintf(w, "JSONESCAPE %s - %d files, %d records, %d invalid | records=%d invalid=%d;%d;%d;0\n",
+		nagiosStates[worst], len(checks), records, invalid, records, invalid, opts.Warning, opts.Critical)
+	for _, c := range checks {
+		line := fmt.Sprintf("%s %s: %d records, %d invalid", nagiosStates[c.state(opts)], c.path, c.records, c.invalid)
+		if c.err != nil {
+			line = fmt.Sprintf("%s %s: %v", nagiosStates[nagiosUnknown], c.path, c.err)
+		} else if c.first != "" {
+			line += " (first: " + c.first + ")"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// checkLines checks each non-blank line of a file
+func checkLines(path string, ndjson bool) *fileCheck {
+	c := &fileCheck{path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		c.err = err
+		return c
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		text, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			c.err = err
+			return c
+		}
+		text = strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+		if strings.TrimSpace(text) != "" {
+			c.records++
+			var problem error
+			if ndjson {
+				if !json.Valid([]byte(text)) {
+					problem = errors.New("not a valid JSON document")
+				}
+			} else {
+				problem = checkEscaped(text)
+			}
+			if problem != nil {
+				c.invalid++
+				if c.first == "" {
+					c.first = fmt.Sprintf("line %d: %v", line, problem)
+				}
+			}
+		}
+		if err == io.EOF {
+			return c
+		}
+	}
+}
+
+// checkEscaped reports why s could not be put between double quotes as a
+// JSON string, or nil if it can
+func checkEscaped(s string) error {
+	if !utf8.ValidString(s) {
+		return errors.New("invalid UTF-8")
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++ // jsonescape.Unescape checks the escape itself
+		case c == '"':
+			return fmt.Errorf("unescaped quote at byte %d", i+1)
+		case c < 0x20:
+			return fmt.Errorf("raw control character U+%04X at byte %d", c, i+1)
+		}
+	}
+	_, err := jsonescape.Unescape(s)
+	return err
+}
+
+func parseCheckArgs(args []string) (*checkOptions, error) {
+	opts := &checkOptions{Format: "text", Warning: 1, Critical: 1}
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			opts.Files = append(opts.Files, args[i])
+			continue
+		}
+		name, value, hasValue := strings.Cut(args[i][2:], "=")
+		if name == "ndjson" {
+			opts.NDJSON = true
+			continue
+		}
+		if !hasValue {
+			i++
+			if i >= len(args) {
+				return nil, fmt.Errorf("--%s requires a value", name)
+			}
+			value = args[i]
+		}
+
+		switch name {
+		case "format":
+			if value != "text" && value != "nagios" {
+				return nil, fmt.Errorf("invalid --format value %q (expected text, nagios)", value)
+			}
+			opts.Format = value
+		case "warning", "critical":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid --%s value %q (expected a positive number)", name, value)
+			}
+			if name == "warning" {
+				opts.Warning = n
+			} else {
+				opts.Critical = n
+			}
+		default:
+			return nil, fmt.Errorf("unknown option: --%s", name)
+		}
+	}
+
+	if len(opts.Files) == 0 {
+		return nil, errors.New("no files to check")
+	}
+	if opts.Critical < opts.Warning {
+		opts.Critical = opts.Warning
+	}
+	return opts, nil
+}
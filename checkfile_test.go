@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckEscaped(t *testing.T) {
+	for s, want := range map[string]string{
+		`plain`:        "",
+		`say \"hi\"\n`: "",
+		`a\\`:          "",
+		`say "hi"`:     "unescaped quote at byte 5",
+		"tab\there":    "raw control character U+0009 at byte 4",
+		`bad \x`:       "invalid escape sequence \\x",
+		"bad \xff":     "invalid UTF-8",
+		`trailing \`:   "incomplete escape sequence at end of string",
+		`😀 \u00`:       "incomplete unicode escape sequence",
+	} {
+		got := ""
+		if err := checkEscaped(s); err != nil {
+			got = err.Error()
+		}
+		if got != want {
+			t.Errorf("checkEscaped(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestCheckFileNagios(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.txt")
+	bad := filepath.Join(dir, "bad.ndjson")
+	os.WriteFile(good, []byte("fine\\n\nalso fine\n"), 0o644)
+	os.WriteFile(bad, []byte("{\"a\":1}\n{broken\n\n{\"b\":2}\n[1,\n"), 0o644)
+
+	tests := []struct {
+		args     []string
+		exitCode int
+		lines    []string
+	}{
+		{
+			[]string{"--format", "nagios", good},
+			nagiosOK,
+			[]string{"JSONESCAPE OK - 1 files, 2 records, 0 invalid | records=2 invalid=0;1;1;0", "OK " + good + ": 2 records, 0 invalid"},
+		},
+		{
+			[]string{"--format=nagios", "--ndjson", "--warning=1", "--critical=5", bad, filepath.Join(dir, "missing")},
+			nagiosWarning,
+			[]string{
+				"JSONESCAPE WARNING - 2 files, 4 records, 2 invalid | records=4 invalid=2;1;5;0",
+				"WARNING " + bad + ": 4 records, 2 invalid (first: line 2: not a valid JSON document)",
+				"UNKNOWN " + filepath.Join(dir, "missing") + ": open",
+			},
+		},
+		{
+			[]string{"--format=nagios", "--ndjson", bad},
+			nagiosCritical,
+			[]string{"JSONESCAPE CRITICAL - 1 files, 4 records, 2 invalid | records=4 invalid=2;1;1;0"},
+		},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		exitCode := run(append([]string{"check-file"}, tt.args...), strings.NewReader(""), &stdout, &stderr)
+		if exitCode != tt.exitCode {
+			t.Errorf("%v: exit code = %d, want %d (stderr: %s)", tt.args, exitCode, tt.exitCode, stderr.String())
+		}
+		lines := strings.Split(stdout.String(), "\n")
+		for i, want := range tt.lines {
+			if i >= len(lines) || !strings.HasPrefix(lines[i], want) {
+				t.Errorf("%v: output = %q, want line %d to start with %q", tt.args, stdout.String(), i+1, want)
+			}
+		}
+	}
+}
+
+func TestCheckFileErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"--format=xml", "f"},
+		{"--warning=0", "f"},
+		{"--bogus", "f"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if exitCode := run(append([]string{"check-file"}, args...), strings.NewReader(""), &stdout, &stderr); exitCode != exitUsageError {
+			t.Errorf("%v: exit code = %d, want %d", args, exitCode, exitUsageError)
+		}
+	}
+}
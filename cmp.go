@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/user/jsonescape/pkg/jsonescape"
+)
+
+// cmpUnit is one code point of an escaped string and the text it was
+// written as. Invalid UTF-8 bytes are kept as negative runes so they never
+// compare equal to a real code point.
+type cmpUnit struct {
+	r    rune
+	form string
+}
+
+// compareEscaped implements the cmp subcommand. Like cmp(1) it exits 0 when
+// both inputs hold the same string, 1 when they differ and 2 on trouble.
+func compareEscaped(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var inputs []string
+	files := false
+	for _, arg := range args {
+		switch {
+		case arg == "--files":
+			files = true
+		case strings.HasPrefix(arg, "--"):
+			fmt.Fprintf(stderr, "Error: unknown option: %s\n", arg)
+			fmt.Fprintf(stderr, "Usage: %s cmp [--files] A B\n", name)
+			return exitUsageError
+		default:
+			inputs = append(inputs, arg)
+		}
+	}
+	if len(inputs) != 2 {
+		fmt.Fprintf(stderr, "Error: expected two inputs to compare, got %d\n", len(inputs))
+		fmt.Fprintf(stderr, "Usage: %s cmp [--files] A B\n", name)
+		return exitUsageError
+	}
+
+	var units [2][]cmpUnit
+	for i, input := range inputs {
+		if files {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+				return exitUsageError
+			}
+			input = string(data)
+		}
+		body, _, _ := splitFixture(input)
+		u, err := decodeUnits(body)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s: %v\n", "AB"[i:i+1], err)
+			return exitUsageError
+		}
+		units[i] = u
+	}
+
+	a, b := units[0], units[1]
+	formDiff := -1
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].r != b[i].r {
+			fmt.Fprintf(stdout, "differ at code point %d: %s vs %s\n", i, describeUnit(a[i]), describeUnit(b[i]))
+			fmt.Fprintf(stdout, "A: %d code points, B: %d code points\n", len(a), len(b))
+			return exitError
+		}
+		if formDiff < 0 && a[i].form != b[i].form {
+			formDiff = i
+		}
+	}
+	if len(a) != len(b) {
+		shorter := "A"
+		if len(b) < len(a) {
+			shorter = "B"
+		}
+		fmt.Fprintf(stdout, "differ at code point %d: %s ends first\n", min(len(a), len(b)), shorter)
+		fmt.Fprintf(stdout, "A: %d code points, B: %d code points\n", len(a), len(b))
+		return exitError
+	}
+
+	if formDiff < 0 {
+		fmt.Fprintf(stdout, "identical: %d code points\n", len(a))
+	} else {
+		fmt.Fprintf(stdout, "same string (%d code points), escaped differently from code point %d: %s vs %s\n",
+			len(a), formDiff, a[formDiff].form, b[formDiff].form)
+	}
+	return exitSuccess
+}
+
+// decodeUnits decodes an escaped string one code point at a time. Unlike
+// jsonescape.Unescape it keeps lone surrogates and invalid bytes distinct
+// from U+FFFD, since telling such strings apart is the point of comparing
+// them.
+func decodeUnits(s string) ([]cmpUnit, error) {
+	// Check the escapes first so that every \u below has its four hex digits
+	if _, err := jsonescape.Unescape(s); err != nil {
+		return nil, err
+	}
+
+	var units []cmpUnit
+	for i := 0; i < len(s); {
+		if s[i] != '\\' {
+			r, n := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && n == 1 {
+				r = -rune(s[i]) - 1
+			}
+			units = append(units, cmpUnit{r, s[i : i+n]})
+			i += n
+			continue
+		}
+
+		if r, ok := shortEscapes[s[i+1]]; ok {
+			units = append(units, cmpUnit{r, s[i : i+2]})
+			i += 2
+			continue
+		}
+		r, _ := parseHexRune(s[i+2 : i+6])
+		n := 6
+		if r >= 0xD800 && r <= 0xDBFF && strings.HasPrefix(s[i+6:], `\u`) {
+			r2, _ := parseHexRune(s[i+8 : i+12])
+			if r2 >= 0xDC00 && r2 <= 0xDFFF {
+				r = 0x10000 + (r-0xD800)*0x400 + (r2 - 0xDC00)
+				n = 12
+			}
+		}
+		units = append(units, cmpUnit{r, s[i : i+n]})
+		i += n
+	}
+	return units, nil
+}
+
+// describeUnit names the code point of a unit and shows how it was written
+func describeUnit(u cmpUnit) string {
+	if u.r < 0 {
+		return fmt.Sprintf("invalid byte 0x%02X", -u.r-1)
+	}
+	if u.r >= 0xD800 && u.r <= 0xDFFF {
+		return fmt.Sprintf("lone surrogate U+%04X (%s)", u.r, u.form)
+	}
+	return fmt.Sprintf("U+%04X (%s)", u.r, u.form)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareEscaped(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		exitCode int
+		expected string
+	}{
+		{"identical", `a\nb`, `a\nb`, 0, "identical: 3 code points\n"},
+		{"escape form", `caf\u00e9`, "café", 0, "same string (4 code points), escaped differently from code point 3: \\u00e9 vs é\n"},
+		{"quoted", `"x\/"`, `x/`, 0, "same string (2 code points), escaped differently from code point 1: \\/ vs /\n"},
+		{"surrogate pair", `\ud83d\ude00`, "\U0001F600", 0, "same string (1 code points), escaped differently from code point 0: \\ud83d\\ude00 vs \U0001F600\n"},
+		{"content", `abc`, `abd`, 1, "differ at code point 2: U+0063 (c) vs U+0064 (d)\nA: 3 code points, B: 3 code points\n"},
+		{"length", `ab`, `abc`, 1, "differ at code point 2: A ends first\nA: 2 code points, B: 3 code points\n"},
+		{"lone surrogate", `\ud800`, "\uFFFD", 1, "differ at code point 0: lone surrogate U+D800 (\\ud800) vs U+FFFD (\uFFFD)\nA: 1 code points, B: 1 code points\n"},
+		{"invalid byte", "\xff", "\uFFFD", 1, "differ at code point 0: invalid byte 0xFF vs U+FFFD (\uFFFD)\nA: 1 code points, B: 1 code points\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			exitCode := run([]string{"cmp", tt.a, tt.b}, strings.NewReader(""), &stdout, &stderr)
+			if exitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", exitCode, tt.exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestCompareEscapedFiles(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")
+	os.WriteFile(a, []byte(`"A"`+"\n"), 0o644)
+	os.WriteFile(b, []byte("A"), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	if exitCode := run([]string{"cmp", "--files", a, b}, strings.NewReader(""), &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+
+	for _, args := range [][]string{{"cmp", "a"}, {"cmp", `a\q`, "b"}, {"cmp", "--files", a, filepath.Join(dir, "missing")}} {
+		stdout.Reset()
+		stderr.Reset()
+		if exitCode := run(args, strings.NewReader(""), &stdout, &stderr); exitCode != 2 {
+			t.Errorf("%q: exit code = %d, want 2", args, exitCode)
+		}
+	}
+}
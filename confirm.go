@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ANSI colors for the diffs --confirm shows on a terminal
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+// confirmer shows the changes -i is about to make and asks whether to make
+// them, for --confirm
+type confirmer struct {
+	answers *bufio.Reader // the user's replies
+	prompt  io.Writer     // where the diffs and questions go
+	color   bool          // color the diffs, for a terminal
+	all     bool          // --confirm=all: one question after every diff
+
+	pending []pendingRewrite // files waiting on that question
+}
+
+// pendingRewrite is a file --confirm=all has yet to rewrite
+type pendingRewrite struct {
+	path           string
+	original, data []byte
+}
+
+// confirmRewrite shows the diff between the original content of path and
+// data, and rewrites the file if the user agrees. Under --confirm=all the
+// file waits for finishConfirm instead. A file that would not change is
+// left alone without asking.
+func (p *Processor) confirmRewrite(path string, original, data []byte) error {
+	c := p.confirm
+	var diff bytes.Buffer
+	writeUnifiedDiff(&diff, path, string(original), string(data))
+	if diff.Len() == 0 {
+		return nil
+	}
+	if err := c.show(diff.String()); err != nil {
+		return &writeError{err}
+	}
+	if c.all {
+		c.pending = append(c.pending, pendingRewrite{path, original, data})
+		return nil
+	}
+	if !c.ask(p.msgs.sprintf("Rewrite %q? [y/N]", path)) {
+		return nil
+	}
+	return p.rewriteFile(path, original, data)
+}
+
+// finishConfirm asks once whether to rewrite every file --confirm=all has
+// shown a diff for, and rewrites them if so
+func (p *Processor) finishConfirm() error {
+	c := p.confirm
+	if c == nil || len(c.pending) == 0 {
+		return nil
+	}
+	pending := c.pending
+	c.pending = nil
+	if !c.ask(p.msgs.sprintf("Rewrite these %d files? [y/N]", len(pending))) {
+		return nil
+	}
+	for _, f := range pending {
+		if err := p.fail(p.rewriteFile(f.path, f.original, f.data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// show writes a unified diff, colored if the prompt is a terminal
+func (c *confirmer) show(diff string) error {
+	if !c.color {
+		_, err := io.WriteString(c.prompt, diff)
+		return err
+	}
+	var b strings.Builder
+	for _, line := range splitLines(diff) {
+		color := ""
+		switch {
+		case strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+			color = colorBold
+		case strings.HasPrefix(line, "@@"):
+			color = colorCyan
+		case strings.HasPrefix(line, "-"):
+			color = colorRed
+		case strings.HasPrefix(line, "+"):
+			color = colorGreen
+		}
+		if color == "" {
+			b.WriteString(line)
+			continue
+		}
+		text, eol := strings.CutSuffix(line, "\n")
+		b.WriteString(color + text + colorReset)
+		if eol {
+			b.WriteByte('\n')
+		}
+	}
+	_, err := io.WriteString(c.prompt, b.String())
+	return err
+}
+
+// ask puts a yes/no question and reports whether the answer was yes. No
+// answer at all, at the end of the input, is no.
+func (c *confirmer) ask(question string) bool {
+	fmt.Fprint(c.prompt, question+" ")
+	answer, err := c.answers.ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(c.prompt)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/user/jsonescape/pkg/jsonescape"
+)
+
+// corpusOptions holds the arguments of the gen-corpus subcommand
+type corpusOptions struct {
+	Out   string
+	Count int
+	Seed  int64
+}
+
+// corpusGenerators produce the kinds of string gen-corpus emits, cycled
+// through in order so every kind shows up in even a small corpus
+var corpusGenerators = []struct {
+	name string
+	gen  func(r *rand.Rand) string
+}{
+	{"astral", func(r *rand.Rand) string {
+		// Characters outside the BMP need surrogate pairs in \u form
+		return randomFrom(r, []string{"\U0001f44b", "\U0001d11e", "\U0001f1e9\U0001f1f0", "\U0001f469\u200d\U0001f469\u200d\U0001f467", "\U0002070e", "\U0010ffff"}, 1+r.Intn(6))
+	}},
+	{"lone-surrogate", func(r *rand.Rand) string {
+		// WTF-8 encoded surrogate halves, which are invalid UTF-8
+		return randomFrom(r, []string{"\xed\xa0\xbd", "\xed\xb1\x8b", "a", "\xed\xa0\x80\xed\xb0\x80"}, 1+r.Intn(5))
+	}},
+	{"overlong", func(r *rand.Rand) string {
+		return randomFrom(r, []string{"\xc0\xaf", "\xe0\x80\xaf", "\xf0\x80\x80\xaf", "\xc1\xbf", "/", "x"}, 1+r.Intn(5))
+	}},
+	{"invalid-utf8", func(r *rand.Rand) string {
+		return randomFrom(r, []string{"\xff", "\xfe", "\x80", "\xe6\x97", "\xf4\x90\x80\x80", "ok"}, 1+r.Intn(6))
+	}},
+	{"bidi", func(r *rand.Rand) string {
+		return randomFrom(r, []string{"\u202a", "\u202b", "\u202c", "\u202d", "\u202e", "\u2066", "\u2067", "\u2068", "\u2069", "\u200e", "\u200f", "abc", "\u05e9\u05dc\u05d5\u05dd"}, 2+r.Intn(8))
+	}},
+	{"controls", func(r *rand.Rand) string {
+		var b strings.Builder
+		for n := 1 + r.Intn(16); n > 0; n-- {
+			b.WriteByte(byte(r.Intn(0x20)))
+		}
+		return b.String()
+	}},
+	{"c1-and-del", func(r *rand.Rand) string {
+		return randomFrom(r, []string{"\x7f", "\u0080", "\u0085", "\u009f", "a"}, 1+r.Intn(6))
+	}},
+	{"separators", func(r *rand.Rand) string {
+		// Valid in JSON strings but not in JavaScript string literals
+		return randomFrom(r, []string{"\u2028", "\u2029", "\ufeff", "\u00a0", "\r\n", "\n"}, 1+r.Intn(6))
+	}},
+	{"noncharacters", func(r *rand.Rand) string {
+		return randomFrom(r, []string{"\ufffe", "\uffff", "\ufdd0", "\U0001fffe", "\ufffd"}, 1+r.Intn(4))
+	}},
+	{"combining", func(r *rand.Rand) string {
+		return "e" + strings.Repeat("\u0301", 1+r.Intn(40))
+	}},
+	{"escape-lookalikes", func(r *rand.Rand) string {
+		return randomFrom(r, []string{`\u0000`, `\ud83d`, `\"`, `\\`, `\`, `\x41`, `\U0001F600`, `"`}, 1+r.Intn(6))
+	}},
+	{"html", func(r *rand.Rand) string {
+		return randomFrom(r, []string{"<", ">", "&", "</script>", "<!--", "]]>", "'"}, 1+r.Intn(6))
+	}},
+	{"huge-run", func(r *rand.Rand) string {
+		unit := []string{`"`, `\`, "\x00", "\n", "é", "👋", "a"}[r.Intn(7)]
+		return strings.Repeat(unit, 1<<(10+r.Intn(7)))
+	}},
+	{"mixed", func(r *rand.Rand) string {
+		var b strings.Builder
+		for n := 1 + r.Intn(64); n > 0; n-- {
+			b.WriteRune(rune(r.Intn(0x110000)))
+		}
+		return b.String()
+	}},
+}
+
+// randomFrom concatenates n pieces picked at random from pieces
+func randomFrom(r *rand.Rand, pieces []string, n int) string {
+	var b strings.Builder
+	for ; n > 0; n-- {
+		b.WriteString(pieces[r.Intn(len(pieces))])
+	}
+	return b.String()
+}
+
+// genCorpus implements the gen-corpus subcommand. Each case is written as
+// NNNNN-kind.raw holding the string itself and NNNNN-kind.json holding it
+// escaped as a quoted JSON string; the same seed and count always give the
+// same files.
+func genCorpus(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, err := parseCorpusArgs(args)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		fmt.Fprintf(stderr, "Usage: %s gen-corpus --out <DIR> [--count N] [--seed N]\n", name)
+		return exitUsageError
+	}
+
+	if err := os.MkdirAll(opts.Out, 0o755); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	r := rand.New(rand.NewSource(opts.Seed))
+	for i := 0; i < opts.Count; i++ {
+		g := corpusGenerators[i%len(corpusGenerators)]
+		raw := g.gen(r)
+		base := filepath.Join(opts.Out, fmt.Sprintf("%05d-%s", i, g.name))
+
+		err := os.WriteFile(base+".raw", []byte(raw), 0o644)
+		if err == nil {
+			err = os.WriteFile(base+".json", []byte(`"`+jsonescape.Escape(raw, jsonescape.Options{})+`"`+"\n"), 0o644)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	fmt.Fprintf(stdout, "Wrote %d cases to %s\n", opts.Count, opts.Out)
+	return exitSuccess
+}
+
+func parseCorpusArgs(args []string) (*corpusOptions, error) {
+	opts := &corpusOptions{Count: 100, Seed: 1}
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(args[i], "--"), "=")
+		if !strings.HasPrefix(args[i], "--") {
+			return nil, fmt.Errorf("unexpected argument %q", args[i])
+		}
+		if !hasValue {
+			i++
+			if i >= len(args) {
+				return nil, fmt.Errorf("--%s requires a value", name)
+			}
+			value = args[i]
+		}
+
+		switch name {
+		case "out":
+			opts.Out = value
+		case "count":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid --count value %q (expected a positive number)", value)
+			}
+			opts.Count = n
+		case "seed":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --seed value %q", value)
+			}
+			opts.Seed = n
+		default:
+			return nil, fmt.Errorf("unknown option: --%s", name)
+		}
+	}
+
+	if opts.Out == "" {
+		return nil, errors.New("--out is required")
+	}
+	return opts, nil
+}
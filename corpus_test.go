@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestGenCorpus(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	for _, dir := range dirs {
+		var stdout, stderr bytes.Buffer
+		exitCode := run([]string{"gen-corpus", "--out", dir, "--count=30", "--seed=7"}, strings.NewReader(""), &stdout, &stderr)
+		if exitCode != 0 {
+			t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dirs[0], "*"))
+	if len(files) != 60 {
+		t.Fatalf("got %d files, want 60", len(files))
+	}
+	for _, path := range files {
+		data, _ := os.ReadFile(path)
+		again, _ := os.ReadFile(filepath.Join(dirs[1], filepath.Base(path)))
+		if !bytes.Equal(data, again) {
+			t.Errorf("%s differs between runs with the same seed", filepath.Base(path))
+		}
+
+		if !strings.HasSuffix(path, ".json") {
+			continue
+		}
+		var decoded string
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Errorf("%s is not a valid JSON string: %v", filepath.Base(path), err)
+			continue
+		}
+		raw, _ := os.ReadFile(strings.TrimSuffix(path, ".json") + ".raw")
+		if utf8.Valid(raw) && decoded != string(raw) {
+			t.Errorf("%s does not decode to its .raw file", filepath.Base(path))
+		}
+	}
+}
+
+func TestGenCorpusErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"gen-corpus"},
+		{"gen-corpus", "--out"},
+		{"gen-corpus", "--out", "x", "--count", "0"},
+		{"gen-corpus", "--out", "x", "--colour=red"},
+		{"gen-corpus", "stray"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if exitCode := run(args, strings.NewReader(""), &stdout, &stderr); exitCode != 2 {
+			t.Errorf("run(%q) exit code = %d, want 2", args, exitCode)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// daemonRequest is what a --use-daemon client sends: one invocation of the
+// CLI, run in the client's working directory and language
+type daemonRequest struct {
+	Args     []string
+	Dir      string
+	Lang     string // from the client's --lang or locale
+	Stdin    []byte
+	HasStdin bool // false when the client's stdin is a terminal
+}
+
+// daemonResponse carries back what the invocation wrote and its exit code
+type daemonResponse struct {
+	Stdout []byte
+	Stderr []byte
+	Exit   int
+}
+
+// noStdin stands in for a client's stdin that was a terminal, so run
+// behaves as it would have in the client
+type noStdin struct{}
+
+func (noStdin) Read([]byte) (int, error) { return 0, io.EOF }
+
+// How long the daemon waits on a client to send its request or take the
+// response, so one that stalls cannot hold up the others
+const daemonTimeout = 10 * time.Second
+
+// defaultSocket is where the daemon listens unless told otherwise: in the
+// user's runtime directory, or else in a directory of their own in the temp
+// directory, where nobody else can put a socket first
+func defaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, name+".sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", name, os.Getuid()), "daemon.sock")
+}
+
+// privateDir creates dir if need be, and checks that it belongs to the
+// user and nobody else can get into it
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() || info.Mode().Perm()&0o077 != 0 || !ownedByUser(dir) {
+		return fmt.Errorf("%s is not a directory only you can use", dir)
+	}
+	return nil
+}
+
+// daemon implements the daemon subcommand, serving --use-daemon clients on
+// a unix socket until interrupted
+func daemon(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	socket, backend := defaultSocket(), ""
+	for i := 0; i < len(args); i++ {
+		flag, value, hasValue := strings.Cut(args[i], "=")
+		if flag != "--socket" && flag != "--log-backend" {
+			fmt.Fprintf(stderr, "Error: unknown option: %s\n", args[i])
+			fmt.Fprintf(stderr, "Usage: %s daemon [--socket PATH] [--log-backend BACKEND]\n", name)
+			return exitUsageError
+		}
+		if !hasValue {
+			i++
+			if i >= len(args) {
+				fmt.Fprintf(stderr, "Error: %s requires a value\n", flag)
+				return exitUsageError
+			}
+			value = args[i]
+		}
+		if flag == "--socket" {
+			socket = value
+		} else if err := parseLogBackend(value); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return exitUsageError
+		} else {
+			backend = value
+		}
+	}
+
+	// The daemon's own messages can go to the system log
+	logw, err := openLogBackend(backend, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+	defer logw.Close()
+	stderr = logw
+
+	if socket == defaultSocket() {
+		if err := privateDir(filepath.Dir(socket)); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	// A socket nobody answers on is left over from a daemon that died
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		fmt.Fprintf(stderr, "Error: a daemon is already listening on %s\n", socket)
+		return exitError
+	}
+	os.Remove(socket)
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+	os.Chmod(socket, 0o600)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		l.Close()
+	}()
+
+	fmt.Fprintf(stderr, "Listening on %s\n", socket)
+	if err := serveDaemon(l); err != nil && !errors.Is(err, net.ErrClosed) {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return exitSuccess
+}
+
+// serveDaemon answers requests until l is closed. They are handled one at a
+// time, since each changes into the client's working directory.
+func serveDaemon(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		handleDaemonConn(conn)
+	}
+}
+
+func handleDaemonConn(conn net.Conn) {
+	defer conn.Close()
+
+	var req daemonRequest
+	conn.SetReadDeadline(time.Now().Add(daemonTimeout))
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+
+	var resp daemonResponse
+	var stdout, stderr bytes.Buffer
+	if err := os.Chdir(req.Dir); err != nil {
+		fmt.Fprintf(&stderr, "Error: %v\n", err)
+		resp.Exit = exitError
+	} else {
+		var stdin io.Reader = noStdin{}
+		if req.HasStdin {
+			stdin = bytes.NewReader(req.Stdin)
+		}
+		resp.Exit = runCLILang(supportedLanguage(req.Lang), req.Args, stdin, &stdout, &stderr)
+	}
+	resp.Stdout, resp.Stderr = stdout.Bytes(), stderr.Bytes()
+	conn.SetWriteDeadline(time.Now().Add(daemonTimeout))
+	json.NewEncoder(conn).Encode(&resp)
+}
+
+// newDaemonRequest builds the request for an invocation in lang, reading
+// all of stdin first if run would read it, so the request goes to the daemon
+// in one piece
+func newDaemonRequest(args []string, lang string, config *Config, stdin io.Reader) (*daemonRequest, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	req := &daemonRequest{Args: withoutUseDaemon(args), Dir: dir, Lang: lang}
+
+	noOtherInput := len(config.Args) == 0 && len(config.InputFiles) == 0 && !config.SecretPrompt
+	if config.ReadStdin || noOtherInput && !isTerminal(stdin) {
+		if req.Stdin, err = io.ReadAll(stdin); err != nil {
+			return nil, fmt.Errorf("reading stdin: %w", err)
+		}
+		req.HasStdin = true
+	}
+	return req, nil
+}
+
+// runViaDaemon runs an invocation in the daemon listening on socket. It
+// reports false, having written nothing, if no daemon answers.
+func runViaDaemon(socket string, req *daemonRequest, stdout, stderr io.Writer) (int, bool) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return 0, false
+	}
+	defer conn.Close()
+
+	var resp daemonResponse
+	err = json.NewEncoder(conn).Encode(req)
+	if err == nil {
+		err = json.NewDecoder(conn).Decode(&resp)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: talking to daemon on %s: %v\n", socket, err)
+		return exitError, true
+	}
+	stdout.Write(resp.Stdout)
+	stderr.Write(resp.Stderr)
+	return resp.Exit, true
+}
+
+// withoutUseDaemon drops --use-daemon from the arguments passed on
+func withoutUseDaemon(args []string) []string {
+	var kept []string
+	for i, arg := range args {
+		if arg == "--" {
+			return append(kept, args[i:]...)
+		}
+		if arg != "--use-daemon" && !strings.HasPrefix(arg, "--use-daemon=") {
+			kept = append(kept, arg)
+		}
+	}
+	return kept
+}
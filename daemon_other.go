@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package main
+
+import "os"
+
+// ownedByUser reports whether the file at path exists. Ownership is not
+// checked here; the default socket is in the user's own temp directory.
+func ownedByUser(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUseDaemon(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "d.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer l.Close()
+	go serveDaemon(l)
+
+	input := filepath.Join(dir, "in.txt")
+	os.WriteFile(input, []byte("one\n\"two\"\n"), 0o644)
+
+	tests := []struct {
+		args  []string
+		stdin string
+	}{
+		{[]string{"-q", "a\tb"}, ""},
+		{[]string{"-l"}, "x\ny\\z\n"},
+		{[]string{"-l", "-f", input}, ""},
+		{[]string{"-u", `bad\x`}, ""},
+		{[]string{"--bogus"}, ""},
+		{[]string{"--", "--use-daemon"}, ""},
+	}
+
+	for _, tt := range tests {
+		var localOut, localErr, out, errOut bytes.Buffer
+		want := run(tt.args, strings.NewReader(tt.stdin), &localOut, &localErr)
+		args := append([]string{"--use-daemon=" + socket}, tt.args...)
+		got := run(args, strings.NewReader(tt.stdin), &out, &errOut)
+		if got != want || out.String() != localOut.String() || errOut.String() != localErr.String() {
+			t.Errorf("%v via daemon = %d, %q, %q; in process = %d, %q, %q",
+				tt.args, got, out.String(), errOut.String(), want, localOut.String(), localErr.String())
+		}
+	}
+}
+
+func TestUseDaemonLanguage(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "d.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer l.Close()
+	go serveDaemon(l)
+
+	// The daemon's own locale is not the client's
+	t.Setenv("LC_ALL", "C")
+	dir, _ := os.Getwd()
+	req := &daemonRequest{Args: []string{"-u", `\x`}, Dir: dir, Lang: "de"}
+	var stdout, stderr bytes.Buffer
+	code, ok := runViaDaemon(socket, req, &stdout, &stderr)
+	if !ok || code != exitError {
+		t.Fatalf("runViaDaemon = %d, %v; want %d, true", code, ok, exitError)
+	}
+	if !strings.HasPrefix(stderr.String(), "Fehler: ") {
+		t.Errorf("stderr = %q, want it in German", stderr.String())
+	}
+}
+
+func TestUseDaemonFallback(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	socket := filepath.Join(t.TempDir(), "none.sock")
+	exitCode := run([]string{"--use-daemon=" + socket, "-q", "hi"}, strings.NewReader(""), &stdout, &stderr)
+	if exitCode != 0 || stdout.String() != "\"hi\"\n" || stderr.Len() != 0 {
+		t.Errorf("got %d, %q, %q; want the in-process result", exitCode, stdout.String(), stderr.String())
+	}
+}
+
+func TestUseDaemonStaleSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "stale.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	// The stdin read for the daemon is still there for the run in process
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"--use-daemon=" + socket, "-l"}, strings.NewReader("a\nb\"\n"), &stdout, &stderr)
+	if exitCode != 0 || stdout.String() != "a\nb\\\"\n" {
+		t.Errorf("got %d, %q, %q; want the in-process result", exitCode, stdout.String(), stderr.String())
+	}
+}
+
+func TestPrivateDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "d")
+	if err := privateDir(dir); err != nil {
+		t.Fatalf("privateDir = %v, want the directory created", err)
+	}
+	if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0o700 {
+		t.Fatalf("directory = %v, %v; want mode 0700", info, err)
+	}
+
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := privateDir(dir); err == nil {
+		t.Error("privateDir accepted a directory others can read")
+	}
+}
+
+func TestWithoutUseDaemon(t *testing.T) {
+	got := withoutUseDaemon([]string{"--use-daemon", "-q", "--use-daemon=/s", "x", "--", "--use-daemon"})
+	want := []string{"-q", "x", "--", "--use-daemon"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("withoutUseDaemon = %q, want %q", got, want)
+	}
+}
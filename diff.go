@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Lines of context around each change in --diff-output hunks
+const diffContext = 3
+
+// ProcessFileDiff processes a file and writes a unified diff between its
+// original content and the transformed output instead of the output itself
+func (p *Processor) ProcessFileDiff(path string) error {
+	source := p.sourceName(path)
+	p.beginSource(source)
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return msgf("cannot open file %q: %w", path, err)
+	}
+	if skip, err := p.checkBinary(source, original[:min(len(original), sniffSize)]); skip || err != nil {
+		return err
+	}
+
+	out := p.Output
+	var transformed bytes.Buffer
+	p.Output = &transformed
+	err = p.processSource(bytes.NewReader(original), source)
+	p.Output = out
+	if err != nil {
+		return err
+	}
+
+	if err := writeUnifiedDiff(p.Output, path, string(original), transformed.String()); err != nil {
+		return &writeError{err}
+	}
+	return nil
+}
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added
+type diffOp struct {
+	kind byte
+	line string
+	a, b int // line indices in the old and new text
+}
+
+// splitLines splits s into lines, keeping each line's terminating newline so
+// a missing newline at EOF shows up as a difference
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a shortest edit script from a to b using Myers' O(ND)
+// algorithm, in its linear-space form: rather than keeping every step of
+// the search to backtrack through, it finds the middle snake of the edit
+// graph by searching from both ends at once, and diffs the parts on either
+// side of it recursively
+func diffLines(a, b []string) []diffOp {
+	off := (len(a)+len(b)+1)/2 + 1
+	d := &differ{a: a, b: b, off: off, vf: make([]int, 2*off+2), vb: make([]int, 2*off+2)}
+	d.compare(0, len(a), 0, len(b))
+	return d.ops
+}
+
+// differ holds the state of diffLines: the furthest reaching x on each
+// diagonal, searching forward and backward, and the script so far
+type differ struct {
+	a, b   []string
+	off    int // index of diagonal 0 in vf and vb
+	vf, vb []int
+	ops    []diffOp
+}
+
+// compare appends the edit script from a[a0:a1] to b[b0:b1]
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.ops = append(d.ops, diffOp{' ', d.a[a0], a0, b0})
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a0 < a1-suffix && b0 < b1-suffix && d.a[a1-1-suffix] == d.b[b1-1-suffix] {
+		suffix++
+	}
+	a1 -= suffix
+	b1 -= suffix
+
+	switch {
+	case a0 == a1:
+		for y := b0; y < b1; y++ {
+			d.ops = append(d.ops, diffOp{'+', d.b[y], a0, y})
+		}
+	case b0 == b1:
+		for x := a0; x < a1; x++ {
+			d.ops = append(d.ops, diffOp{'-', d.a[x], x, b0})
+		}
+	default:
+		// With the common ends trimmed and neither side empty, at least
+		// two edits are needed, so both halves are smaller problems
+		x, y, u, v := d.middleSnake(a0, a1, b0, b1)
+		d.compare(a0, x, b0, y)
+		for ; x < u; x, y = x+1, y+1 {
+			d.ops = append(d.ops, diffOp{' ', d.a[x], x, y})
+		}
+		d.compare(u, a1, v, b1)
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.ops = append(d.ops, diffOp{' ', d.a[a1+i], a1 + i, b1 + i})
+	}
+}
+
+// middleSnake returns the start and end of the snake in the middle of a
+// shortest path from (a0, b0) to (a1, b1). The backward search works in
+// coordinates reversed from the far corner, where forward diagonal k is
+// diagonal delta-k.
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x0, y0, x1, y1 int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	vf, vb, off := d.vf, d.vb, d.off
+	vf[off+1], vb[off+1] = 0, 0
+
+	for step := 0; step <= (n+m+1)/2; step++ {
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1] // move down: insertion
+			} else {
+				x = vf[off+k-1] + 1 // move right: deletion
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && d.a[a0+x] == d.b[b0+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			if kr := delta - k; odd && kr >= -(step-1) && kr <= step-1 && x+vb[off+kr] >= n {
+				return a0 + sx, b0 + sy, a0 + x, b0 + y
+			}
+		}
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && d.a[a1-1-x] == d.b[b1-1-y] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+			if kf := delta - k; !odd && kf >= -step && kf <= step && x+vf[off+kf] >= n {
+				return a1 - x, b1 - y, a1 - sx, b1 - sy
+			}
+		}
+	}
+	panic("diff: no middle snake")
+}
+
+// writeUnifiedDiff writes a unified diff of old and new for path, in the
+// a/ b/ form git apply expects. Nothing is written if they are identical.
+func writeUnifiedDiff(w io.Writer, path, old, new string) error {
+	if old == new {
+		return nil
+	}
+	path = diffPath(path)
+
+	ops := diffLines(splitLines(old), splitLines(new))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- a/%s\n+++ b/%s\n", path, path)
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Extend the hunk until a run of unchanged lines is long enough to
+		// separate it from the next change
+		start := max(i-diffContext, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContext {
+				end = min(end+diffContext, len(ops))
+				break
+			}
+			end = run
+		}
+
+		writeHunk(&buf, ops[start:end])
+		i = end
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// diffPath gives path as the relative, slash-separated name a diff header
+// carries. An absolute path is taken relative to the working directory if it
+// is inside it, and otherwise from the root.
+func diffPath(path string) string {
+	path = filepath.Clean(path)
+	if filepath.IsAbs(path) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, path); err == nil && filepath.IsLocal(rel) {
+				path = rel
+			}
+		}
+		path = strings.TrimLeft(path[len(filepath.VolumeName(path)):], string(filepath.Separator))
+	}
+	return filepath.ToSlash(path)
+}
+
+func writeHunk(buf *bytes.Buffer, ops []diffOp) {
+	oldStart, newStart := ops[0].a+1, ops[0].b+1
+	oldLen, newLen := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			oldLen++
+		}
+		if op.kind != '-' {
+			newLen++
+		}
+	}
+	// An empty range is anchored at the line before it
+	if oldLen == 0 {
+		oldStart--
+	}
+	if newLen == 0 {
+		newStart--
+	}
+
+	fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", oldStart, oldLen, newStart, newLen)
+	for _, op := range ops {
+		buf.WriteByte(op.kind)
+		buf.WriteString(op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old      string
+		new      string
+		expected string
+	}{
+		{
+			name:     "identical",
+			old:      "a\nb\n",
+			new:      "a\nb\n",
+			expected: "",
+		},
+		{
+			name: "single change",
+			old:  "one\ntwo\nthree\n",
+			new:  "one\n2\nthree\n",
+			expected: "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n" +
+				" one\n-two\n+2\n three\n",
+		},
+		{
+			name: "separate hunks",
+			old:  "x\n1\n2\n3\n4\n5\n6\n7\n8\ny\n",
+			new:  "X\n1\n2\n3\n4\n5\n6\n7\n8\nY\n",
+			expected: "--- a/f\n+++ b/f\n" +
+				"@@ -1,4 +1,4 @@\n-x\n+X\n 1\n 2\n 3\n" +
+				"@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-y\n+Y\n",
+		},
+		{
+			name:     "added to empty",
+			old:      "",
+			new:      "a\n",
+			expected: "--- a/f\n+++ b/f\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+		{
+			name: "missing newline at end",
+			old:  "a\nb",
+			new:  "a\nb\n",
+			expected: "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n" +
+				"-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeUnifiedDiff(&buf, "f", tt.old, tt.new); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("diff =\n%s\nwant\n%s", buf.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestDiffLinesMinimal(t *testing.T) {
+	a := strings.Split("a b c a b b a", " ")
+	b := strings.Split("c b a b a c", " ")
+	ops := diffLines(a, b)
+
+	var edits int
+	var gotA, gotB []string
+	for _, op := range ops {
+		if op.kind != ' ' {
+			edits++
+		}
+		if op.kind != '+' {
+			gotA = append(gotA, op.line)
+		}
+		if op.kind != '-' {
+			gotB = append(gotB, op.line)
+		}
+	}
+	if strings.Join(gotA, " ") != strings.Join(a, " ") || strings.Join(gotB, " ") != strings.Join(b, " ") {
+		t.Errorf("edit script does not reproduce inputs: %v", ops)
+	}
+	if edits != 5 {
+		t.Errorf("edit script has %d edits, want 5", edits)
+	}
+}
+
+func TestDiffPath(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		path, expected string
+	}{
+		{"f", "f"},
+		{"./dir//f", "dir/f"},
+		{filepath.Join(wd, "sub", "f"), "sub/f"},
+		{filepath.Join(filepath.Dir(wd), "elsewhere", "f"), strings.TrimPrefix(filepath.ToSlash(filepath.Dir(wd)), "/") + "/elsewhere/f"},
+	} {
+		if got := diffPath(tt.path); got != tt.expected {
+			t.Errorf("diffPath(%q) = %q, want %q", tt.path, got, tt.expected)
+		}
+	}
+}
+
+func TestDiffOutputFlag(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "in.txt")
+	if err := os.WriteFile(path, []byte("plain\nsay \"hi\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"-l", "--diff-output", "-f", path}, strings.NewReader(""), &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+
+	name := diffPath(path)
+	expected := "--- a/" + name + "\n+++ b/" + name + "\n@@ -1,2 +1,2 @@\n" +
+		" plain\n-say \"hi\"\n+say \\\"hi\\\"\n"
+	if stdout.String() != expected {
+		t.Errorf("stdout = %q, want %q", stdout.String(), expected)
+	}
+}
@@ -0,0 +1,730 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/user/jsonescape/pkg/jsonescape"
+)
+
+// Policies for --dup-keys
+const (
+	dupError = "error"
+	dupFirst = "first"
+	dupLast  = "last"
+)
+
+var dupPolicies = []string{dupError, dupFirst, dupLast}
+
+// maxNesting bounds how deeply arrays and objects may nest, as in
+// encoding/json, so a hostile document cannot exhaust the stack
+const maxNesting = 10000
+
+// processDocument reads a JSON document from r and writes it back out with
+// every string (including object keys) re-encoded by the active escaping
+// options. Everything else, including whitespace, is copied through as it
+// is. Only one string at a time is held in memory, except that --sort-keys
+// and --dup-keys=first or last hold each object until its members are all
+// read, and --dup-keys=error each whole document.
+func (p *Processor) processDocument(r io.Reader, source string) error {
+	w := bufio.NewWriter(p.Output)
+	dr := &docRewriter{
+		p:    p,
+		r:    bufio.NewReader(r),
+		w:    w,
+		line: 1,
+		// A duplicate key may turn up at the very end, and a document
+		// rejected for one must not be written in part
+		hold: p.Config.DupKeys == dupError,
+	}
+
+	err := dr.document(source)
+	if flushErr := w.Flush(); err == nil && flushErr != nil {
+		err = &writeError{flushErr}
+	}
+	return err
+}
+
+// processNDJSON rewrites each line of r as a separate JSON document. Blank
+// lines are dropped and output is flushed after every line so it can follow
+// a live log. A line is only written once it has been read in full, so
+// under --keep-going a bad line is left out entirely.
+func (p *Processor) processNDJSON(r io.Reader, source string) error {
+	scanner := bufio.NewScanner(r)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 10*1024*1024)
+
+	var advance int
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		n, token, err := bufio.ScanLines(data, atEOF)
+		advance = n
+		return n, token, err
+	})
+
+	w := bufio.NewWriter(p.Output)
+	line, offset := 1, int64(0)
+	for scanner.Scan() {
+		text := scanner.Bytes()
+		if len(bytes.TrimSpace(text)) > 0 {
+			dr := &docRewriter{
+				p:      p,
+				r:      bufio.NewReader(bytes.NewReader(text)),
+				w:      w,
+				line:   line,
+				offset: offset,
+				single: true,
+				hold:   true,
+			}
+			err := dr.document(source)
+			if flushErr := w.Flush(); err == nil && flushErr != nil {
+				err = &writeError{flushErr}
+			}
+			if err != nil {
+				// A line skipped under --keep-going still takes up its index
+				if err = p.fail(err); err != nil {
+					return err
+				}
+				p.count++
+				p.noteRecord(false, true)
+			}
+		}
+		line++
+		offset += int64(advance)
+	}
+	return scanner.Err()
+}
+
+// docRewriter is a streaming recursive-descent JSON parser that copies its
+// input to w, rewriting strings on the way
+type docRewriter struct {
+	p *Processor
+	r *bufio.Reader
+	w *bufio.Writer
+
+	// Position of the last byte read, for error messages
+	line, col int
+	offset    int64
+
+	changed bool   // some string in the current value was re-encoded differently
+	single  bool   // reject anything after the first top-level value
+	hold    bool   // write each top-level value only once it has been read in full
+	source  string // the input, for warnings
+
+	path []pathStep // members and elements leading to the current value
+}
+
+// document processes the top-level values of the input. Unless single is
+// set there may be several, concatenated or separated by whitespace as many
+// streaming producers emit them. Whitespace around values is dropped and each
+// value is written as one record.
+func (d *docRewriter) document(source string) error {
+	d.source = source
+	if err := d.skipSpace(false); err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	if _, err := d.peek(); err == io.EOF {
+		return fmt.Errorf("%s: no JSON value in input", source)
+	}
+
+	for {
+		start := time.Now()
+		rec := Record{Index: d.p.count, Source: source, Line: d.line, Offset: d.offset}
+		d.changed = false
+		var text string
+		var err error
+		if d.hold {
+			text, err = d.capture(d.value)
+		} else {
+			err = d.value()
+		}
+		if err == nil && d.single {
+			err = d.end()
+		}
+		if err != nil {
+			d.p.traceRecord(rec, "", start, err)
+			return &locationError{source, err}
+		}
+		d.w.WriteString(text)
+		d.w.WriteString(d.p.separator())
+		if d.p.shards != nil {
+			// The whole document must be in the shard before it can end
+			if err := d.w.Flush(); err != nil {
+				return err
+			}
+			if err := d.p.shards.endRecord(); err != nil {
+				return err
+			}
+		}
+		rec.Index = d.p.count
+		rec.Changed = d.changed
+		d.p.record = rec
+		d.p.count++
+		d.p.noteRecord(rec.Changed, false)
+		d.p.traceRecord(rec, traceRewritten, start, nil)
+
+		if d.single {
+			return nil
+		}
+		if err := d.skipSpace(false); err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		if _, err := d.peek(); err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// end checks that nothing but whitespace follows the top-level value
+func (d *docRewriter) end() error {
+	if err := d.skipSpace(false); err != nil {
+		return err
+	}
+	if _, err := d.peek(); err != io.EOF {
+		return d.errorf("unexpected data after top-level value")
+	}
+	return nil
+}
+
+// docSyntaxError reports malformed JSON with its position
+type docSyntaxError struct {
+	line, col int
+	msg       string
+}
+
+func (e *docSyntaxError) Error() string {
+	return fmt.Sprintf("invalid JSON at line %d, column %d: %s", e.line, e.col, e.msg)
+}
+
+// errorf reports a syntax error at the last byte read
+func (d *docRewriter) errorf(format string, args ...any) error {
+	return &docSyntaxError{d.line, max(d.col, 1), fmt.Sprintf(format, args...)}
+}
+
+// peek returns the next byte without consuming it
+func (d *docRewriter) peek() (byte, error) {
+	b, err := d.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// next consumes one byte, treating EOF as a syntax error since every caller
+// is in the middle of a value
+func (d *docRewriter) next() (byte, error) {
+	c, err := d.r.ReadByte()
+	if err == io.EOF {
+		return 0, d.errorf("unexpected end of input")
+	}
+	if err != nil {
+		return 0, msgf("reading input: %w", err)
+	}
+	d.offset++
+	if c == '\n' {
+		d.line++
+		d.col = 0
+	} else {
+		d.col++
+	}
+	return c, nil
+}
+
+// expect consumes c, copying it to the output
+func (d *docRewriter) expect(c byte) error {
+	got, err := d.next()
+	if err != nil {
+		return err
+	}
+	if got != c {
+		return d.unexpected(got)
+	}
+	d.w.WriteByte(c)
+	return nil
+}
+
+func (d *docRewriter) unexpected(c byte) error {
+	return d.errorf("unexpected character %q", c)
+}
+
+// skipSpace consumes whitespace, and comments under --allow-comments,
+// copying them to the output if keep is set
+func (d *docRewriter) skipSpace(keep bool) error {
+	for {
+		c, err := d.peek()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return msgf("reading input: %w", err)
+		}
+		if c == '/' && d.p.Config.AllowComments {
+			if err := d.comment(keep); err != nil {
+				return err
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			return nil
+		}
+		d.next()
+		if keep {
+			d.w.WriteByte(c)
+		}
+	}
+}
+
+// comment consumes a // line comment or a /* block */ comment. A line
+// comment stops before its newline, which is left for skipSpace.
+func (d *docRewriter) comment(keep bool) error {
+	var text []byte
+	d.next()
+	c, err := d.next()
+	if err != nil {
+		return err
+	}
+	text = append(text, '/', c)
+
+	switch c {
+	case '/':
+		for {
+			c, err := d.peek()
+			if err == io.EOF || c == '\n' {
+				break
+			}
+			if err != nil {
+				return msgf("reading input: %w", err)
+			}
+			d.next()
+			text = append(text, c)
+		}
+	case '*':
+		for !bytes.HasSuffix(text[2:], []byte("*/")) {
+			c, err := d.next()
+			if err != nil {
+				return d.errorf("unterminated block comment")
+			}
+			text = append(text, c)
+		}
+	default:
+		return d.unexpected(c)
+	}
+
+	if keep {
+		d.w.Write(text)
+	}
+	return nil
+}
+
+// value processes any JSON value
+func (d *docRewriter) value() error {
+	c, err := d.peek()
+	if err == io.EOF {
+		return d.errorf("unexpected end of input")
+	}
+	if err != nil {
+		return msgf("reading input: %w", err)
+	}
+
+	if (c == '{' || c == '[') && len(d.path) >= maxNesting {
+		d.next()
+		return d.errorf("arrays and objects nested more than %d deep", maxNesting)
+	}
+	switch {
+	case c == '{':
+		return d.object()
+	case c == '[':
+		return d.array()
+	case c == '"':
+		_, err := d.str(d.selected())
+		return err
+	case c == 't':
+		return d.literal("true")
+	case c == 'f':
+		return d.literal("false")
+	case c == 'n':
+		return d.literal("null")
+	case c == '-' || c >= '0' && c <= '9':
+		return d.number()
+	default:
+		d.next()
+		return d.unexpected(c)
+	}
+}
+
+func (d *docRewriter) object() error {
+	if err := d.expect('{'); err != nil {
+		return err
+	}
+	if err := d.skipSpace(true); err != nil {
+		return err
+	}
+	if c, _ := d.peek(); c == '}' {
+		return d.expect('}')
+	}
+
+	// Under --sort-keys, and when --dup-keys may drop members, each member
+	// and the text after it are collected, to be written once all the keys
+	// are known
+	dups := d.p.Config.DupKeys
+	collect := d.p.Config.SortKeys || dups == dupFirst || dups == dupLast
+	var members []docMember
+	var seen map[string]int // index of each key's member in members
+	if dups != "" {
+		seen = make(map[string]int)
+	}
+	for {
+		m := docMember{line: d.line, col: d.col + 1}
+		var more bool
+		var err error
+		if collect {
+			m.text, err = d.capture(func() (err error) {
+				m.key, err = d.member()
+				return err
+			})
+			if err == nil {
+				m.after, err = d.capture(func() (err error) {
+					more, err = d.afterMember()
+					return err
+				})
+			}
+		} else if m.key, err = d.member(); err == nil {
+			more, err = d.afterMember()
+		}
+		if err != nil {
+			return err
+		}
+
+		if seen != nil {
+			if i, ok := seen[m.key]; ok {
+				if err := d.duplicateKey(&members[i], &m); err != nil {
+					return err
+				}
+			}
+			if _, ok := seen[m.key]; !ok || dups == dupLast {
+				seen[m.key] = len(members)
+			}
+		}
+		// Under --dup-keys=error only the positions are needed
+		if collect || dups == dupError {
+			members = append(members, m)
+		}
+		if !more {
+			break
+		}
+	}
+	if collect {
+		d.writeMembers(members)
+	}
+	return nil
+}
+
+// duplicateKey applies the --dup-keys policy to m, whose key is the same
+// as that of the earlier member prev
+func (d *docRewriter) duplicateKey(prev, m *docMember) error {
+	if d.p.Config.DupKeys == dupError {
+		return fmt.Errorf("line %d, column %d: duplicate key %q, first at line %d, column %d", m.line, m.col, m.key, prev.line, prev.col)
+	}
+	keep := "first"
+	if d.p.Config.DupKeys == dupLast {
+		keep = "last"
+		prev.dropped = true
+	} else {
+		m.dropped = true
+	}
+	d.changed = true
+	d.p.warnf("%s: line %d, column %d: duplicate key %q, also at line %d, column %d; keeping the %s", d.source, m.line, m.col, m.key, prev.line, prev.col, keep)
+	return nil
+}
+
+// member processes an object member, returning its decoded key
+func (d *docRewriter) member() (string, error) {
+	if c, _ := d.peek(); c != '"' {
+		d.next()
+		return "", d.errorf("expected string for object key")
+	}
+	// With --fields, keys are never selected, only values
+	key, err := d.str(d.p.Config.Fields == nil)
+	if err != nil {
+		return "", err
+	}
+	if err := d.skipSpace(true); err != nil {
+		return "", err
+	}
+	if err := d.expect(':'); err != nil {
+		return "", err
+	}
+	if err := d.skipSpace(true); err != nil {
+		return "", err
+	}
+	d.path = append(d.path, pathStep{key: key})
+	if err := d.value(); err != nil {
+		return "", err
+	}
+	d.path = d.path[:len(d.path)-1]
+	return key, nil
+}
+
+// afterMember processes what follows an object member up to the next one,
+// reporting whether there is one
+func (d *docRewriter) afterMember() (bool, error) {
+	if err := d.skipSpace(true); err != nil {
+		return false, err
+	}
+
+	c, err := d.next()
+	if err != nil {
+		return false, err
+	}
+	switch c {
+	case ',':
+		d.w.WriteByte(c)
+		if err := d.skipSpace(true); err != nil {
+			return false, err
+		}
+		if c, _ := d.peek(); c == '}' && d.p.Config.AllowTrailingCommas {
+			return false, d.expect('}')
+		}
+		return true, nil
+	case '}':
+		d.w.WriteByte(c)
+		return false, nil
+	default:
+		return false, d.errorf("expected ',' or '}' after object member, got %q", c)
+	}
+}
+
+// docMember is an object member, held back if it is collected for
+// --sort-keys or --dup-keys
+type docMember struct {
+	key       string // decoded, to sort and compare by
+	line, col int    // where the key starts
+	text      string // the member as written, from its key to the end of its value
+	after     string // the commas, whitespace and comments up to the next member
+	dropped   bool   // a duplicate left out under --dup-keys
+}
+
+// writeMembers writes an object's members, less any dropped, and in order
+// of their keys' bytes under --sort-keys. The text between members stays
+// where it was, so the layout of the object is kept; members with the same
+// key keep their order.
+func (d *docRewriter) writeMembers(members []docMember) {
+	var kept []docMember
+	for _, m := range members {
+		if !m.dropped {
+			kept = append(kept, m)
+		}
+	}
+	if d.p.Config.SortKeys {
+		slices.SortStableFunc(kept, func(a, b docMember) int {
+			return strings.Compare(a.key, b.key)
+		})
+	}
+	for i, m := range kept {
+		if m.key != members[i].key {
+			d.changed = true
+		}
+		// The last member takes the object's closing brace with it
+		after := members[i].after
+		if i == len(kept)-1 {
+			after = members[len(members)-1].after
+		}
+		d.w.WriteString(m.text)
+		d.w.WriteString(after)
+	}
+}
+
+// capture runs fn with the output going to a buffer, and returns what it
+// wrote there
+func (d *docRewriter) capture(fn func() error) (string, error) {
+	w := d.w
+	var buf bytes.Buffer
+	d.w = bufio.NewWriter(&buf)
+	err := fn()
+	d.w.Flush()
+	d.w = w
+	return buf.String(), err
+}
+
+func (d *docRewriter) array() error {
+	if err := d.expect('['); err != nil {
+		return err
+	}
+	if err := d.skipSpace(true); err != nil {
+		return err
+	}
+	if c, _ := d.peek(); c == ']' {
+		return d.expect(']')
+	}
+
+	for n := 0; ; n++ {
+		d.path = append(d.path, pathStep{index: true, n: n})
+		if err := d.value(); err != nil {
+			return err
+		}
+		d.path = d.path[:len(d.path)-1]
+		if err := d.skipSpace(true); err != nil {
+			return err
+		}
+
+		c, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch c {
+		case ',':
+			d.w.WriteByte(c)
+			if err := d.skipSpace(true); err != nil {
+				return err
+			}
+			if c, _ := d.peek(); c == ']' && d.p.Config.AllowTrailingCommas {
+				return d.expect(']')
+			}
+		case ']':
+			d.w.WriteByte(c)
+			return nil
+		default:
+			return d.errorf("expected ',' or ']' after array element, got %q", c)
+		}
+	}
+}
+
+// str reads a string and returns it decoded. If rewrite is set it is written
+// back through the Processor's escaping, otherwise it is copied verbatim.
+func (d *docRewriter) str(rewrite bool) (string, error) {
+	if _, err := d.next(); err != nil { // opening quote
+		return "", err
+	}
+	line, col := d.line, d.col
+
+	var raw strings.Builder
+	for {
+		c, err := d.next()
+		if err != nil {
+			return "", err
+		}
+		if c == '"' {
+			break
+		}
+		if c < 0x20 {
+			return "", d.errorf("control character %q in string", c)
+		}
+		raw.WriteByte(c)
+		if c == '\\' {
+			c, err = d.next()
+			if err != nil {
+				return "", err
+			}
+			raw.WriteByte(c)
+		}
+	}
+
+	decoded, err := jsonescape.Unescape(raw.String())
+	if err != nil {
+		return "", &docSyntaxError{line, col, err.Error()}
+	}
+	result := raw.String()
+	if rewrite {
+		result, err = d.p.transform(decoded)
+		if err != nil {
+			return "", fmt.Errorf("line %d, column %d: %w", line, col, err)
+		}
+		if result != raw.String() {
+			d.changed = true
+		}
+	}
+
+	d.w.WriteByte('"')
+	d.w.WriteString(result)
+	d.w.WriteByte('"')
+	return decoded, nil
+}
+
+// selected reports whether a string at the current path is picked by
+// --fields, or true when no fields were given
+func (d *docRewriter) selected() bool {
+	if d.p.Config.Fields == nil {
+		return true
+	}
+	for _, f := range d.p.Config.Fields {
+		if f.selects(d.path) {
+			return true
+		}
+	}
+	return false
+}
+
+// literal reads one of true, false or null
+func (d *docRewriter) literal(word string) error {
+	for i := 0; i < len(word); i++ {
+		c, err := d.next()
+		if err != nil {
+			return err
+		}
+		if c != word[i] {
+			return d.unexpected(c)
+		}
+	}
+	d.w.WriteString(word)
+	return nil
+}
+
+// number reads a number, copying it through untouched after checking it
+// against the JSON grammar
+func (d *docRewriter) number() error {
+	var num []byte
+	for {
+		c, err := d.peek()
+		if err != nil || !strings.ContainsRune("+-.0123456789eE", rune(c)) {
+			break
+		}
+		d.next()
+		num = append(num, c)
+	}
+	if !validNumber(num) {
+		return d.errorf("invalid number %q", num)
+	}
+	d.w.Write(num)
+	return nil
+}
+
+// validNumber reports whether s matches the JSON number grammar
+func validNumber(s []byte) bool {
+	i := 0
+	digits := func() int {
+		start := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		return i - start
+	}
+
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	if i < len(s) && s[i] == '0' {
+		i++
+	} else if digits() == 0 {
+		return false
+	}
+	if i < len(s) && s[i] == '.' {
+		i++
+		if digits() == 0 {
+			return false
+		}
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		if digits() == 0 {
+			return false
+		}
+	}
+	return i == len(s)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRewriteStrings(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "normalizes escapes",
+			args:     []string{"--rewrite-strings"},
+			input:    `{"a":"A\/b","c":"👋"}`,
+			expected: `{"a":"A/b","c":"👋"}` + "\n",
+		},
+		{
+			name:     "ascii mode",
+			args:     []string{"--rewrite-strings", "--ascii"},
+			input:    `["Jörg", {"ключ": "é"}]`,
+			expected: `["J\u00f6rg", {"\u043a\u043b\u044e\u0447": "\u00e9"}]` + "\n",
+		},
+		{
+			name:     "html-safe mode",
+			args:     []string{"--rewrite-strings", "--html-safe"},
+			input:    `{"html": "<b>&</b>"}`,
+			expected: `{"html": "\u003cb\u003e\u0026\u003c/b\u003e"}` + "\n",
+		},
+		{
+			name:     "whitespace and scalars preserved",
+			args:     []string{"--rewrite-strings"},
+			input:    "\n  {\n\t\"n\" : -1.5e+3 ,\"t\":true,\"f\":false,\"z\":null, \"e\": [ ] ,\"o\":{}}\n\n",
+			expected: "{\n\t\"n\" : -1.5e+3 ,\"t\":true,\"f\":false,\"z\":null, \"e\": [ ] ,\"o\":{}}\n",
+		},
+		{
+			name:     "scalar document",
+			args:     []string{"--rewrite-strings", "-r"},
+			input:    `"tab\u0009"`,
+			expected: `"tab\t"`,
+		},
+		{
+			name:     "concatenated values",
+			args:     []string{"--rewrite-strings", "-a"},
+			input:    "{\"a\":\"é\"}{\"b\":2}\n\n[\"è\"] \"x\"1 true",
+			expected: "{\"a\":\"\\u00e9\"}\n{\"b\":2}\n[\"\\u00e8\"]\n\"x\"\n1\ntrue\n",
+		},
+		{
+			name:     "control policy applies",
+			args:     []string{"--rewrite-strings", "--controls=strip"},
+			input:    `["a\u0007b"]`,
+			expected: `["ab"]` + "\n",
+		},
+		{
+			name:     "sorted keys",
+			args:     []string{"--rewrite-strings", "--sort-keys"},
+			input:    "{\n  \"b\": 1.50E+3,\n  \"a\": {\"z\": [{\"y\": 2, \"x\": 3}], \"\\u00e9\": 0, \"c\": 1}\n}",
+			expected: "{\n  \"a\": {\"c\": 1, \"z\": [{\"x\": 3, \"y\": 2}], \"é\": 0},\n  \"b\": 1.50E+3\n}\n",
+		},
+		{
+			name:     "sorted keys keep duplicates in order",
+			args:     []string{"--rewrite-strings", "--sort-keys", "--allow-trailing-commas"},
+			input:    `{"k":2,"a":0,"k":1,}`,
+			expected: `{"a":0,"k":2,"k":1,}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			exitCode := run(tt.args, strings.NewReader(tt.input), &stdout, &stderr)
+			if exitCode != 0 {
+				t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestRewriteStringsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"empty", "  ", "no JSON value"},
+		{"leading zero", `[01]`, `invalid number "01"`},
+		{"trailing comma", `{"a":1,}`, "expected string for object key"},
+		{"missing colon", `{"a" 1}`, "unexpected character '1'"},
+		{"unterminated string", `["abc`, "unexpected end of input"},
+		{"raw control character", "[\"a\tb\"]", "control character"},
+		{"bad escape", `["\x"]`, "invalid escape sequence"},
+		{"trailing data", `{} x`, "unexpected character 'x'"},
+		{"error in later value", "{}\n[1,]", "line 2, column 4"},
+		{"bad literal", `[tru]`, "unexpected character ']'"},
+		{"position", "{\n  \"a\": ?}", "line 2, column 8"},
+		{"too deep", strings.Repeat(`[{"a":`, maxNesting/2) + "[", "nested more than 10000 deep"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			exitCode := run([]string{"--rewrite-strings"}, strings.NewReader(tt.input), &stdout, &stderr)
+			if exitCode != 1 {
+				t.Fatalf("exit code = %d, want 1", exitCode)
+			}
+			if !strings.Contains(stderr.String(), tt.err) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.err)
+			}
+		})
+	}
+}
+
+func TestJSONC(t *testing.T) {
+	input := "// settings\n{\n  /* editor */ \"a\": [1, 2,], // note\n  \"b\": \"é\",\n}\n"
+	expected := "{\n  /* editor */ \"a\": [1, 2,], // note\n  \"b\": \"\\u00e9\",\n}\n"
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--rewrite-strings", "-a", "--allow-comments", "--allow-trailing-commas"}
+	exitCode := run(args, strings.NewReader(input), &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	if stdout.String() != expected {
+		t.Errorf("stdout = %q, want %q", stdout.String(), expected)
+	}
+
+	errors := []struct {
+		name  string
+		args  []string
+		input string
+		err   string
+	}{
+		{"comments off", []string{"--allow-trailing-commas"}, "[1 /* x */]", "got '/'"},
+		{"trailing commas off", []string{"--allow-comments"}, "[1,]", "unexpected character ']'"},
+		{"unterminated comment", []string{"--allow-comments"}, "[1 /* x", "unterminated block comment"},
+		{"lone slash", []string{"--allow-comments"}, "[1 /x]", "unexpected character 'x'"},
+		{"only one trailing comma", []string{"--allow-trailing-commas"}, "[1,,]", "unexpected character ','"},
+	}
+	for _, tt := range errors {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"--rewrite-strings"}, tt.args...)
+			if exitCode := run(args, strings.NewReader(tt.input), &stdout, &stderr); exitCode != 1 {
+				t.Fatalf("exit code = %d, want 1", exitCode)
+			}
+			if !strings.Contains(stderr.String(), tt.err) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.err)
+			}
+		})
+	}
+}
+
+func TestValidNumber(t *testing.T) {
+	valid := []string{"0", "-0", "12", "1.5", "-0.25", "1e10", "1E-2", "2.5e+3"}
+	invalid := []string{"", "-", "01", "1.", ".5", "1e", "1e+", "+1", "1.2.3", "--1"}
+
+	for _, s := range valid {
+		if !validNumber([]byte(s)) {
+			t.Errorf("validNumber(%q) = false, want true", s)
+		}
+	}
+	for _, s := range invalid {
+		if validNumber([]byte(s)) {
+			t.Errorf("validNumber(%q) = true, want false", s)
+		}
+	}
+}
+
+func TestNDJSONIn(t *testing.T) {
+	input := "{\"msg\":\"caf\u00e9\"}\n\n  \r\n[\"\\u00e9\"]\r\n{\"n\":1}"
+	expected := `{"msg":"caf\u00e9"}` + "\n" + `["\u00e9"]` + "\n" + `{"n":1}` + "\n"
+
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"--rewrite-strings", "--ndjson-in", "-a"}, strings.NewReader(input), &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	if stdout.String() != expected {
+		t.Errorf("stdout = %q, want %q", stdout.String(), expected)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	exitCode = run([]string{"--rewrite-strings", "--ndjson-in"}, strings.NewReader("{}\n{}\n{\"a\" 1}\n"), &stdout, &stderr)
+	if exitCode != 1 {
+		t.Fatalf("exit code = %d, want 1", exitCode)
+	}
+	if !strings.Contains(stderr.String(), "line 3, column 6") {
+		t.Errorf("stderr = %q, want position line 3, column 6", stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "{}\n{}\n") {
+		t.Errorf("stdout = %q, want the lines before the error", stdout.String())
+	}
+
+	stderr.Reset()
+	exitCode = run([]string{"--rewrite-strings", "--ndjson-in"}, strings.NewReader("{}{}\n"), &stdout, &stderr)
+	if exitCode != 1 || !strings.Contains(stderr.String(), "unexpected data after top-level value") {
+		t.Errorf("exit code = %d, stderr = %q, want a trailing data error", exitCode, stderr.String())
+	}
+
+	// Under --keep-going bad lines are left out whole, and the rest written
+	stdout.Reset()
+	stderr.Reset()
+	exitCode = run([]string{"--rewrite-strings", "--ndjson-in", "--keep-going", "--error-summary"}, strings.NewReader("{\"a\":\"\u00e9\"}\n[\"x\", 01]\n{}{}\n[2]\n"), &stdout, &stderr)
+	if exitCode != 1 {
+		t.Fatalf("exit code = %d, want 1", exitCode)
+	}
+	if want := "{\"a\":\"é\"}\n[2]\n"; stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+	if !strings.Contains(stderr.String(), "2 failed") {
+		t.Errorf("stderr = %q, want a summary of 2 failed lines", stderr.String())
+	}
+}
+
+func TestDupKeys(t *testing.T) {
+	input := "{\n  \"role\": \"user\",\n  \"role\": \"admin\",\n  \"x\": {\"a\": 1, \"\\u0061\": 2, \"b\": 3}\n}"
+	tests := []struct {
+		policy   string
+		expected string
+		warning  string
+	}{
+		{"first", "{\n  \"role\": \"user\",\n  \"x\": {\"a\": 1, \"b\": 3}\n}\n", `-: line 4, column 17: duplicate key "a", also at line 4, column 9; keeping the first`},
+		{"last", "{\n  \"role\": \"admin\",\n  \"x\": {\"a\": 2, \"b\": 3}\n}\n", `-: line 3, column 3: duplicate key "role", also at line 2, column 3; keeping the last`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if exitCode := run([]string{"--rewrite-strings", "--dup-keys", tt.policy}, strings.NewReader(input), &stdout, &stderr); exitCode != 0 {
+				t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
+			}
+			if !strings.Contains(stderr.String(), tt.warning) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.warning)
+			}
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if exitCode := run([]string{"--rewrite-strings", "--dup-keys=error"}, strings.NewReader(input), &stdout, &stderr); exitCode != 1 {
+			t.Fatalf("exit code = %d, want 1", exitCode)
+		}
+		if want := `-: line 3, column 3: duplicate key "role", first at line 2, column 3`; !strings.Contains(stderr.String(), want) {
+			t.Errorf("stderr = %q, want it to contain %q", stderr.String(), want)
+		}
+		// None of the rejected document is written
+		if stdout.Len() > 0 {
+			t.Errorf("stdout = %q, want nothing", stdout.String())
+		}
+	})
+}
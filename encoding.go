@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Output encodings for --output-encoding
+const (
+	encUTF8    = "utf-8"
+	encUTF8BOM = "utf-8-bom"
+	encUTF16LE = "utf-16le"
+)
+
+// outputEncodings lists the values accepted by --output-encoding
+var outputEncodings = []string{encUTF8, encUTF8BOM, encUTF16LE}
+
+// encodingWriter converts the UTF-8 written to it into another encoding,
+// starting with a byte order mark. UTF-8 sequences split across writes are
+// held back until complete; invalid bytes become U+FFFD.
+type encodingWriter struct {
+	w        io.Writer
+	encoding string
+	started  bool   // the byte order mark has been written
+	pending  []byte // incomplete UTF-8 sequence from the last write
+}
+
+// newEncodingWriter wraps w for encoding, or returns nil for plain UTF-8
+func newEncodingWriter(w io.Writer, encoding string) *encodingWriter {
+	if encoding == "" || encoding == encUTF8 {
+		return nil
+	}
+	return &encodingWriter{w: w, encoding: encoding}
+}
+
+func (e *encodingWriter) Write(p []byte) (int, error) {
+	var out []byte
+	if !e.started {
+		e.started = true
+		if e.encoding == encUTF16LE {
+			out = append(out, 0xFF, 0xFE)
+		} else {
+			out = append(out, 0xEF, 0xBB, 0xBF)
+		}
+	}
+
+	if e.encoding == encUTF8BOM {
+		out = append(out, p...)
+	} else {
+		data := append(e.pending, p...)
+		e.pending = nil
+		for len(data) > 0 {
+			if !utf8.FullRune(data) {
+				e.pending = append([]byte(nil), data...)
+				break
+			}
+			r, size := utf8.DecodeRune(data)
+			out = appendUTF16LE(out, r)
+			data = data[size:]
+		}
+	}
+
+	if _, err := e.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes out a sequence left incomplete at the end of the output
+func (e *encodingWriter) Close() error {
+	if len(e.pending) == 0 {
+		return nil
+	}
+	e.pending = nil
+	_, err := e.w.Write(appendUTF16LE(nil, utf8.RuneError))
+	return err
+}
+
+func appendUTF16LE(b []byte, r rune) []byte {
+	if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+		b = append(b, byte(r1), byte(r1>>8))
+		r = r2
+	}
+	return append(b, byte(r), byte(r>>8))
+}
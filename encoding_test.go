@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOutputEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		expected string
+	}{
+		{"utf-8", "utf-8", "é👋\n"},
+		{"utf-8 with bom", "utf-8-bom", "\xef\xbb\xbfé👋\n"},
+		{"utf-16le", "utf-16le", "\xff\xfe\xe9\x00\x3d\xd8\x4b\xdc\n\x00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			exitCode := run([]string{"--output-encoding", tt.encoding, "é👋"}, strings.NewReader(""), &stdout, &stderr)
+			if exitCode != 0 {
+				t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestEncodingWriterSplitWrites(t *testing.T) {
+	var buf bytes.Buffer
+	w := newEncodingWriter(&buf, encUTF16LE)
+	for _, b := range []byte("a日\xff") {
+		w.Write([]byte{b})
+	}
+	w.Write([]byte("\xe6\x97"))
+	w.Close()
+
+	expected := "\xff\xfea\x00\xe5\x65\xfd\xff\xfd\xff"
+	if buf.String() != expected {
+		t.Errorf("output = %q, want %q", buf.String(), expected)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fieldPath is one parsed --fields expression such as errors[*].detail
+type fieldPath []pathStep
+
+// pathStep is one step of a path: an object member or an array element
+type pathStep struct {
+	index bool   // array element rather than object member
+	any   bool   // * or [*]
+	key   string // member name
+	n     int    // element position
+}
+
+// parseFields parses a comma-separated list of path expressions. Members are
+// separated by dots, array elements are selected with [N] or [*] and * matches
+// any member name.
+func parseFields(spec string) ([]fieldPath, error) {
+	var paths []fieldPath
+	for _, expr := range strings.Split(spec, ",") {
+		path, err := parseFieldPath(strings.TrimSpace(expr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid field path %q: %w", expr, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func parseFieldPath(expr string) (fieldPath, error) {
+	if expr == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	var path fieldPath
+	for i := 0; i < len(expr); {
+		if expr[i] == '[' {
+			end := strings.IndexByte(expr[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [")
+			}
+			inner := expr[i+1 : i+end]
+			if inner == "*" {
+				path = append(path, pathStep{index: true, any: true})
+			} else {
+				n, err := strconv.Atoi(inner)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("array index %q is not * or a number", inner)
+				}
+				path = append(path, pathStep{index: true, n: n})
+			}
+			i += end + 1
+			continue
+		}
+
+		if expr[i] == '.' {
+			if len(path) == 0 {
+				return nil, fmt.Errorf("unexpected '.'")
+			}
+			i++
+		} else if len(path) > 0 {
+			return nil, fmt.Errorf("expected '.' or '[' at %q", expr[i:])
+		}
+		end := strings.IndexAny(expr[i:], ".[]")
+		if end < 0 {
+			end = len(expr) - i
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("empty member name")
+		}
+		key := expr[i : i+end]
+		path = append(path, pathStep{key: key, any: key == "*"})
+		i += end
+	}
+	return path, nil
+}
+
+// matches reports whether step selects the current path element
+func (s pathStep) matches(e pathStep) bool {
+	if s.index != e.index {
+		return false
+	}
+	if s.any {
+		return true
+	}
+	if s.index {
+		return s.n == e.n
+	}
+	return s.key == e.key
+}
+
+// selects reports whether a string at path falls under f: either exactly at
+// f or somewhere inside the object or array f points to
+func (f fieldPath) selects(path []pathStep) bool {
+	if len(path) < len(f) {
+		return false
+	}
+	for i, step := range f {
+		if !step.matches(path[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	valid := []string{"message", "errors[*].detail", "[0].msg", "a.*.b", "a[2][*]", "a, b.c"}
+	invalid := []string{"", "a,", ".a", "a..b", "a.", "a[", "a[x]", "a[-1]", "a]"}
+
+	for _, spec := range valid {
+		if _, err := parseFields(spec); err != nil {
+			t.Errorf("parseFields(%q) unexpected error: %v", spec, err)
+		}
+	}
+	for _, spec := range invalid {
+		if _, err := parseFields(spec); err == nil {
+			t.Errorf("parseFields(%q) expected error, got nil", spec)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   string
+		input    string
+		expected string
+	}{
+		{
+			name:     "single member",
+			fields:   "msg",
+			input:    `{"msg":"é","id":"é"}`,
+			expected: `{"msg":"\u00e9","id":"é"}`,
+		},
+		{
+			name:     "any array element",
+			fields:   "errors[*].detail",
+			input:    `{"errors":[{"detail":"é","code":"é"},{"detail":"è"}],"detail":"é"}`,
+			expected: `{"errors":[{"detail":"\u00e9","code":"é"},{"detail":"\u00e8"}],"detail":"é"}`,
+		},
+		{
+			name:     "indexed element and wildcard member",
+			fields:   "[1].*",
+			input:    `[{"a":"é"},{"a":"é","b":"è"}]`,
+			expected: `[{"a":"é"},{"a":"\u00e9","b":"\u00e8"}]`,
+		},
+		{
+			name:     "subtree",
+			fields:   "user",
+			input:    `{"user":{"name":"é","tags":["è"]},"ü":"ü"}`,
+			expected: `{"user":{"name":"\u00e9","tags":["\u00e8"]},"ü":"ü"}`,
+		},
+		{
+			name:     "unselected strings are copied verbatim",
+			fields:   "x",
+			input:    `{"a\/b":"é"}`,
+			expected: `{"a\/b":"é"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := []string{"--rewrite-strings", "-a", "--fields", tt.fields}
+			exitCode := run(args, strings.NewReader(tt.input), &stdout, &stderr)
+			if exitCode != 0 {
+				t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected+"\n" {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected+"\n")
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Wrap styles for --wrap-style
+const (
+	wrapBackslash = "backslash"
+	wrapConcat    = "concat"
+)
+
+// escapedTokens splits escaped output into units that must never be broken
+// across lines: a single character, a two-character escape like \n, a \uXXXX
+// escape, or a \uXXXX\uXXXX surrogate pair
+func escapedTokens(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		n := tokenLen(s[i:])
+		tokens = append(tokens, s[i:i+n])
+		i += n
+	}
+	return tokens
+}
+
+// tokenLen returns the byte length of the escape token at the start of s
+func tokenLen(s string) int {
+	if s[0] != '\\' || len(s) < 2 {
+		_, size := utf8.DecodeRuneInString(s)
+		return size
+	}
+	if s[1] != 'u' || len(s) < 6 {
+		return 2
+	}
+	// Keep surrogate pairs together so no fragment holds half a character
+	if len(s) >= 12 && isHighSurrogateEscape(s[:6]) && s[6] == '\\' && s[7] == 'u' {
+		return 12
+	}
+	return 6
+}
+
+func isHighSurrogateEscape(s string) bool {
+	r, err := parseHexRune(s[2:6])
+	return err == nil && r >= 0xD800 && r <= 0xDBFF
+}
+
+// splitEscaped breaks escaped output into fragments of at most width
+// characters without splitting an escape sequence. A single token wider than
+// width gets a fragment of its own.
+func splitEscaped(s string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	var frags []string
+	var cur strings.Builder
+	n := 0
+	for _, tok := range escapedTokens(s) {
+		w := utf8.RuneCountInString(tok)
+		if n > 0 && n+w > width {
+			frags = append(frags, cur.String())
+			cur.Reset()
+			n = 0
+		}
+		cur.WriteString(tok)
+		n += w
+	}
+	if n > 0 || len(frags) == 0 {
+		frags = append(frags, cur.String())
+	}
+	return frags
+}
+
+// wrapWithBackslash wraps s at column width using backslash-newline line
+// continuations, leaving room on each line for the trailing backslash
+func wrapWithBackslash(s string, width int) string {
+	return strings.Join(splitEscaped(s, width-1), "\\\n")
+}
+
+// wrapWithConcat turns s into quoted fragments joined with " +", each line
+// fitting within width columns including the quotes and operator. This is the
+// generic form for --wrap-style=concat and happens to be valid JavaScript.
+func wrapWithConcat(s string, width int) string {
+	return emitConcat(s, width, "js")
+}
+
+// Default line width for --emit-concat and --emit-bytes without --wrap-column
+const defaultConcatWidth = 80
+
+// concatLanguages lists the languages supported by --emit-concat
+var concatLanguages = []string{"go", "python", "c", "js"}
+
+// emitConcat splits escaped output into string literals for lang, joined with
+// that language's concatenation syntax, so each line fits within width
+// columns. Escapes JSON writes differently from lang are rewritten.
+func emitConcat(s string, width int, lang string) string {
+	frags := splitEscaped(s, width-concatOverhead(lang))
+	for i, f := range frags {
+		frags[i] = `"` + toLanguageEscapes(f, lang) + `"`
+	}
+
+	switch lang {
+	case "go", "js":
+		return strings.Join(frags, " +\n")
+	case "python":
+		// Adjacent literals only continue across lines inside parentheses
+		return "(" + strings.Join(frags, "\n ") + ")"
+	default:
+		return strings.Join(frags, "\n")
+	}
+}
+
+// concatOverhead returns how many columns of each line emitConcat spends on
+// quotes and concatenation for lang
+func concatOverhead(lang string) int {
+	switch lang {
+	case "go", "js":
+		return 4 // "..." +
+	case "python":
+		return 4 // the last line,  "...")
+	case "c":
+		return 2 // "..."
+	}
+	return 0
+}
+
+// minWrapColumn returns the narrowest --wrap-column that leaves room on each
+// line for a character besides what the output form adds to it, along with
+// the options choosing that form. An escape sequence wider than the room
+// left still gets a line of its own, as it cannot be split.
+func minWrapColumn(c *Config) (string, int) {
+	switch {
+	case c.EmitConcat != "":
+		return "--emit-concat " + c.EmitConcat, concatOverhead(c.EmitConcat) + 1
+	case c.EmitBytes != "":
+		return "--emit-bytes " + c.EmitBytes, len("    0x00,")
+	case c.WrapStyle == wrapConcat:
+		return "--wrap-style " + wrapConcat, concatOverhead("js") + 1
+	}
+	return "--wrap-style " + wrapBackslash, 2
+}
+
+// toLanguageEscapes rewrites the JSON escapes in s that lang does not accept
+// verbatim. JavaScript shares JSON's escapes; Go, Python and C can't pair
+// \uXXXX surrogate halves, and C doesn't allow \u for characters below U+00A0.
+func toLanguageEscapes(s, lang string) string {
+	if lang == "js" || !strings.Contains(s, `\u`) {
+		return s
+	}
+
+	var buf strings.Builder
+	for _, tok := range escapedTokens(s) {
+		switch {
+		case len(tok) == 12:
+			hi, _ := parseHexRune(tok[2:6])
+			lo, _ := parseHexRune(tok[8:12])
+			fmt.Fprintf(&buf, `\U%08x`, 0x10000+(hi-0xD800)*0x400+(lo-0xDC00))
+		case len(tok) == 6 && tok[1] == 'u' && lang == "c":
+			r, _ := parseHexRune(tok[2:6])
+			if r < 0xA0 {
+				// Octal escapes stop after three digits, unlike \x
+				fmt.Fprintf(&buf, `\%03o`, r)
+			} else {
+				buf.WriteString(tok)
+			}
+		default:
+			buf.WriteString(tok)
+		}
+	}
+	return buf.String()
+}
+
+// Host delimiters for --host
+const (
+	hostSingleQuote = "single-quote"
+	hostDoubleQuote = "double-quote"
+	hostBacktick    = "backtick"
+)
+
+// hostEscape escapes the delimiter of the host string s will be pasted into.
+// Single-quoted YAML scalars and SQL strings double the quote; JavaScript
+// template literals need a backslash before backticks and before ${, which
+// would otherwise start a substitution. JSON already escapes double quotes.
+func hostEscape(s, host string) string {
+	switch host {
+	case hostSingleQuote:
+		return strings.ReplaceAll(s, "'", "''")
+	case hostBacktick:
+		return strings.NewReplacer("`", "\\`", "${", "\\${").Replace(s)
+	default:
+		return s
+	}
+}
+
+// bytesLanguages lists the languages supported by --emit-bytes
+var bytesLanguages = []string{"go", "c", "python"}
+
+// emitBytes writes s as a byte slice or array literal for lang: on one line
+// if it fits within width columns, otherwise with as many bytes on each
+// indented line as fit
+func emitBytes(s string, width int, lang string) string {
+	head, tail := "[]byte{", "}"
+	switch lang {
+	case "c":
+		head = "{"
+	case "python":
+		head, tail = "bytes([", "])"
+	}
+
+	items := make([]string, len(s))
+	for i := 0; i < len(s); i++ {
+		items[i] = fmt.Sprintf("0x%02x", s[i])
+	}
+	if line := head + strings.Join(items, ", ") + tail; len(line) <= width {
+		return line
+	}
+
+	// Every item is "0xNN," plus a separating space, after a 4-column indent
+	perLine := max((width-4+1)/6, 1)
+	var buf strings.Builder
+	buf.WriteString(head + "\n")
+	for len(items) > 0 {
+		n := min(perLine, len(items))
+		buf.WriteString("    " + strings.Join(items[:n], ", ") + ",\n")
+		items = items[n:]
+	}
+	buf.WriteString(tail)
+	return buf.String()
+}
+
+// Default marker for --heredoc
+const defaultHeredocMarker = "JSONESCAPE"
+
+// heredoc wraps s in a quoted shell heredoc so no expansion happens inside
+// it. If s contains a line equal to the marker, an explicit marker is an
+// error while the default one gets a numeric suffix until it no longer
+// collides.
+func heredoc(s, marker string, explicit bool) (string, error) {
+	if strings.ContainsRune(s, 0) {
+		return "", errors.New("heredoc content cannot contain NUL bytes")
+	}
+
+	lines := strings.Split(s, "\n")
+	collides := func(m string) bool {
+		for _, line := range lines {
+			if line == m {
+				return true
+			}
+		}
+		return false
+	}
+
+	if collides(marker) {
+		if explicit {
+			return "", fmt.Errorf("heredoc marker %q appears in the content", marker)
+		}
+		base := marker
+		for n := 1; collides(marker); n++ {
+			marker = fmt.Sprintf("%s_%d", base, n)
+		}
+	}
+
+	return "<<'" + marker + "'\n" + s + "\n" + marker, nil
+}
+
+// validHeredocMarker reports whether m is safe to use unquoted as a marker
+func validHeredocMarker(m string) bool {
+	if m == "" {
+		return false
+	}
+	for _, c := range m {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/user/jsonescape/pkg/jsonescape"
+)
+
+func TestSplitEscaped(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		width    int
+		expected []string
+	}{
+		{
+			name:     "plain text",
+			input:    "abcdefgh",
+			width:    3,
+			expected: []string{"abc", "def", "gh"},
+		},
+		{
+			name:     "short escape kept whole",
+			input:    `ab\ncd`,
+			width:    3,
+			expected: []string{"ab", `\nc`, "d"},
+		},
+		{
+			name:     "unicode escape kept whole",
+			input:    `a\u0007b`,
+			width:    4,
+			expected: []string{"a", `\u0007`, "b"},
+		},
+		{
+			name:     "surrogate pair kept whole",
+			input:    `\ud83d\udc4bx`,
+			width:    6,
+			expected: []string{`\ud83d\udc4b`, "x"},
+		},
+		{
+			name:     "multibyte characters count as one column",
+			input:    "日本語テスト",
+			width:    2,
+			expected: []string{"日本", "語テ", "スト"},
+		},
+		{
+			name:     "empty input",
+			input:    "",
+			width:    5,
+			expected: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := splitEscaped(tt.input, tt.width)
+			if strings.Join(result, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("splitEscaped(%q, %d) = %q, want %q", tt.input, tt.width, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWrapColumn(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "backslash style",
+			args:     []string{"--wrap-column", "5", "abcdefghij"},
+			expected: "abcd\\\nefgh\\\nij\n",
+		},
+		{
+			name:     "backslash style with quotes",
+			args:     []string{"-q", "--wrap-column=5", "abcdef"},
+			expected: "\"abc\\\ndef\"\n",
+		},
+		{
+			name:     "concat style",
+			args:     []string{"--wrap-column=7", "--wrap-style=concat", "abcdefg"},
+			expected: "\"abc\" +\n\"def\" +\n\"g\"\n",
+		},
+		{
+			name:     "short input untouched",
+			args:     []string{"--wrap-column=80", "hello"},
+			expected: "hello\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			exitCode := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+			if exitCode != 0 {
+				t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestWrapColumnLimit(t *testing.T) {
+	input := strings.Repeat("say \"hi\"\t日本\x07 ", 20)
+	escaped := jsonescape.Escape(input, jsonescape.Options{})
+
+	for _, width := range []int{10, 13, 40} {
+		for _, out := range []string{wrapWithBackslash(escaped, width), wrapWithConcat(escaped, width)} {
+			for _, line := range strings.Split(out, "\n") {
+				if n := utf8.RuneCountInString(line); n > width {
+					t.Errorf("width %d: line %q has %d columns", width, line, n)
+				}
+			}
+		}
+	}
+}
+
+func TestMinWrapColumn(t *testing.T) {
+	// At its narrowest each form still fits text that needs no escaping
+	for _, args := range [][]string{
+		{"--wrap-style", "backslash"},
+		{"--wrap-style", "concat"},
+		{"--emit-concat", "go"},
+		{"--emit-concat", "python"},
+		{"--emit-concat", "c"},
+		{"--emit-bytes", "c"},
+	} {
+		config, err := parseArgs(append([]string{"--wrap-column", "80"}, args...))
+		if err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		_, width := minWrapColumn(config)
+		var stdout, stderr bytes.Buffer
+		all := append([]string{"--wrap-column", strconv.Itoa(width), "abcdefgh"}, args...)
+		if exitCode := run(all, strings.NewReader(""), &stdout, &stderr); exitCode != 0 {
+			t.Fatalf("%v: exit code = %d (stderr: %s)", all, exitCode, stderr.String())
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n") {
+			if len(line) > width {
+				t.Errorf("%v: line %q is wider than %d", all, line, width)
+			}
+		}
+	}
+}
+
+func TestEmitConcat(t *testing.T) {
+	tests := []struct {
+		name     string
+		lang     string
+		input    string
+		width    int
+		expected string
+	}{
+		{"go", "go", "abcdef", 7, "\"abc\" +\n\"def\""},
+		{"js", "js", "abcdef", 7, "\"abc\" +\n\"def\""},
+		{"c", "c", "abcdef", 5, "\"abc\"\n\"def\""},
+		{"python", "python", "abcdef", 7, "(\"abc\"\n \"def\")"},
+		{"single fragment", "python", "abc", 80, "(\"abc\")"},
+		{"go surrogate pair", "go", `\ud83d\udc4b`, 80, `"\U0001f44b"`},
+		{"js surrogate pair", "js", `\ud83d\udc4b`, 80, `"\ud83d\udc4b"`},
+		{"c low code point", "c", `a\u0007b\u003c`, 80, `"a\007b\074"`},
+		{"c high code point", "c", `\u65e5`, 80, `"\u65e5"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := emitConcat(tt.input, tt.width, tt.lang)
+			if result != tt.expected {
+				t.Errorf("emitConcat(%q, %d, %q) = %q, want %q", tt.input, tt.width, tt.lang, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEmitConcatFlag(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"--emit-concat", "go", "--wrap-column=10", "-a", `say "日本"`}, strings.NewReader(""), &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	expected := "\"say \\\"\" +\n\"\\u65e5\" +\n\"\\u672c\" +\n\"\\\"\"\n"
+	if stdout.String() != expected {
+		t.Errorf("stdout = %q, want %q", stdout.String(), expected)
+	}
+}
+
+func TestHostEscape(t *testing.T) {
+	tests := []struct {
+		host, input, expected string
+	}{
+		{hostSingleQuote, `it's \"x\"`, `it''s \"x\"`},
+		{hostDoubleQuote, `it's \"x\"`, `it's \"x\"`},
+		{hostBacktick, "a`b ${c} $d", "a\\`b \\${c} $d"},
+	}
+	for _, tt := range tests {
+		if got := hostEscape(tt.input, tt.host); got != tt.expected {
+			t.Errorf("hostEscape(%q, %q) = %q, want %q", tt.input, tt.host, got, tt.expected)
+		}
+	}
+}
+
+func TestEmitBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		lang     string
+		input    string
+		width    int
+		expected string
+	}{
+		{"go", "go", "hi", 80, "[]byte{0x68, 0x69}"},
+		{"c", "c", "hi", 80, "{0x68, 0x69}"},
+		{"python", "python", "hi", 80, "bytes([0x68, 0x69])"},
+		{"empty", "go", "", 80, "[]byte{}"},
+		{"wrapped", "c", "abcde", 15, "{\n    0x61, 0x62,\n    0x63, 0x64,\n    0x65,\n}"},
+		{"narrow", "python", "ab", 5, "bytes([\n    0x61,\n    0x62,\n])"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := emitBytes(tt.input, tt.width, tt.lang)
+			if result != tt.expected {
+				t.Errorf("emitBytes(%q, %d, %q) = %q, want %q", tt.input, tt.width, tt.lang, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEmitBytesFlag(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"-q", "--emit-bytes", "go", "a\n"}, strings.NewReader(""), &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	if expected := "[]byte{0x22, 0x61, 0x5c, 0x6e, 0x22}\n"; stdout.String() != expected {
+		t.Errorf("stdout = %q, want %q", stdout.String(), expected)
+	}
+}
+
+func TestHeredoc(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+		exitCode int
+	}{
+		{
+			name:     "default marker",
+			args:     []string{"--heredoc", "a\"b"},
+			expected: "<<'JSONESCAPE'\na\\\"b\nJSONESCAPE\n",
+		},
+		{
+			name:     "explicit marker",
+			args:     []string{"--heredoc=EOF", "$HOME"},
+			expected: "<<'EOF'\n$HOME\nEOF\n",
+		},
+		{
+			name:     "default marker collision",
+			args:     []string{"-u", "--heredoc", `x\nJSONESCAPE\ny`},
+			expected: "<<'JSONESCAPE_1'\nx\nJSONESCAPE\ny\nJSONESCAPE_1\n",
+		},
+		{
+			name:     "explicit marker collision",
+			args:     []string{"-u", "--heredoc=EOF", `x\nEOF`},
+			exitCode: 1,
+		},
+		{
+			name:     "NUL in unescaped content",
+			args:     []string{"-u", "--heredoc", `a\u0000b`},
+			exitCode: 1,
+		},
+		{
+			name:     "invalid marker",
+			args:     []string{"--heredoc=E O F", "x"},
+			exitCode: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			exitCode := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+			if exitCode != tt.exitCode {
+				t.Fatalf("exit code = %d, want %d (stderr: %s)", exitCode, tt.exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
+			}
+		})
+	}
+}
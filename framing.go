@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Framings for --framing
+const (
+	framingVarint = "varint"
+	framingU32LE  = "u32le"
+)
+
+var framings = []string{framingVarint, framingU32LE}
+
+// Largest record --framing accepts, for the same reason as maxStdioRequest
+const maxFrameSize = 64 << 20
+
+// processFramed reads records that are each preceded by their length in
+// bytes, as an unsigned LEB128 varint or a 4-byte little-endian integer.
+// Their line is their position among the records.
+func (p *Processor) processFramed(r io.Reader, source string) error {
+	br := bufio.NewReader(r)
+	rec := Record{Source: source, Line: 1}
+	for ; ; rec.Line++ {
+		n, size, err := readFrameHeader(br, p.Config.Framing)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return p.framingError(rec, err)
+		}
+		if n > maxFrameSize {
+			return p.framingError(rec, fmt.Errorf("length %d is more than the limit of %d", n, maxFrameSize))
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return p.framingError(rec, err)
+		}
+		if err := p.queueItem(string(payload), rec); err != nil {
+			return err
+		}
+		rec.Offset += int64(size) + int64(n)
+	}
+	return p.flushQueue()
+}
+
+// framingError reports a record that could not be read, after processing
+// the ones read before it
+func (p *Processor) framingError(rec Record, err error) error {
+	if err := p.flushQueue(); err != nil {
+		return err
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return &locationError{rec.location(), fmt.Errorf("reading record: %w", err)}
+}
+
+// readFrameHeader reads a record's length prefix, returning the length and
+// the size of the prefix. It returns io.EOF only if the input ends before
+// the prefix starts.
+func readFrameHeader(br *bufio.Reader, framing string) (uint64, int, error) {
+	if framing == framingU32LE {
+		var header [4]byte
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return 0, 0, err
+		}
+		return uint64(binary.LittleEndian.Uint32(header[:])), 4, nil
+	}
+
+	if _, err := br.Peek(1); err != nil {
+		return 0, 0, err
+	}
+	counter := &countingByteReader{r: br}
+	n, err := binary.ReadUvarint(counter)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, counter.n, err
+}
+
+// countingByteReader counts the bytes read through it
+type countingByteReader struct {
+	r *bufio.Reader
+	n int
+}
+
+func (c *countingByteReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// writeFrame writes a record's output preceded by its length, in place of
+// writeRecord's separator
+func (p *Processor) writeFrame(result string) error {
+	out := make([]byte, 0, binary.MaxVarintLen64+len(result))
+	if p.Config.Framing == framingU32LE {
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(result)))
+	} else {
+		out = binary.AppendUvarint(out, uint64(len(result)))
+	}
+	if _, err := p.Output.Write(append(out, result...)); err != nil {
+		return &writeError{err}
+	}
+	p.wrote, p.eol = true, p.record.Newline
+	return nil
+}
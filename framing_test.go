@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// frames builds --framing records
+func frames(framing string, records ...string) []byte {
+	var buf []byte
+	for _, s := range records {
+		if framing == framingU32LE {
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s)))
+		} else {
+			buf = binary.AppendUvarint(buf, uint64(len(s)))
+		}
+		buf = append(buf, s...)
+	}
+	return buf
+}
+
+func TestFraming(t *testing.T) {
+	long := strings.Repeat("x", 300) // needs a two-byte varint
+	for _, framing := range framings {
+		t.Run(framing, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			stdin := bytes.NewReader(frames(framing, "a\nb", "", "nul\x00", long))
+			if exitCode := run([]string{"--framing", framing}, stdin, &stdout, &stderr); exitCode != 0 {
+				t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+			}
+			want := frames(framing, `a\nb`, "", `nul\u0000`, long)
+			if !bytes.Equal(stdout.Bytes(), want) {
+				t.Errorf("output = %q, want %q", stdout.Bytes(), want)
+			}
+
+			// Unescaping the output gives back the records
+			var back bytes.Buffer
+			if exitCode := run([]string{"--framing", framing, "-u"}, bytes.NewReader(stdout.Bytes()), &back, &stderr); exitCode != 0 {
+				t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+			}
+			if want := frames(framing, "a\nb", "", "nul\x00", long); !bytes.Equal(back.Bytes(), want) {
+				t.Errorf("round trip = %q, want %q", back.Bytes(), want)
+			}
+		})
+	}
+}
+
+func TestFramingErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"truncated record", frames(framingVarint, "one", "two")[:6], "-:2: reading record: unexpected EOF"},
+		{"truncated length", append(frames(framingVarint, "one"), 0x80), "-:2: reading record: unexpected EOF"},
+		{"too long", binary.AppendUvarint(nil, maxFrameSize+1), "-:1: reading record: length 67108865 is more than the limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if exitCode := run([]string{"--framing", "varint"}, bytes.NewReader(tt.input), &stdout, &stderr); exitCode != 1 {
+				t.Errorf("exit code = %d, want 1", exitCode)
+			}
+			if !strings.Contains(stderr.String(), tt.want) {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.want)
+			}
+		})
+	}
+
+	// Records before the truncated one are still written
+	var stdout, stderr bytes.Buffer
+	run([]string{"--framing", "u32le"}, bytes.NewReader(frames(framingU32LE, "one", "two")[:9]), &stdout, &stderr)
+	if want := frames(framingU32LE, "one"); !bytes.Equal(stdout.Bytes(), want) {
+		t.Errorf("output = %q, want %q", stdout.Bytes(), want)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/user/jsonescape/pkg/jsonescape"
+)
+
+// shortEscapes maps the character after a backslash to what it stands for
+var shortEscapes = map[byte]rune{
+	'"': '"', '\\': '\\', '/': '/',
+	'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t',
+}
+
+// grepMatch is one occurrence of a --grep-escape target in a record
+type grepMatch struct {
+	col  int    // byte position within the record, from 1
+	text string // the escape sequence or character as it appears
+}
+
+// parseGrepTargets parses the comma-separated --grep-escape list. Each entry
+// is an escape sequence (\u2028, \t), a code point (U+2028) or a single
+// character.
+func parseGrepTargets(value string) (map[rune]bool, error) {
+	targets := make(map[rune]bool)
+	for _, item := range strings.Split(value, ",") {
+		var r rune
+		switch {
+		case item == "":
+			return nil, fmt.Errorf("empty entry in --grep-escape list %q", value)
+		case strings.HasPrefix(item, "U+") || strings.HasPrefix(item, "u+"):
+			n, err := strconv.ParseUint(item[2:], 16, 32)
+			if err != nil || n > utf8.MaxRune {
+				return nil, fmt.Errorf("invalid code point %q in --grep-escape", item)
+			}
+			r = rune(n)
+		case item[0] == '\\':
+			// A lone surrogate escape decodes to U+FFFD, so take it apart
+			// by hand first
+			if len(item) == 6 && item[1] == 'u' {
+				if n, err := parseHexRune(item[2:]); err == nil {
+					r = n
+					break
+				}
+			}
+			s, err := jsonescape.Unescape(item)
+			if err != nil || utf8.RuneCountInString(s) != 1 {
+				return nil, fmt.Errorf("invalid escape %q in --grep-escape (expected a single escape such as \\u2028)", item)
+			}
+			r, _ = utf8.DecodeRuneInString(s)
+		default:
+			if utf8.RuneCountInString(item) != 1 {
+				return nil, fmt.Errorf("invalid entry %q in --grep-escape (expected an escape, U+XXXX or one character)", item)
+			}
+			r, _ = utf8.DecodeRuneInString(item)
+		}
+		targets[r] = true
+	}
+	return targets, nil
+}
+
+// grepEscapes finds the escape sequences in an escaped record that stand for
+// one of the targets, and the targets appearing unescaped
+func grepEscapes(s string, targets map[rune]bool) []grepMatch {
+	var matches []grepMatch
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if s[i] == '\\' && i+1 < len(s) {
+			if short, ok := shortEscapes[s[i+1]]; ok {
+				r, n = short, 2
+			} else if s[i+1] == 'u' && i+6 <= len(s) {
+				if u, err := parseHexRune(s[i+2 : i+6]); err == nil {
+					r, n = u, 6
+					// A surrogate pair is one match for the combined rune
+					if u >= 0xD800 && u <= 0xDBFF && i+12 <= len(s) && s[i+6:i+8] == `\u` {
+						if lo, err := parseHexRune(s[i+8 : i+12]); err == nil && lo >= 0xDC00 && lo <= 0xDFFF {
+							r, n = 0x10000+(u-0xD800)*0x400+(lo-0xDC00), 12
+						}
+					}
+				}
+			}
+		}
+		if targets[r] {
+			matches = append(matches, grepMatch{i + 1, s[i : i+n]})
+		}
+		i += n
+	}
+	return matches
+}
+
+// grepRecord prints a record containing --grep-escape targets, with where
+// they are
+func (p *Processor) grepRecord(s string, rec Record) error {
+	matches := grepEscapes(s, p.Config.GrepEscape)
+	if len(matches) == 0 {
+		return nil
+	}
+	found := make([]string, len(matches))
+	for i, m := range matches {
+		found[i] = fmt.Sprintf("%d %s", m.col, m.text)
+	}
+	_, err := fmt.Fprintf(p.Output, "%s: %s: %s\n", rec.location(), strings.Join(found, ", "), s)
+	return err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGrepTargets(t *testing.T) {
+	targets, err := parseGrepTargets("\u2028,U+0000,\\t,é,\\uD800")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[rune]bool{0x2028: true, 0: true, '\t': true, 'é': true, 0xD800: true}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("targets = %v, want %v", targets, want)
+	}
+
+	for _, bad := range []string{"", "a,,b", "ab", `\x`, `\u12`, "U+zz", "U+110000"} {
+		if _, err := parseGrepTargets(bad); err == nil {
+			t.Errorf("parseGrepTargets(%q) expected error, got nil", bad)
+		}
+	}
+}
+
+func TestGrepEscapes(t *testing.T) {
+	targets := map[rune]bool{0x2028: true, '\n': true, 0x1F600: true, 0xD800: true}
+	got := grepEscapes("a\\u2028b\\\\n\\n\\ud83d\\ude00\\ud800x\u2028", targets)
+	want := []grepMatch{
+		{2, `\u2028`},
+		{12, `\n`},
+		{14, `\ud83d\ude00`},
+		{26, `\ud800`},
+		{33, "\u2028"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("grepEscapes = %q, want %q", got, want)
+	}
+}
+
+func TestGrepEscapeRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader("clean\nbroken\\u2028line\n")
+	exitCode := run([]string{"-l", "--grep-escape", "U+2028"}, stdin, &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	if expected := "-:2: 7 \\u2028: broken\\u2028line\n"; stdout.String() != expected {
+		t.Errorf("stdout = %q, want %q", stdout.String(), expected)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// grepOptions holds the arguments of the grep subcommand
+type grepOptions struct {
+	Fields      []fieldPath // strings to search (nil = every string value)
+	Pattern     *regexp.Regexp
+	Invert      bool // select lines with no matching string
+	Count       bool // print the number of selected lines instead
+	LineNumbers bool
+	Files       []string // "-" or none for stdin
+}
+
+const grepUsage = "Usage: %s grep [--field PATH]... [-i] [-v] [-c] [-n] PATTERN [FILE...]\n"
+
+// grepCommand implements the grep subcommand, which searches NDJSON for
+// lines whose string values, once unescaped, match a regular expression and
+// prints those lines as they are. Like grep(1) it exits 0 when a line was
+// selected, 1 when none was and 2 on trouble.
+func grepCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, err := parseGrepArgs(args)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		fmt.Fprintf(stderr, grepUsage, name)
+		return exitUsageError
+	}
+
+	files := opts.Files
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+	selected, trouble := false, false
+	for _, path := range files {
+		var r io.Reader = stdin
+		if path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+				trouble = true
+				continue
+			}
+			r = f
+			defer f.Close()
+		}
+
+		prefix := ""
+		if len(files) > 1 {
+			prefix = path + ":"
+		}
+		n, err := grepLines(r, path, opts, prefix, w, stderr)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s: %v\n", path, err)
+			trouble = true
+		}
+		if opts.Count {
+			fmt.Fprintf(w, "%s%d\n", prefix, n)
+		}
+		selected = selected || n > 0
+	}
+
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(stderr, "Error: writing output: %v\n", err)
+		return exitUsageError
+	}
+	switch {
+	case trouble:
+		return exitUsageError
+	case selected:
+		return exitSuccess
+	}
+	return exitError
+}
+
+// grepLines searches one input, writing the lines it selects (unless only
+// counting them) and returning how many there were. Lines that are not JSON
+// are reported and never selected.
+func grepLines(r io.Reader, path string, opts *grepOptions, prefix string, w io.Writer, stderr io.Writer) (int, error) {
+	br := bufio.NewReader(r)
+	selected := 0
+	for line := 1; ; line++ {
+		text, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return selected, err
+		}
+		body := strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+		if strings.TrimSpace(body) != "" {
+			match, problem := grepMatches(body, opts)
+			if problem != nil {
+				fmt.Fprintf(stderr, "Warning: %s:%d: %v\n", path, line, problem)
+			} else if match != opts.Invert {
+				selected++
+				if !opts.Count {
+					if opts.LineNumbers {
+						fmt.Fprintf(w, "%s%d:%s\n", prefix, line, body)
+					} else {
+						fmt.Fprintf(w, "%s%s\n", prefix, body)
+					}
+				}
+			}
+		}
+		if err == io.EOF {
+			return selected, nil
+		}
+	}
+}
+
+// grepMatches reports whether any string value of the JSON document in
+// line that --field selects matches the pattern
+func grepMatches(line string, opts *grepOptions) (bool, error) {
+	d := json.NewDecoder(strings.NewReader(line))
+	d.UseNumber()
+	var doc any
+	if err := d.Decode(&doc); err != nil {
+		return false, fmt.Errorf("not a valid JSON document: %w", err)
+	}
+	if d.More() {
+		return false, errors.New("not a valid JSON document: more than one value")
+	}
+	return grepValue(doc, nil, opts), nil
+}
+
+// grepValue searches the strings in v, which is found at path
+func grepValue(v any, path []pathStep, opts *grepOptions) bool {
+	switch v := v.(type) {
+	case string:
+		if opts.Fields != nil && !selectedPath(opts.Fields, path) {
+			return false
+		}
+		return opts.Pattern.MatchString(v)
+	case map[string]any:
+		for key, member := range v {
+			if grepValue(member, append(path, pathStep{key: key}), opts) {
+				return true
+			}
+		}
+	case []any:
+		for n, element := range v {
+			if grepValue(element, append(path, pathStep{index: true, n: n}), opts) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectedPath reports whether any of fields selects path
+func selectedPath(fields []fieldPath, path []pathStep) bool {
+	for _, f := range fields {
+		if f.selects(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseGrepArgs(args []string) (*grepOptions, error) {
+	opts := &grepOptions{}
+	ignoreCase := false
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			positional = append(positional, args[i+1:]...)
+			i = len(args)
+		case arg == "-i" || arg == "--ignore-case":
+			ignoreCase = true
+		case arg == "-v" || arg == "--invert-match":
+			opts.Invert = true
+		case arg == "-c" || arg == "--count":
+			opts.Count = true
+		case arg == "-n" || arg == "--line-number":
+			opts.LineNumbers = true
+		case arg == "--field" || strings.HasPrefix(arg, "--field="):
+			value, hasValue := strings.CutPrefix(arg, "--field=")
+			if !hasValue {
+				i++
+				if i >= len(args) {
+					return nil, errors.New("--field requires a value")
+				}
+				value = args[i]
+			}
+			fields, err := parseFields(value)
+			if err != nil {
+				return nil, err
+			}
+			opts.Fields = append(opts.Fields, fields...)
+		case len(arg) > 1 && arg[0] == '-':
+			return nil, fmt.Errorf("unknown option: %s", arg)
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) == 0 {
+		return nil, errors.New("no pattern given")
+	}
+	expr := positional[0]
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+	opts.Pattern = re
+	opts.Files = positional[1:]
+	return opts, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGrepCommand(t *testing.T) {
+	input := `{"level":"info","message":"caf\u00e9 opened"}` + "\n" +
+		`{"level":"warn","message":"plain","user":{"name":"Café"}}` + "\n" +
+		"not json\n\n" +
+		`{"message":"say \"hi\"","tags":["x","quoted \"hi\""]}` + "\n"
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode int
+		expected string
+	}{
+		{"field", []string{"--field", "message", "café"}, 0, `{"level":"info","message":"caf\u00e9 opened"}` + "\n"},
+		{"any string", []string{"-n", "-i", "CAFÉ"}, 0, "1:" + `{"level":"info","message":"caf\u00e9 opened"}` + "\n2:" + `{"level":"warn","message":"plain","user":{"name":"Café"}}` + "\n"},
+		{"escaped quote", []string{"--field=tags[*]", `"hi"`}, 0, `{"message":"say \"hi\"","tags":["x","quoted \"hi\""]}` + "\n"},
+		{"count inverted", []string{"-c", "-v", "é"}, 0, "1\n"},
+		{"no match", []string{"--field", "user.name", "nobody"}, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			exitCode := run(append([]string{"grep"}, tt.args...), strings.NewReader(input), &stdout, &stderr)
+			if exitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", exitCode, tt.exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
+			}
+			if !strings.Contains(stderr.String(), "-:3: not a valid JSON document") {
+				t.Errorf("stderr = %q, want the line that isn't JSON reported", stderr.String())
+			}
+		})
+	}
+}
+
+func TestGrepCommandFiles(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.ndjson"), filepath.Join(dir, "b.ndjson")
+	os.WriteFile(a, []byte(`{"m":"tab\there"}`+"\n"), 0o644)
+	os.WriteFile(b, []byte(`{"m":"none"}`+"\n"), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	if exitCode := run([]string{"grep", "-c", "\t", a, b}, strings.NewReader(""), &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	if want := a + ":1\n" + b + ":0\n"; stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+
+	for _, args := range [][]string{{"grep"}, {"grep", "(", a}, {"grep", "--bogus", "x"}, {"grep", "x", filepath.Join(dir, "missing")}} {
+		if exitCode := run(args, strings.NewReader(""), &stdout, &stderr); exitCode != 2 {
+			t.Errorf("%q: exit code = %d, want 2", args, exitCode)
+		}
+	}
+}
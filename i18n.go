@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The message catalogs, one per language besides English
+//
+//go:embed locales/*.txt
+var locales embed.FS
+
+// languages lists the values --lang accepts
+var languages = []string{"en", "de", "es", "fr"}
+
+// messageLanguage picks the language for messages: --lang if given, else
+// the locale from the environment, else English. Arguments are scanned before
+// they are parsed so that errors parsing them are translated too.
+func messageLanguage(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if value, ok := strings.CutPrefix(arg, "--lang="); ok {
+			return supportedLanguage(value)
+		}
+		if arg == "--lang" && i+1 < len(args) {
+			return supportedLanguage(args[i+1])
+		}
+	}
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(env); value != "" {
+			return supportedLanguage(value)
+		}
+	}
+	return "en"
+}
+
+// supportedLanguage reduces a locale such as de_AT.UTF-8 to a language with a
+// catalog, or English
+func supportedLanguage(locale string) string {
+	lang, _, _ := strings.Cut(locale, "_")
+	lang, _, _ = strings.Cut(lang, ".")
+	lang = strings.ToLower(lang)
+	if slices.Contains(languages, lang) {
+		return lang
+	}
+	return "en"
+}
+
+// catalog holds the translations for one language: each English message
+// format and the same format in that language. A nil catalog is English.
+type catalog struct {
+	formats map[string]string
+	// Formats ending in their only verb, which also translate errors from
+	// elsewhere that have nothing but their text
+	tails []string
+}
+
+var catalogVerb = regexp.MustCompile(`%[sqdvgw]`)
+
+// loadCatalog reads the catalog for lang, or returns nil for English
+func loadCatalog(lang string) *catalog {
+	data, err := locales.ReadFile("locales/" + lang + ".txt")
+	if err != nil {
+		return nil
+	}
+	c := &catalog{formats: make(map[string]string)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		english, translated, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok || strings.HasPrefix(english, "#") {
+			continue
+		}
+		c.formats[english] = translated
+		if verbs := catalogVerb.FindAllStringIndex(english, -1); len(verbs) == 1 && verbs[0][1] == len(english) && strings.HasSuffix(english, "%s") {
+			c.tails = append(c.tails, english)
+		}
+	}
+	return c
+}
+
+// format returns the translation of an English format, or the format
+// itself if the catalog has none
+func (c *catalog) format(english string) string {
+	if c == nil {
+		return english
+	}
+	if t, ok := c.formats[english]; ok {
+		return t
+	}
+	return english
+}
+
+// sprintf formats a message like fmt.Sprintf, in the catalog's language.
+// Errors among args are translated as by text; other arguments, such as
+// file names, are copied as they are.
+func (c *catalog) sprintf(format string, args ...any) string {
+	if c == nil {
+		return fmt.Sprintf(strings.ReplaceAll(format, "%w", "%v"), args...)
+	}
+	args = slices.Clone(args)
+	for i, arg := range args {
+		if err, ok := arg.(error); ok {
+			args[i] = c.text(err)
+		}
+	}
+	return fmt.Sprintf(strings.ReplaceAll(c.format(format), "%w", "%v"), args...)
+}
+
+// text gives the message of err in the catalog's language, as far as it is
+// made up of messages the catalog has
+func (c *catalog) text(err error) string {
+	if c == nil {
+		return err.Error()
+	}
+	switch e := err.(type) {
+	case *message:
+		return c.sprintf(e.format, e.args...)
+	case *locationError:
+		return e.location + ": " + c.text(e.err)
+	case *fs.PathError:
+		return e.Op + " " + e.Path + ": " + c.text(e.Err)
+	}
+
+	s := err.Error()
+	if t, ok := c.formats[s]; ok {
+		return t
+	}
+	for _, english := range c.tails {
+		if rest, ok := strings.CutPrefix(s, strings.TrimSuffix(english, "%s")); ok {
+			return strings.Replace(c.formats[english], "%s", rest, 1)
+		}
+	}
+	return s
+}
+
+// errorLine writes err to w as an Error: line in the catalog's language
+func (c *catalog) errorLine(w io.Writer, err error) {
+	fmt.Fprintf(w, "%s: %s\n", c.format("Error"), c.text(err))
+}
+
+// message is an error whose format the catalogs may have. Its Error is the
+// English text, which catalog.text gives in another language.
+type message struct {
+	format string
+	args   []any
+	err    error // the English text, and what it wraps
+}
+
+// msgf is fmt.Errorf for a message to be given in the user's language
+func msgf(format string, args ...any) error {
+	return &message{format, args, fmt.Errorf(format, args...)}
+}
+
+func (m *message) Error() string {
+	return m.err.Error()
+}
+
+func (m *message) Unwrap() error {
+	return errors.Unwrap(m.err)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/user/jsonescape/pkg/jsonescape"
+)
+
+// The tests expect English messages whatever locale they run in
+func TestMain(m *testing.M) {
+	os.Setenv("LC_ALL", "C")
+	os.Exit(m.Run())
+}
+
+func TestSupportedLanguage(t *testing.T) {
+	for locale, want := range map[string]string{
+		"de_AT.UTF-8": "de",
+		"fr":          "fr",
+		"ES_es":       "es",
+		"C.UTF-8":     "en",
+		"POSIX":       "en",
+		"ja_JP":       "en",
+	} {
+		if got := supportedLanguage(locale); got != want {
+			t.Errorf("supportedLanguage(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestMessageLanguage(t *testing.T) {
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "fr_FR.UTF-8")
+	t.Setenv("LANG", "de_DE.UTF-8")
+	if got := messageLanguage(nil); got != "fr" {
+		t.Errorf("from environment = %q, want fr", got)
+	}
+	if got := messageLanguage([]string{"--lang", "es"}); got != "es" {
+		t.Errorf("--lang es = %q, want es", got)
+	}
+	if got := messageLanguage([]string{"--", "--lang=es"}); got != "fr" {
+		t.Errorf("--lang after -- = %q, want fr", got)
+	}
+}
+
+func TestCatalogs(t *testing.T) {
+	_, badEscape := jsonescape.Unescape(`\q`)
+	notFound := &fs.PathError{Op: "open", Path: "x", Err: syscall.ENOENT}
+	tests := []struct {
+		lang     string
+		err      error
+		expected string
+	}{
+		{"de", msgf("unknown option: %s", "--bogus"), "Fehler: unbekannte Option: --bogus"},
+		{"es", &locationError{"argument 1", msgf("unescaping: %w", badEscape)}, `Error: argument 1: desescapando: secuencia de escape no válida \q`},
+		{"fr", msgf("cannot open file %q: %w", "x", notFound), `Erreur: impossible d'ouvrir le fichier "x" : open x: aucun fichier ou dossier de ce nom`},
+		{"de", errors.New("something new"), "Fehler: something new"},
+		{"en", msgf("unknown option: %s", "--bogus"), "Error: unknown option: --bogus"},
+		// Names and other text from the user are never translated
+		{"de", msgf("cannot open file %q: %w", "permission denied", notFound), `Fehler: Datei "permission denied" kann nicht geöffnet werden: open x: Datei oder Verzeichnis nicht gefunden`},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		loadCatalog(tt.lang).errorLine(&buf, tt.err)
+		if got := strings.TrimSuffix(buf.String(), "\n"); got != tt.expected {
+			t.Errorf("%s: %v = %q, want %q", tt.lang, tt.err, got, tt.expected)
+		}
+	}
+
+	de := loadCatalog("de")
+	if got := de.sprintf("skipping binary file %q", "a.png"); got != "Binärdatei \"a.png\" wird übersprungen" {
+		t.Errorf("warning = %q", got)
+	}
+	if got := de.format("Input Options:"); got != "Eingabeoptionen:" {
+		t.Errorf("heading = %q", got)
+	}
+
+	// Every catalog must load and have the same entries
+	for _, lang := range languages[1:] {
+		if c := loadCatalog(lang); c == nil || len(c.formats) != len(de.formats) {
+			t.Errorf("catalog %s is missing or incomplete", lang)
+		}
+	}
+	if loadCatalog("en") != nil {
+		t.Error("English should have no catalog")
+	}
+}
+
+func TestLangFlag(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"--lang=de", "--skip-binary", "--force-binary"}, strings.NewReader(""), &stdout, &stderr)
+	if exitCode != 2 {
+		t.Errorf("exit code = %d, want 2", exitCode)
+	}
+	expected := "Fehler: --skip-binary und --force-binary schließen sich gegenseitig aus\n" +
+		"Weitere Informationen erhalten Sie mit 'jsonescape --help'.\n"
+	if stderr.String() != expected {
+		t.Errorf("stderr = %q, want %q", stderr.String(), expected)
+	}
+
+	// Errors parsing the value of an option are translated too
+	stderr.Reset()
+	run([]string{"--lang=de", "--wrap-style"}, strings.NewReader(""), &stdout, &stderr)
+	if want := "Fehler: --wrap-style erfordert einen Wert (backslash, concat)\n"; !strings.HasPrefix(stderr.String(), want) {
+		t.Errorf("stderr = %q, want it to start %q", stderr.String(), want)
+	}
+
+	stdout.Reset()
+	run([]string{"--lang=es", "--help"}, strings.NewReader(""), &stdout, &stderr)
+	if !strings.HasPrefix(stdout.String(), "Uso: jsonescape [OPTIONS]") || !strings.Contains(stdout.String(), "\nOpciones de salida:\n") {
+		t.Errorf("help not translated:\n%s", stdout.String())
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"os"
+)
+
+// ProcessFileInPlace processes a file and replaces its content with the
+// output, in the --output-encoding if one is given, first saving the
+// original under the -i backup suffix if there is one. The file is left
+// alone if any of its records fail, and under --confirm unless the user
+// agrees to the change.
+func (p *Processor) ProcessFileInPlace(path string) error {
+	source := p.sourceName(path)
+	p.beginSource(source)
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return msgf("cannot open file %q: %w", path, err)
+	}
+	if skip, err := p.checkBinary(source, original[:min(len(original), sniffSize)]); skip || err != nil {
+		return err
+	}
+
+	out, failed := p.Output, p.failed
+	var transformed bytes.Buffer
+	p.Output = &transformed
+	enc := newEncodingWriter(&transformed, p.Config.OutputEncoding)
+	if enc != nil {
+		p.Output = enc
+	}
+	err = p.processSource(bytes.NewReader(original), source)
+	if enc != nil && err == nil {
+		err = enc.Close()
+	}
+	p.Output = out
+	if err != nil {
+		return err
+	}
+	if n := p.failed - failed; n > 0 {
+		p.warnf("%q left unchanged as %d of its records failed", path, n)
+		return nil
+	}
+	if p.confirm != nil {
+		return p.confirmRewrite(path, original, transformed.Bytes())
+	}
+	return p.rewriteFile(path, original, transformed.Bytes())
+}
+
+// rewriteFile replaces the content of path with data, first saving its
+// original content under the -i backup suffix if there is one
+func (p *Processor) rewriteFile(path string, original, data []byte) error {
+	if p.Config.BackupSuffix != "" {
+		info, err := os.Stat(path)
+		if err == nil {
+			err = os.WriteFile(path+p.Config.BackupSuffix, original, info.Mode().Perm())
+		}
+		if err != nil {
+			return msgf("saving backup of %q: %w", path, err)
+		}
+	}
+	if err := replaceFile(path, data); err != nil {
+		return msgf("rewriting %q: %w", path, err)
+	}
+	return nil
+}
+
+// replaceFile replaces the content of path in one step, so it holds either
+// the old content or all of the new
+func replaceFile(path string, data []byte) error {
+	a, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer a.discard()
+	if _, err := a.Write(data); err != nil {
+		return err
+	}
+	return a.commit()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInPlace(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	os.WriteFile(a, []byte("say \"hi\"\n"), 0o600)
+	os.WriteFile(b, []byte("tab\there\n"), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	if exitCode := run([]string{"-i.bak", "-l", a, b}, strings.NewReader(""), &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	if stdout.Len() > 0 {
+		t.Errorf("stdout = %q, want nothing", stdout.String())
+	}
+	for path, want := range map[string]string{
+		a:          `say \"hi\"` + "\n",
+		b:          `tab\there` + "\n",
+		a + ".bak": "say \"hi\"\n",
+		b + ".bak": "tab\there\n",
+	} {
+		if got, _ := os.ReadFile(path); string(got) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(path), got, want)
+		}
+	}
+	if info, err := os.Stat(a); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("a.txt mode = %v, want it kept at 0600", info.Mode())
+	}
+
+	// Without a suffix no backup is made
+	if exitCode := run([]string{"--in-place", "-u", "-l", "--file", a}, strings.NewReader(""), &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	if got, _ := os.ReadFile(a); string(got) != "say \"hi\"\n" {
+		t.Errorf("a.txt = %q after unescaping", got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 4 {
+		t.Errorf("%d files in the directory, want 4", len(entries))
+	}
+}
+
+func TestInPlaceOutputEncoding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, []byte("é\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if exitCode := run([]string{"-i", "-l", "--output-encoding", "utf-16le", path}, strings.NewReader(""), &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	if stdout.Len() > 0 {
+		t.Errorf("stdout = %q, want nothing", stdout.String())
+	}
+	want := []byte{0xFF, 0xFE, 0xE9, 0, '\n', 0}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, want) {
+		t.Errorf("file = % x, want % x", got, want)
+	}
+}
+
+func TestInPlaceConfirm(t *testing.T) {
+	dir := t.TempDir()
+	a, b, c := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "c.txt")
+	for path, content := range map[string]string{a: "a\"\n", b: "b\"\n", c: "plain\n"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// One question per changed file; c.txt would not change so is not asked about
+	var stdout, stderr bytes.Buffer
+	if exitCode := run([]string{"-i", "--confirm", "-l", a, b, c}, strings.NewReader("y\nn\n"), &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	for _, want := range []string{"-a\"\n+a\\\"\n", fmt.Sprintf("Rewrite %q? [y/N] ", a)} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("stderr = %q, want it to contain %q", stderr.String(), want)
+		}
+	}
+	if n := strings.Count(stderr.String(), "[y/N]"); n != 2 {
+		t.Errorf("%d questions, want 2", n)
+	}
+	for path, want := range map[string]string{a: "a\\\"\n", b: "b\"\n", c: "plain\n"} {
+		if got, _ := os.ReadFile(path); string(got) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(path), got, want)
+		}
+	}
+
+	// Under =all nothing is written until the one question is answered
+	for _, answer := range []string{"", "yes\n"} {
+		stderr.Reset()
+		if exitCode := run([]string{"-i", "--confirm=all", "-l", b, c}, strings.NewReader(answer), &stdout, &stderr); exitCode != 0 {
+			t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+		}
+		if n := strings.Count(stderr.String(), "[y/N]"); n != 1 {
+			t.Errorf("%d questions, want 1", n)
+		}
+		want := "b\"\n"
+		if answer != "" {
+			want = "b\\\"\n"
+		}
+		if got, _ := os.ReadFile(b); string(got) != want {
+			t.Errorf("answering %q: b.txt = %q, want %q", answer, got, want)
+		}
+	}
+	if stdout.Len() > 0 {
+		t.Errorf("stdout = %q, want nothing", stdout.String())
+	}
+}
+
+func TestInPlaceFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.txt")
+	os.WriteFile(path, []byte("ok\nbad \\q\n"), 0o644)
+
+	for _, args := range [][]string{
+		{"-i", "-u", "-l", path},
+		{"-i", "-u", "-l", "--keep-going", path},
+	} {
+		var stdout, stderr bytes.Buffer
+		if exitCode := run(args, strings.NewReader(""), &stdout, &stderr); exitCode != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, exitCode)
+		}
+		if got, _ := os.ReadFile(path); string(got) != "ok\nbad \\q\n" {
+			t.Errorf("%v: file = %q, want it unchanged", args, got)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Records queued per worker before --jobs hands them out
+const jobsBatchPerWorker = 256
+
+// aheadResult is a record's transformation, worked out by a --jobs worker
+// before the record's turn comes
+type aheadResult struct {
+	in          string
+	out         string
+	nonstandard bool
+	err         error
+}
+
+// itemQueue holds the records of --lines or --null input waiting for
+// --jobs workers
+type itemQueue struct {
+	items   []string
+	recs    []Record
+	results []aheadResult
+}
+
+// queueItem processes a record of --lines or --null input. Under --jobs it
+// is queued instead, and processed with a batch of others once the batch
+// is full.
+func (p *Processor) queueItem(s string, rec Record) error {
+	if p.Config.Jobs <= 1 {
+		return p.processItem(s, rec)
+	}
+	q := &p.queue
+	q.items = append(q.items, s)
+	q.recs = append(q.recs, rec)
+	if len(q.items) < p.Config.Jobs*jobsBatchPerWorker {
+		return nil
+	}
+	return p.flushQueue()
+}
+
+// flushQueue transforms the queued records on --jobs workers, then
+// processes them in input order as usual, with each transformation already
+// done. Everything but the transformation happens one record at a time, so
+// the output is the same as without --jobs.
+func (p *Processor) flushQueue() error {
+	q := &p.queue
+	n := len(q.items)
+	if n == 0 {
+		return nil
+	}
+	defer func() {
+		q.items, q.recs = q.items[:0], q.recs[:0]
+		p.ahead = nil
+	}()
+
+	if cap(q.results) < n {
+		q.results = make([]aheadResult, n)
+	}
+	q.results = q.results[:n]
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < min(p.Config.Jobs, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1)) - 1; i < n; i = int(next.Add(1)) - 1 {
+				out, nonstandard, err := p.convertRecord(q.items[i])
+				q.results[i] = aheadResult{q.items[i], out, nonstandard, err}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, s := range q.items {
+		p.ahead = &q.results[i]
+		if err := p.processItem(s, q.recs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseJobs parses a --jobs value: a number of workers, or 0 for one per CPU
+func parseJobs(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, msgf("invalid %s value %q (expected a number of workers, or 0 for one per CPU)", "--jobs", value)
+	}
+	if n == 0 {
+		n = runtime.NumCPU()
+	}
+	return n, nil
+}
+
+// processFiles processes the --file inputs. Under --jobs, several are
+// processed at a time, each into a buffer of its own. A file's output and
+// messages are written together once it is done: in the order the files
+// were given, or in the order they finish with --unordered.
+func (p *Processor) processFiles(paths []string) error {
+	if p.Config.Jobs <= 1 || len(paths) < 2 {
+		for _, path := range paths {
+			var err error
+			switch {
+			case p.Config.DiffOutput:
+				err = p.ProcessFileDiff(path)
+			case p.Config.InPlace:
+				err = p.ProcessFileInPlace(path)
+			default:
+				err = p.ProcessFile(path)
+			}
+			p.endSource(err)
+			if err := p.fail(err); err != nil {
+				return err
+			}
+		}
+		return p.finishConfirm()
+	}
+
+	results := make([]*fileResult, len(paths))
+	for i := range paths {
+		results[i] = p.fileProcessor(p.inputs + i)
+	}
+	p.inputs += len(paths)
+
+	// Files are handed out in order, so in-order output can start early
+	next := make(chan int)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(next)
+		for i := range paths {
+			select {
+			case next <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	done := make(chan int, len(paths))
+	for w := 0; w < min(p.Config.Jobs, len(paths)); w++ {
+		go func() {
+			for i := range next {
+				r := results[i]
+				switch {
+				case p.Config.DiffOutput:
+					r.err = r.p.ProcessFileDiff(paths[i])
+				case p.Config.InPlace:
+					r.err = r.p.ProcessFileInPlace(paths[i])
+				default:
+					r.err = r.p.ProcessFile(paths[i])
+				}
+				r.p.endSource(r.err)
+				done <- i
+			}
+		}()
+	}
+
+	finished := make([]bool, len(paths))
+	for written := 0; written < len(paths); {
+		i := <-done
+		if p.Config.Unordered {
+			if err := p.mergeFile(results[i]); err != nil {
+				return err
+			}
+			written++
+			continue
+		}
+		finished[i] = true
+		for ; written < len(paths) && finished[written]; written++ {
+			if err := p.mergeFile(results[written]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fileResult is a file processed on its own under --jobs
+type fileResult struct {
+	p   *Processor
+	out bytes.Buffer
+	log bytes.Buffer
+	err error
+}
+
+// fileProcessor returns a fileResult whose processor is set up like p, but
+// writes output and messages to buffers of its own. input is the file's
+// position among the inputs, which picks its --label.
+func (p *Processor) fileProcessor(input int) *fileResult {
+	r := &fileResult{}
+	r.p = &Processor{
+		Config:  p.Config,
+		Output:  &r.out,
+		Stderr:  &r.log,
+		msgs:    p.msgs,
+		inputs:  input,
+		mapper:  p.mapper,
+		sniffed: p.sniffed || input > p.inputs,
+	}
+	if p.errors != nil {
+		r.p.errors = &errorSummary{}
+	}
+	if p.cache != nil {
+		r.p.cache = newEscapeCache(p.Config.CacheSize)
+	}
+	return r
+}
+
+// mergeFile writes out what a file processed on its own produced and adds
+// its counts and reports to p's
+func (p *Processor) mergeFile(r *fileResult) error {
+	if _, err := p.Output.Write(r.out.Bytes()); err != nil {
+		return &writeError{err}
+	}
+	p.Stderr.Write(r.log.Bytes())
+
+	c := r.p
+	p.count += c.count
+	p.failed += c.failed
+	p.warned += c.warned
+	p.reports = append(p.reports, c.reports...)
+	p.sniffed = p.sniffed || c.sniffed
+	if p.errors != nil {
+		p.errors.merge(c.errors)
+	}
+	return p.fail(r.err)
+}
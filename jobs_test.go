@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJobsMatchesSequential(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 3*jobsBatchPerWorker+7; i++ {
+		fmt.Fprintf(&b, "line %d \"q\"\tcafé \\u00e9", i)
+		if i%100 == 50 {
+			b.WriteString(" \\q") // an invalid escape for -u
+		}
+		b.WriteString("\n")
+	}
+	input := b.String()
+
+	for _, flags := range [][]string{
+		{"-l"},
+		{"-l", "--ascii", "--cache"},
+		{"-l", "-u", "--keep-going", "--report", "text"},
+		{"-l", "-u"},
+		{"-0"},
+	} {
+		var want, got, wantErr, gotErr bytes.Buffer
+		wantCode := run(append(flags, "--stdin"), strings.NewReader(input), &want, &wantErr)
+		gotCode := run(append(flags, "--stdin", "-j", "3"), strings.NewReader(input), &got, &gotErr)
+		if gotCode != wantCode || got.String() != want.String() {
+			t.Errorf("%v -j 3 = %d, %d bytes, want %d, %d bytes", flags, gotCode, got.Len(), wantCode, want.Len())
+		}
+		if stripTimes(gotErr.String()) != stripTimes(wantErr.String()) {
+			t.Errorf("%v -j 3 stderr = %q, want %q", flags, gotErr.String(), wantErr.String())
+		}
+	}
+}
+
+// stripTimes drops the durations from a --report table
+func stripTimes(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if f := strings.Fields(line); len(f) > 0 {
+			lines = append(lines, strings.Join(f[:len(f)-1], " "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestJobsFiles(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 12; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("f%02d.txt", i))
+		content := strings.Repeat(fmt.Sprintf("file %d \"line\"\n", i), 50*(12-i))
+		if i == 5 {
+			content += "bad \\q\n"
+		}
+		os.WriteFile(path, []byte(content), 0o644)
+		paths = append(paths, path)
+	}
+
+	for _, flags := range [][]string{
+		{"-u", "--keep-going", "--report", "text"},
+		{"-u", "--keep-going", "--error-summary", "--cache"},
+		{"-l", "-u", "--keep-going"},
+		{"-u"},
+		{"--diff-output"},
+	} {
+		args := append(flags, "--args-are-files")
+		args = append(args, paths...)
+		var want, got, wantErr, gotErr bytes.Buffer
+		wantCode := run(args, strings.NewReader(""), &want, &wantErr)
+		gotCode := run(append(args, "-j", "4"), strings.NewReader(""), &got, &gotErr)
+		if gotCode != wantCode || got.String() != want.String() {
+			t.Errorf("%v -j 4 = %d, %d bytes, want %d, %d bytes", flags, gotCode, got.Len(), wantCode, want.Len())
+		}
+		if stripTimes(gotErr.String()) != stripTimes(wantErr.String()) {
+			t.Errorf("%v -j 4 stderr = %q, want %q", flags, gotErr.String(), wantErr.String())
+		}
+	}
+
+	// Out of order, each file's output still comes out in one piece
+	var stdout, stderr bytes.Buffer
+	args := append([]string{"-l", "--unordered", "-j", "4", "--args-are-files"}, paths...)
+	if exitCode := run(args, strings.NewReader(""), &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("--unordered exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	seen := map[string]bool{}
+	last := ""
+	for _, line := range strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n") {
+		if !strings.HasPrefix(line, "file ") {
+			continue
+		}
+		file := strings.Fields(line)[1]
+		if file != last && seen[file] {
+			t.Fatalf("output of file %s is split up", file)
+		}
+		seen[file], last = true, file
+	}
+	if len(seen) != len(paths) {
+		t.Errorf("output covers %d files, want %d", len(seen), len(paths))
+	}
+}
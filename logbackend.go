@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Backends for --log-backend
+const (
+	logStderr   = "stderr"
+	logSyslog   = "syslog"
+	logJournald = "journald"
+	logFile     = "file"
+)
+
+// Syslog severities, which journald uses too
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityInfo    = 6
+)
+
+// Where journald takes native protocol messages
+const journaldSocket = "/run/systemd/journal/socket"
+
+// logSink delivers one diagnostic message to a logging backend
+type logSink interface {
+	send(severity int, msg string) error
+	Close() error
+}
+
+// parseLogBackend checks a --log-backend value: stderr, syslog, journald or
+// file:<PATH>
+func parseLogBackend(value string) error {
+	kind, path, _ := strings.Cut(value, ":")
+	switch kind {
+	case logStderr, logSyslog, logJournald:
+		if path != "" {
+			return fmt.Errorf("--log-backend=%s does not take an argument", kind)
+		}
+	case logFile:
+		if path == "" {
+			return errors.New("--log-backend=file requires a path, e.g. file:/var/log/jsonescape.log")
+		}
+	default:
+		return fmt.Errorf("invalid --log-backend value %q (expected stderr, syslog, journald, file:<PATH>)", value)
+	}
+	return nil
+}
+
+// openLogBackend returns a writer sending what is written to it, line by
+// line, to the backend, or w itself for stderr
+func openLogBackend(value string, w io.Writer) (io.WriteCloser, error) {
+	kind, path, _ := strings.Cut(value, ":")
+	var sink logSink
+	var err error
+	switch kind {
+	case logSyslog:
+		sink, err = openSyslog()
+	case logJournald:
+		sink, err = openJournald()
+	case logFile:
+		sink, err = openLogFile(path)
+	default:
+		return nopCloser{w}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s log: %w", kind, err)
+	}
+	return &logWriter{sink: sink}, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// logWriter splits diagnostics into lines and sends each as a message,
+// with the severity its Error: or Warning: prefix gives
+type logWriter struct {
+	sink    logSink
+	partial []byte
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := string(l.partial[:i])
+		l.partial = l.partial[i+1:]
+		if err := l.sink.send(lineSeverity(line), line); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// Close sends any unterminated last line and closes the backend
+func (l *logWriter) Close() error {
+	var err error
+	if len(l.partial) > 0 {
+		line := string(l.partial)
+		l.partial = nil
+		err = l.sink.send(lineSeverity(line), line)
+	}
+	if closeErr := l.sink.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func lineSeverity(line string) int {
+	switch {
+	case strings.HasPrefix(line, "Error:"):
+		return severityError
+	case strings.HasPrefix(line, "Warning:"):
+		return severityWarning
+	}
+	return severityInfo
+}
+
+// journald speaks its native protocol over a datagram socket
+type journald struct {
+	conn net.Conn
+}
+
+func openJournald() (logSink, error) {
+	conn, err := net.Dial("unixgram", journaldSocket)
+	if err != nil {
+		return nil, err
+	}
+	return &journald{conn}, nil
+}
+
+func (j *journald) send(severity int, msg string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "PRIORITY=%d\nSYSLOG_IDENTIFIER=%s\n", severity, name)
+	if strings.Contains(msg, "\n") {
+		// Values with newlines are length-prefixed instead
+		buf.WriteString("MESSAGE\n")
+		binary.Write(&buf, binary.LittleEndian, uint64(len(msg)))
+		buf.WriteString(msg + "\n")
+	} else {
+		buf.WriteString("MESSAGE=" + msg + "\n")
+	}
+	_, err := j.conn.Write(buf.Bytes())
+	return err
+}
+
+func (j *journald) Close() error {
+	return j.conn.Close()
+}
+
+// logFileSink appends timestamped lines to a file
+type logFileSink struct {
+	f *os.File
+}
+
+func openLogFile(path string) (logSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &logFileSink{f}, nil
+}
+
+func (l *logFileSink) send(severity int, msg string) error {
+	_, err := fmt.Fprintf(l.f, "%s %s[%d]: %s\n", time.Now().Format(time.RFC3339), name, os.Getpid(), msg)
+	return err
+}
+
+func (l *logFileSink) Close() error {
+	return l.f.Close()
+}
@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package main
+
+import "errors"
+
+func openSyslog() (logSink, error) {
+	return nil, errors.New("not supported on this platform")
+}
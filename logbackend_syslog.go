@@ -0,0 +1,32 @@
+//go:build !(windows || plan9)
+
+package main
+
+import "log/syslog"
+
+// syslogSink sends messages to the local syslog daemon
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func openSyslog() (logSink, error) {
+	w, err := syslog.New(syslog.LOG_USER|syslog.LOG_INFO, name)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w}, nil
+}
+
+func (s *syslogSink) send(severity int, msg string) error {
+	switch severity {
+	case severityError:
+		return s.w.Err(msg)
+	case severityWarning:
+		return s.w.Warning(msg)
+	}
+	return s.w.Info(msg)
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
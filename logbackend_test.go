@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogBackendFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jsonescape.log")
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-u", "-l", "--keep-going", "--report=text", "--log-backend", "file:" + path}
+	exitCode := run(args, strings.NewReader("ok\nbad\\x\n"), &stdout, &stderr)
+	if exitCode != 1 {
+		t.Errorf("exit code = %d, want 1", exitCode)
+	}
+	if stdout.String() != "ok\n" || stderr.Len() != 0 {
+		t.Errorf("stdout = %q, stderr = %q; want only the output", stdout.String(), stderr.String())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("log = %q, want an error and a two-line report", data)
+	}
+	if !strings.Contains(lines[0], "jsonescape[") || !strings.HasSuffix(lines[0], "Error: -:2: unescaping: invalid escape sequence \\x") {
+		t.Errorf("log line = %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "SOURCE") {
+		t.Errorf("log line = %q, want the report header", lines[1])
+	}
+}
+
+type recordingSink struct {
+	messages []string
+	severity []int
+}
+
+func (r *recordingSink) send(severity int, msg string) error {
+	r.messages = append(r.messages, msg)
+	r.severity = append(r.severity, severity)
+	return nil
+}
+
+func (r *recordingSink) Close() error { return nil }
+
+func TestLogWriter(t *testing.T) {
+	sink := &recordingSink{}
+	w := &logWriter{sink: sink}
+	w.Write([]byte("Warning: careful\nError: bro"))
+	w.Write([]byte("ken\nSOURCE  RECORDS"))
+	w.Close()
+
+	want := []string{"Warning: careful", "Error: broken", "SOURCE  RECORDS"}
+	if strings.Join(sink.messages, "|") != strings.Join(want, "|") {
+		t.Errorf("messages = %q, want %q", sink.messages, want)
+	}
+	if sink.severity[0] != severityWarning || sink.severity[1] != severityError || sink.severity[2] != severityInfo {
+		t.Errorf("severities = %v", sink.severity)
+	}
+}
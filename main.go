@@ -4,13 +4,19 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"errors"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 	"unicode/utf8"
+
+	"github.com/user/jsonescape/pkg/jsonescape"
 )
 
 const (
@@ -25,29 +31,111 @@ const (
 	exitUsageError = 2
 )
 
+// Size of the buffer output is collected in unless --unbuffered is given
+const outputBufferSize = 64 * 1024
+
 // Config holds all CLI configuration options
 type Config struct {
 	// Input options
 	InputFiles    []string
+	Labels        []string // names for the --file and stdin inputs, in order
 	ReadStdin     bool
+	ArgsAreFiles  bool   // positional arguments name files to read
+	LiteralArgs   bool   // don't warn about arguments that name files
+	SecretPrompt  bool   // read a value from the terminal without echo
+	Multiline     bool   // read one block from stdin up to a terminator line
+	Terminator    string // the line ending the block
 	NullDelimited bool
+	Delimiter     string // splits the input into records, like -0 but any string
 	LineMode      bool
+	Framing       string // length prefix of each record: varint or u32le
+	Stream        bool   // read files and stdin a chunk at a time
+	FlushBytes    int    // under --stream, read and write out this much at a time
+	Jobs          int    // transform --lines or --null records on this many goroutines
+	Unordered     bool   // under --jobs, write each file's output as soon as it is done
+	StdioServer   bool   // answer length-prefixed requests on stdin
 
 	// Output options
-	Unescape   bool
-	WrapQuotes bool
-	RawOutput  bool
-	OutputFile string
+	Unescape       bool
+	WrapQuotes     bool
+	SmartQuotes    bool   // input that is a quoted JSON string keeps or drops its quotes
+	RecordSep      string // written after each record ("" for --raw)
+	RecordSepSet   bool   // --record-separator was given
+	OutputSep      string // written between records, for --output-separator
+	OutputSepSet   bool   // --output-separator was given
+	FinalNewline   string // how the last record ends ("" = like the others)
+	WithOriginal   bool   // write each input record before its output
+	OriginalSep    string // between the two for --with-original
+	OutputFile     string
+	Tee            bool          // write the --output file's content to stdout as well
+	Append         bool          // add to the end of --output instead of replacing it
+	Atomic         bool          // write --output under a temporary name, renamed at the end
+	InPlace        bool          // rewrite each input file with its output
+	BackupSuffix   string        // keep the original under its name plus this
+	Confirm        bool          // show each file's diff and ask before rewriting it
+	ConfirmAll     bool          // show every diff, then ask once for all files
+	Unbuffered     bool          // write each record out as soon as it is done
+	WrapColumn     int           // wrap escaped output at this column (0 = off)
+	WrapStyle      string        // backslash or concat
+	EmitConcat     string        // language for --emit-concat
+	EmitBytes      string        // language for --emit-bytes
+	Host           string        // quote delimiter of the string the output goes in
+	Heredoc        string        // marker for --heredoc (empty = off)
+	HeredocSet     bool          // marker was given explicitly
+	DiffOutput     bool          // emit a unified diff per file instead of the output
+	OutputEncoding string        // utf-8, utf-8-bom or utf-16le
+	OutputPattern  string        // shard file names, with {shard} for the number
+	ShardRecords   int           // records per shard
+	ShardBytes     int64         // or bytes per shard
+	GrepEscape     map[rune]bool // print records containing these instead
+	PredictLength  bool          // print each record's escaped length instead
+
+	// Document options
+	RewriteStrings      bool               // re-encode every string in a JSON document
+	NDJSONIn            bool               // each input line is a separate document
+	Fields              []fieldPath        // only rewrite strings at these paths (nil = all)
+	AllowComments       bool               // accept // and /* */ comments (JSONC)
+	AllowTrailingCommas bool               // accept a comma before } and ]
+	SortKeys            bool               // write object members in order of their keys
+	DupKeys             string             // what to do about repeated keys: error, first or last
+	Between             *betweenMarkers    // only transform text between these
+	Subst               *regexp.Regexp     // only transform text matching this
+	SubstTemplate       *template.Template // what to replace each --subst match with
 
 	// Encoding options
-	ASCIIOnly  bool
-	HTMLSafe   bool
-	StrictUTF8 bool
+	ASCIIOnly   bool
+	HTMLSafe    bool
+	StrictUTF8  bool
+	StrictHex   bool // reject \U and blanks inside \uXXXX when unescaping
+	Pedantic    bool // every strictness check on, and warnings are errors
 	ReplaceUTF8 bool
+	Controls    string // escape, strip, replace or error
+	ControlRepl string // replacement for --controls=replace:<char>
+	MapFile     string // literal replacements to make in each record
+
+	// Safety options
+	MaxExpansion float64 // abort when output exceeds this multiple of the input size
+	SkipBinary   bool    // skip input files that look binary
+	ForceBinary  bool    // process input files even if they look binary
+	AssumeText   bool    // escape stdin even if it looks binary
+	StateFile    string  // checkpoint progress here for --resume
+	Resume       bool    // continue the run recorded in StateFile
+	KeepGoing    bool    // report failed records and carry on
+	ErrorSummary bool    // group errors by kind at the end instead
+	Report       string  // per-input report format at the end (text or json)
+	PerFileStats bool    // per-input bytes, escapes and invalid UTF-8 at the end
+	TraceFile    string  // log what happened to each record here as NDJSON
+	Timings      bool    // time spent reading, transforming and writing, at the end
+	CacheSize    int     // remember this many recent results (0 = off)
+	Sniff        bool    // describe each input instead of transforming it
 
 	// Meta options
-	ShowHelp       bool
-	ShowVersion    bool
+	NoSIMD             bool   // use the byte-at-a-time scan when escaping
+	UseDaemon          string // socket of a daemon to run in ("" = in process)
+	LogBackend         string // where errors, warnings and reports go
+	Lang               string // language for messages and help
+	ShowHelp           bool
+	ShowVersion        bool
 	GenerateCompletion string
 
 	// Positional args (strings to process)
@@ -58,16 +146,47 @@ func main() {
 	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
 }
 
+// subcommands are run instead of the normal CLI when named by the first
+// argument
+var subcommands = map[string]func(args []string, stdin io.Reader, stdout, stderr io.Writer) int{
+	"check-file":       checkFile,
+	"cmp":              compareEscaped,
+	"daemon":           daemon,
+	"gen-corpus":       genCorpus,
+	"grep":             grepCommand,
+	"normalize-corpus": normalizeCorpus,
+	"selftest":         selftest,
+}
+
 func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		if cmd, ok := subcommands[args[0]]; ok {
+			return cmd(args[1:], stdin, stdout, stderr)
+		}
+	}
+	return runCLI(args, stdin, stdout, stderr)
+}
+
+// runCLI runs the escaping CLI proper, without looking for a subcommand
+func runCLI(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	return runCLILang(messageLanguage(args), args, stdin, stdout, stderr)
+}
+
+// runCLILang is runCLI with messages in lang, as worked out by
+// messageLanguage, which the daemon takes from its client
+func runCLILang(lang string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	// Errors, warnings and help come out in the user's language
+	msgs := loadCatalog(lang)
+
 	config, err := parseArgs(args)
 	if err != nil {
-		fmt.Fprintf(stderr, "Error: %v\n", err)
-		fmt.Fprintf(stderr, "Try '%s --help' for more information.\n", name)
+		msgs.errorLine(stderr, err)
+		fmt.Fprintln(stderr, msgs.sprintf("Try '%s --help' for more information.", name))
 		return exitUsageError
 	}
 
 	if config.ShowHelp {
-		printHelp(stdout)
+		printHelp(stdout, msgs)
 		return exitSuccess
 	}
 
@@ -76,20 +195,112 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 		return exitSuccess
 	}
 
+	// Errors, warnings and reports go to the log backend from here on, in
+	// English so the logs stay searchable
+	if config.LogBackend != "" {
+		logw, err := openLogBackend(config.LogBackend, stderr)
+		if err != nil {
+			msgs.errorLine(stderr, err)
+			return exitError
+		}
+		defer logw.Close()
+		stderr = logw
+		msgs = nil
+	}
+
+	// Without a daemon to answer, run in process just the same. A socket
+	// that belongs to another user is not one to hand stdin and the working
+	// directory to, so it counts as no daemon at all.
+	if config.UseDaemon != "" && ownedByUser(config.UseDaemon) {
+		req, err := newDaemonRequest(args, lang, config, stdin)
+		if err != nil {
+			msgs.errorLine(stderr, err)
+			return exitError
+		}
+		if code, ok := runViaDaemon(config.UseDaemon, req, stdout, stderr); ok {
+			return code
+		}
+		if req.HasStdin {
+			stdin = bytes.NewReader(req.Stdin)
+		}
+	}
+
 	if config.GenerateCompletion != "" {
 		return generateCompletion(config.GenerateCompletion, stdout, stderr)
 	}
 
 	// Determine output writer
 	var output io.Writer = stdout
-	if config.OutputFile != "" {
-		f, err := os.Create(config.OutputFile)
+	var outFile *os.File // closed explicitly so a failed flush to disk is caught
+	var atomic *atomicFile
+	var state *checkpointer
+	var shards *shardWriter
+	var skip int
+	if config.StateFile != "" {
+		f, c, done, err := openCheckpointed(config, args)
+		if err != nil {
+			msgs.errorLine(stderr, err)
+			return exitError
+		}
+		defer f.Close()
+		output, outFile, state, skip = c.n, f, c, done
+	} else if config.Atomic {
+		a, err := createAtomic(config.OutputFile)
+		if err != nil {
+			msgs.errorLine(stderr, msgf("cannot create output file: %v", err))
+			return exitError
+		}
+		defer a.discard()
+		output, atomic = a, a
+	} else if config.OutputFile != "" {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if config.Append {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(config.OutputFile, flags, 0o666)
 		if err != nil {
-			fmt.Fprintf(stderr, "Error: cannot create output file: %v\n", err)
+			msgs.errorLine(stderr, msgf("cannot create output file: %v", err))
 			return exitError
 		}
 		defer f.Close()
-		output = f
+		output, outFile = f, f
+	} else if config.OutputPattern != "" {
+		shards = newShardWriter(config)
+		defer shards.Close()
+		output = shards
+	}
+	var timing *phaseTimer
+	if config.Timings {
+		timing = &phaseTimer{start: time.Now()}
+		output = timedWriter{output, &timing.write}
+	}
+	enc := newEncodingWriter(output, config.OutputEncoding)
+	if enc != nil {
+		defer enc.Close()
+		output = enc
+		// A file being added to or resumed already starts with a byte
+		// order mark
+		if outFile != nil {
+			if info, err := outFile.Stat(); err == nil && info.Size() > 0 {
+				enc.started = true
+			}
+		}
+	}
+	if config.Tee {
+		output = io.MultiWriter(output, stdout)
+	}
+	// A write per record is slow for millions of them. A terminal is being
+	// watched, so it sees each record at once; shards buffer each file
+	// themselves so no record lands in the wrong one.
+	watched := (output == stdout || config.Tee) && isTerminalWriter(stdout)
+	var buffered *bufio.Writer
+	if !config.Unbuffered && config.FlushBytes == 0 && shards == nil && !watched {
+		buffered = bufio.NewWriterSize(output, outputBufferSize)
+		defer buffered.Flush()
+		output = buffered
+		if state != nil {
+			state.flush = buffered.Flush
+		}
 	}
 
 	// Create the processor
@@ -97,6 +308,71 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 		Config: config,
 		Output: output,
 		Stderr: stderr,
+		msgs:   msgs,
+		skip:   skip,
+		state:  state,
+		shards: shards,
+		timing: timing,
+	}
+	if config.ErrorSummary {
+		proc.errors = &errorSummary{}
+	}
+	if config.Confirm {
+		// Under -i stdin holds no input, so it holds the answers
+		proc.confirm = &confirmer{
+			answers: bufio.NewReader(stdin),
+			prompt:  stderr,
+			color:   isTerminalWriter(stderr) && os.Getenv("NO_COLOR") == "",
+			all:     config.ConfirmAll,
+		}
+	}
+	if config.CacheSize > 0 {
+		proc.cache = newEscapeCache(config.CacheSize)
+	}
+	if config.MapFile != "" {
+		mapper, err := loadMapFile(config.MapFile)
+		if err != nil {
+			msgs.errorLine(stderr, err)
+			return exitError
+		}
+		proc.mapper = mapper
+	}
+	if config.TraceFile != "" {
+		t, err := openTrace(config.TraceFile)
+		if err != nil {
+			msgs.errorLine(stderr, err)
+			return exitError
+		}
+		defer t.Close()
+		proc.tracer = t
+	}
+	if config.Report != "" {
+		defer proc.writeReport(stderr)
+	}
+	if config.PerFileStats {
+		defer proc.writeStats(stderr)
+	}
+	if config.Timings {
+		defer proc.writeTimings(stderr)
+	}
+
+	// On failure, checkpoint the records that did make it out so a resumed
+	// run starts right after them
+	completed := false
+	if state != nil {
+		defer func() {
+			if !completed {
+				state.save(proc.count)
+			}
+		}()
+	}
+
+	if config.StdioServer {
+		if err := proc.serveStdio(stdin, stdout); err != nil {
+			msgs.errorLine(stderr, err)
+			return exitError
+		}
+		return exitSuccess
 	}
 
 	// Determine input sources and process
@@ -105,25 +381,55 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 	// Process positional arguments first
 	for _, arg := range config.Args {
 		hasInput = true
-		if err := proc.ProcessString(arg); err != nil {
-			fmt.Fprintf(stderr, "Error: %v\n", err)
+		err := proc.ProcessString(arg)
+		proc.endSource(err)
+		if err := proc.fail(err); err != nil {
+			msgs.errorLine(stderr, err)
 			return exitError
 		}
 	}
 
 	// Process input files
-	for _, path := range config.InputFiles {
+	if len(config.InputFiles) > 0 {
 		hasInput = true
-		if err := proc.ProcessFile(path); err != nil {
-			fmt.Fprintf(stderr, "Error: %v\n", err)
+		if err := proc.processFiles(config.InputFiles); err != nil {
+			msgs.errorLine(stderr, err)
+			return exitError
+		}
+	}
+
+	// Read a secret from the terminal
+	if config.SecretPrompt {
+		hasInput = true
+		secret, err := readSecret()
+		if err == nil {
+			err = proc.processItem(secret, Record{Source: "secret prompt"})
+		}
+		if err := proc.fail(err); err != nil {
+			msgs.errorLine(stderr, err)
+			return exitError
+		}
+	}
+
+	// Read a block of lines typed at the prompt
+	if config.Multiline {
+		hasInput = true
+		block, err := readMultiline(stdin, stderr, config.Terminator)
+		if err == nil {
+			err = proc.processItem(block, Record{Source: "prompt"})
+		}
+		if err := proc.fail(err); err != nil {
+			msgs.errorLine(stderr, err)
 			return exitError
 		}
 	}
 
 	// Process stdin if explicitly requested or if no other input and stdin is piped
 	if config.ReadStdin || (!hasInput && !isTerminal(stdin)) {
-		if err := proc.ProcessReader(stdin); err != nil {
-			fmt.Fprintf(stderr, "Error: %v\n", err)
+		err := proc.ProcessReader(stdin)
+		proc.endSource(err)
+		if err := proc.fail(err); err != nil {
+			msgs.errorLine(stderr, err)
 			return exitError
 		}
 		hasInput = true
@@ -131,11 +437,68 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 
 	// No input provided
 	if !hasInput {
-		fmt.Fprintf(stderr, "Error: no input provided\n")
-		fmt.Fprintf(stderr, "Try '%s --help' for more information.\n", name)
+		msgs.errorLine(stderr, msgf("no input provided"))
+		fmt.Fprintln(stderr, msgs.sprintf("Try '%s --help' for more information.", name))
 		return exitUsageError
 	}
 
+	if err := proc.writeFinalNewline(); err != nil {
+		msgs.errorLine(stderr, err)
+		return exitError
+	}
+	if buffered != nil {
+		if err := buffered.Flush(); err != nil {
+			msgs.errorLine(stderr, &writeError{err})
+			return exitError
+		}
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			msgs.errorLine(stderr, &writeError{err})
+			return exitError
+		}
+	}
+	if outFile != nil {
+		if err := outFile.Close(); err != nil {
+			msgs.errorLine(stderr, &writeError{err})
+			return exitError
+		}
+	}
+	if atomic != nil {
+		if err := atomic.commit(); err != nil {
+			msgs.errorLine(stderr, &writeError{err})
+			return exitError
+		}
+	}
+
+	completed = true
+	if proc.tracer != nil {
+		if err := proc.tracer.Close(); err != nil {
+			msgs.errorLine(stderr, fmt.Errorf("writing trace: %w", err))
+			return exitError
+		}
+	}
+	if shards != nil {
+		if err := shards.Close(); err != nil {
+			msgs.errorLine(stderr, err)
+			return exitError
+		}
+	}
+	if state != nil {
+		if err := state.finish(proc.skip); err != nil {
+			msgs.errorLine(stderr, err)
+			return exitError
+		}
+	}
+	if proc.failed > 0 {
+		if proc.errors != nil {
+			proc.errors.write(stderr, proc.failed)
+		}
+		return exitError
+	}
+	if proc.warned > 0 {
+		return exitError
+	}
 	return exitSuccess
 }
 
@@ -144,85 +507,451 @@ type Processor struct {
 	Config *Config
 	Output io.Writer
 	Stderr io.Writer
-	count  int // number of items processed
+	msgs   *catalog
+	count  int    // number of items processed
+	args   int    // number of positional arguments seen
+	inputs int    // number of --file and stdin inputs begun
+	record Record // the record currently being processed
+	skip   int    // records already written by an interrupted run
+	state  *checkpointer
+	shards *shardWriter  // splits output for --shard-size
+	tracer *tracer       // logs each record for --trace
+	timing *phaseTimer   // adds up time by phase for --timings
+	joined bool          // warned that records run together
+	held   string        // separator held back for --final-newline
+	wrote  bool          // a record has been written
+	eol    bool          // the last one written ended with a line ending
+	laxHex bool          // warned about a non-standard escape
+	warned int           // warnings counted as errors under --pedantic
+	failed int           // errors skipped over under --keep-going
+	errors *errorSummary // collects them for --error-summary
+	cache  *escapeCache  // recent results for --cache
+
+	source  *sourceReport     // --report entry for the current input
+	reports []*sourceReport   // all --report entries so far
+	sniffed bool              // a --sniff report has been written
+	mapper  *strings.Replacer // applies --map-file
+	queue   itemQueue         // records waiting for --jobs workers
+	ahead   *aheadResult      // the current one's, worked out by a worker
+	confirm *confirmer        // asks before -i rewrites a file, for --confirm
+}
+
+// Record describes where a record came from and what happened to it
+type Record struct {
+	Index   int    // position among all records processed, from 0
+	Source  string // file path, "-" for stdin or "argument N"
+	Line    int    // line the record starts on, from 1 (0 for arguments)
+	Offset  int64  // byte offset of the record within its source
+	Changed bool   // whether the transformed value differs from the input
+	Newline bool   // whether the input ended with a line ending (or delimiter)
+}
+
+// location formats the record position for error messages
+func (r Record) location() string {
+	if r.Line == 0 {
+		return r.Source
+	}
+	return fmt.Sprintf("%s:%d", r.Source, r.Line)
 }
 
 // ProcessString processes a single string argument
 func (p *Processor) ProcessString(s string) error {
-	return p.processItem(s)
+	p.args++
+	source := fmt.Sprintf("argument %d", p.args)
+	p.beginSource(source)
+	if !p.Config.LiteralArgs && isFile(s) {
+		p.warnf("%s %q is the name of an existing file; its name is processed, not its content (use --file to read it, or --literal-args to silence this)", source, s)
+	}
+	if p.Config.Sniff {
+		return p.sniffReport(strings.NewReader(s), source)
+	}
+	if p.Config.RewriteStrings {
+		return p.processDocument(strings.NewReader(s), source)
+	}
+	if p.Config.Between != nil {
+		return p.processBetween(strings.NewReader(s), source)
+	}
+	if p.Config.Subst != nil {
+		return p.processSubst(strings.NewReader(s), source)
+	}
+	return p.processItem(s, Record{Source: source})
 }
 
 // ProcessFile processes input from a file
 func (p *Processor) ProcessFile(path string) error {
+	source := p.sourceName(path)
+	p.beginSource(source)
 	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("cannot open file %q: %w", path, err)
+		return msgf("cannot open file %q: %w", path, err)
 	}
 	defer f.Close()
-	return p.ProcessReader(f)
+
+	r := bufio.NewReaderSize(p.timedInput(f), sniffSize)
+	sample, err := r.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return fmt.Errorf("reading %q: %w", path, err)
+	}
+	// --sniff reports binary files rather than refusing them
+	if p.Config.Sniff {
+		return p.sniffReport(r, source)
+	}
+	// Length-prefixed records are binary by nature
+	if p.Config.Framing != "" {
+		return p.processSource(r, source)
+	}
+	if skip, err := p.checkBinary(source, sample); skip || err != nil {
+		return err
+	}
+	return p.processSource(r, source)
+}
+
+// sourceName returns the name records from the next --file or stdin input
+// go by: its --label if one is left, or else name
+func (p *Processor) sourceName(name string) string {
+	if p.inputs < len(p.Config.Labels) {
+		name = p.Config.Labels[p.inputs]
+	}
+	p.inputs++
+	return name
+}
+
+// isFile reports whether path names an existing regular file
+func isFile(path string) bool {
+	if path == "" || strings.ContainsAny(path, "\n\x00") {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// checkBinary applies the --skip-binary/--force-binary policy to a file
+// whose content starts with sample, reporting whether to skip it
+func (p *Processor) checkBinary(path string, sample []byte) (bool, error) {
+	if p.Config.ForceBinary || !looksBinary(sample, p.nulDelimited()) {
+		return false, nil
+	}
+	if p.Config.SkipBinary {
+		p.warnf("skipping binary file %q", path)
+		return true, nil
+	}
+	return false, msgf("%q looks like a binary file (use --skip-binary to skip it or --force-binary to process it)", path)
+}
+
+// warnf reports a non-fatal problem on stderr
+func (p *Processor) warnf(format string, args ...any) {
+	if p.Config.Pedantic {
+		p.warned++
+		fmt.Fprintf(p.Stderr, "%s: %s (--pedantic)\n", p.msgs.format("Error"), p.msgs.sprintf(format, args...))
+		return
+	}
+	fmt.Fprintf(p.Stderr, "%s: %s\n", p.msgs.format("Warning"), p.msgs.sprintf(format, args...))
 }
 
 // ProcessReader processes input from a reader
 func (p *Processor) ProcessReader(r io.Reader) error {
+	source := p.sourceName("-")
+	p.beginSource(source)
+	r = p.timedInput(r)
+	if !p.Config.Unescape && !p.Config.RewriteStrings && !p.Config.AssumeText && !p.Config.ForceBinary && !p.Config.Sniff && p.Config.Framing == "" {
+		sample, rest, err := sniffStream(r)
+		if err != nil {
+			return msgf("reading input: %w", err)
+		}
+		if looksBinary(sample, p.nulDelimited()) {
+			if p.Config.SkipBinary {
+				p.warnf("skipping binary data on stdin")
+				return nil
+			}
+			// Escaping it would flood the terminal with \u0000 and the like
+			return msgf("stdin looks like binary data (use --assume-text to escape it anyway)")
+		}
+		r = rest
+	}
+	return p.processSource(r, source)
+}
+
+// processSource processes input from a reader, attributing records to source
+func (p *Processor) processSource(r io.Reader, source string) error {
+	if p.Config.Sniff {
+		return p.sniffReport(r, source)
+	}
+	if p.Config.RewriteStrings {
+		if p.Config.NDJSONIn {
+			return p.processNDJSON(r, source)
+		}
+		return p.processDocument(r, source)
+	}
+	if p.Config.Between != nil {
+		return p.processBetween(r, source)
+	}
+	if p.Config.Subst != nil {
+		return p.processSubst(r, source)
+	}
+	if p.Config.Framing != "" {
+		return p.processFramed(r, source)
+	}
 	if p.Config.NullDelimited {
-		return p.processNullDelimited(r)
+		return p.processRecords(r, source, jsonescape.NUL)
+	}
+	if p.Config.Delimiter != "" {
+		return p.processRecords(r, source, jsonescape.Framing{Delimiter: p.Config.Delimiter})
 	}
 	if p.Config.LineMode {
-		return p.processLines(r)
+		return p.processRecords(r, source, jsonescape.Lines)
+	}
+	if p.Config.Stream {
+		return p.processStream(r, source)
 	}
 	// Default: read entire input as one string
 	data, err := io.ReadAll(r)
 	if err != nil {
-		return fmt.Errorf("reading input: %w", err)
+		return msgf("reading input: %w", err)
 	}
 	// Trim trailing newline for convenience (common when piping)
 	s := string(data)
+	newline := strings.HasSuffix(s, "\n")
 	s = strings.TrimSuffix(s, "\n")
 	s = strings.TrimSuffix(s, "\r")
-	return p.processItem(s)
+	return p.processItem(s, Record{Source: source, Line: 1, Newline: newline})
 }
 
-func (p *Processor) processLines(r io.Reader) error {
-	scanner := bufio.NewScanner(r)
-	// Use a larger buffer for long lines
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 10*1024*1024) // 10MB max line size
+// processRecords processes the records of r as framing splits them: lines
+// for -l, or delimited for -0 and --delimiter
+func (p *Processor) processRecords(r io.Reader, source string, framing jsonescape.Framing) error {
+	var failed error
+	err := jsonescape.ProcessReaderFunc(r, framing, func(rec jsonescape.Record) error {
+		failed = p.queueItem(rec.Text, Record{Source: source, Line: rec.Line, Offset: rec.Offset, Newline: rec.Newline})
+		return failed
+	})
+	if err != nil && err == failed {
+		return err
+	}
+	// Records read before a failure to read still get written
+	if err := p.flushQueue(); err != nil {
+		return err
+	}
+	if err != nil {
+		return msgf("reading input: %w", err)
+	}
+	return nil
+}
 
-	for scanner.Scan() {
-		if err := p.processItem(scanner.Text()); err != nil {
-			return err
+// nulDelimited reports whether NULs in the input separate records, and so
+// don't make it look binary
+func (p *Processor) nulDelimited() bool {
+	return p.Config.NullDelimited || strings.Contains(p.Config.Delimiter, "\x00")
+}
+
+// processItem runs one record through the transformation and writes it out,
+// prefixing any error with the record's location
+func (p *Processor) processItem(s string, rec Record) error {
+	start := time.Now()
+	rec.Index = p.count
+	p.record = rec
+	if p.state != nil {
+		p.state.input(p.count, s)
+	}
+	if p.skip > 0 {
+		return p.skipRecord(rec, start)
+	}
+
+	if p.Config.GrepEscape != nil {
+		if err := p.grepRecord(s, rec); err != nil {
+			return &writeError{err}
+		}
+		p.count++
+		p.noteRecord(false, false)
+		p.traceRecord(rec, traceSearched, start, nil)
+		return nil
+	}
+
+	result, err := p.render(s)
+	if err != nil {
+		p.traceRecord(rec, "", start, err)
+		// A record skipped under --keep-going still takes up its index
+		if err = p.fail(&locationError{rec.location(), err}); err == nil {
+			p.count++
+			p.noteRecord(false, true)
 		}
+		return err
 	}
-	return scanner.Err()
+
+	// Output
+	if err := p.writeRecord(result); err != nil {
+		return err
+	}
+	return p.endRecord(start)
 }
 
-func (p *Processor) processNullDelimited(r io.Reader) error {
-	reader := bufio.NewReader(r)
-	for {
-		item, err := reader.ReadString('\x00')
-		if err != nil && err != io.EOF {
-			return fmt.Errorf("reading input: %w", err)
+// skipRecord passes over a record written by the run being resumed, and
+// checks the input against it after the last one
+func (p *Processor) skipRecord(rec Record, start time.Time) error {
+	p.skip--
+	p.count++
+	p.traceRecord(rec, traceSkipped, start, nil)
+	if p.skip == 0 {
+		return p.state.verify()
+	}
+	return nil
+}
+
+// endRecord accounts for a record that has been written out in full
+func (p *Processor) endRecord(start time.Time) error {
+	if p.shards != nil {
+		if err := p.shards.endRecord(); err != nil {
+			return err
 		}
-		// Remove the null terminator if present
-		item = strings.TrimSuffix(item, "\x00")
-		
-		if item != "" || err == nil {
-			if err := p.processItem(item); err != nil {
-				return err
+	}
+
+	p.count++
+	p.noteRecord(p.record.Changed, false)
+	action := traceEscaped
+	if p.Config.Unescape {
+		action = traceUnescaped
+	}
+	p.traceRecord(p.record, action, start, nil)
+	if p.state != nil {
+		return p.state.recordDone(p.count)
+	}
+	return nil
+}
+
+// render transforms one record and formats it as it is written out
+func (p *Processor) render(s string) (string, error) {
+	if p.Config.PredictLength {
+		return p.predictLength(s)
+	}
+	in, requote := s, false
+	if p.Config.SmartQuotes {
+		if inner, ok := quotedString(s); ok {
+			// Escaping a quoted string would escape its quotes as well, so
+			// escape what it holds and quote that instead
+			in = inner
+			if !p.Config.Unescape {
+				in, _ = jsonescape.Unescape(inner)
+				requote = true
 			}
 		}
-		
-		if err == io.EOF {
-			break
+	}
+
+	result, err := p.transform(in)
+	p.noteStats(s, result, err != nil)
+	if err != nil {
+		return "", err
+	}
+	if limit := p.Config.MaxExpansion; limit > 0 && float64(len(result)) > limit*float64(len(s)) {
+		return "", fmt.Errorf("output is %.1fx the input size, exceeding --max-expansion-ratio %g",
+			float64(len(result))/float64(len(s)), limit)
+	}
+	if requote {
+		p.record.Changed = `"`+result+`"` != s
+	} else {
+		p.record.Changed = result != s
+	}
+	result, err = p.format(result, p.Config.WrapQuotes || requote)
+	if err != nil {
+		return "", err
+	}
+	if p.Config.WithOriginal {
+		result = s + p.Config.OriginalSep + result
+	}
+	return result, nil
+}
+
+// Policies for --final-newline
+const (
+	finalAlways   = "always"
+	finalNever    = "never"
+	finalPreserve = "preserve"
+)
+
+// writeRecord writes a record's output and the separator after it. Under
+// --final-newline the separator is held back until the next record, as the
+// last record ends the way the policy says instead.
+func (p *Processor) writeRecord(result string) error {
+	if p.Config.Framing != "" {
+		return p.writeFrame(result)
+	}
+	out, sep := result, p.separator()
+	if p.Config.FinalNewline == "" {
+		out += sep
+	} else {
+		out, p.held = p.held+out, sep
+	}
+	if _, err := io.WriteString(p.Output, out); err != nil {
+		return &writeError{err}
+	}
+	p.wrote, p.eol = true, p.record.Newline
+	return nil
+}
+
+// writeFinalNewline ends the output as --final-newline says, once the last
+// record has been written
+func (p *Processor) writeFinalNewline() error {
+	if !p.wrote || p.Config.FinalNewline == finalNever {
+		return nil
+	}
+	if p.Config.FinalNewline == finalAlways || p.Config.FinalNewline == finalPreserve && p.eol {
+		if _, err := io.WriteString(p.Output, "\n"); err != nil {
+			return &writeError{err}
 		}
 	}
 	return nil
 }
 
-func (p *Processor) processItem(s string) error {
+// separator returns what follows each record, warning the first time an
+// empty separator runs two records together unless it was asked for by name
+func (p *Processor) separator() string {
+	explicit := p.Config.RecordSepSet || p.Config.OutputSepSet
+	if p.Config.RecordSep == "" && !explicit && p.count > 0 && !p.joined {
+		p.joined = true
+		p.warnf("records are written with nothing between them (use --record-separator to choose a separator)")
+	}
+	return p.Config.RecordSep
+}
+
+// transform escapes or unescapes a single record, or looks up the result
+// for one seen before under --cache
+func (p *Processor) transform(s string) (string, error) {
+	if p.cache == nil {
+		return p.convert(s)
+	}
+	if result, ok := p.cache.get(s); ok {
+		return result, nil
+	}
+	result, err := p.convert(s)
+	if err == nil {
+		p.cache.put(s, result)
+	}
+	return result, err
+}
+
+// convert escapes or unescapes s, taking the result a --jobs worker has
+// already worked out if there is one
+func (p *Processor) convert(s string) (string, error) {
+	var result string
+	var nonstandard bool
+	var err error
+	if a := p.ahead; a != nil && a.in == s {
+		result, nonstandard, err = a.out, a.nonstandard, a.err
+	} else {
+		result, nonstandard, err = p.convertRecord(s)
+	}
+	if nonstandard && !p.laxHex {
+		p.laxHex = true
+		p.warnf("%s: accepted a non-standard \\U or blank-containing unicode escape; later ones are accepted silently (use --strict-hex to reject them)", p.record.location())
+	}
+	return result, err
+}
+
+// convertRecord escapes or unescapes s, reporting whether unescaping
+// accepted a non-standard escape. It leaves p as it is, so --jobs workers
+// can call it at the same time.
+func (p *Processor) convertRecord(s string) (string, bool, error) {
 	// Validate UTF-8 if strict mode
 	if p.Config.StrictUTF8 && !utf8.ValidString(s) {
-		return errors.New("input contains invalid UTF-8")
+		return "", false, msgf("input contains invalid UTF-8")
 	}
 
 	// Replace invalid UTF-8 if requested
@@ -230,265 +959,735 @@ func (p *Processor) processItem(s string) error {
 		s = strings.ToValidUTF8(s, "\uFFFD")
 	}
 
-	var result string
-	var err error
-
 	if p.Config.Unescape {
-		result, err = jsonUnescape(s)
+		var result string
+		var nonstandard bool
+		var err error
+		if p.Config.StrictHex {
+			result, err = jsonescape.Unescape(s)
+		} else {
+			result, nonstandard, err = jsonescape.UnescapeLenient(s)
+		}
 		if err != nil {
-			return fmt.Errorf("unescaping: %w", err)
+			return "", false, msgf("unescaping: %w", err)
 		}
-	} else {
-		result = jsonEscape(s, p.Config.ASCIIOnly, p.Config.HTMLSafe)
+		// --map-file replaces raw text, which only exists once unescaped
+		if p.mapper != nil {
+			result = p.mapper.Replace(result)
+		}
+		return result, nonstandard, nil
+	}
+
+	if p.mapper != nil {
+		s = p.mapper.Replace(s)
 	}
+	s, err := applyControlPolicy(s, p.Config.Controls, p.Config.ControlRepl)
+	if err != nil {
+		return "", false, err
+	}
+	return jsonescape.Escape(s, jsonescape.Options{ASCII: p.Config.ASCIIOnly, HTMLSafe: p.Config.HTMLSafe, ByteScan: p.Config.NoSIMD}), false, nil
+}
 
-	// Wrap in quotes if requested
+// predictLength works out the length of a record once escaped, with its
+// quotes under --quote, without escaping it
+func (p *Processor) predictLength(s string) (string, error) {
+	if p.Config.StrictUTF8 && !utf8.ValidString(s) {
+		return "", msgf("input contains invalid UTF-8")
+	}
+	n := jsonescape.EscapedLen(s, jsonescape.Options{ASCII: p.Config.ASCIIOnly, HTMLSafe: p.Config.HTMLSafe, ByteScan: p.Config.NoSIMD})
 	if p.Config.WrapQuotes {
-		result = `"` + result + `"`
+		n += 2
 	}
+	return strconv.Itoa(n), nil
+}
 
-	// Output
-	if p.Config.RawOutput {
-		fmt.Fprint(p.Output, result)
+// format applies quoting, wrapping and other presentation options to a
+// transformed record
+func (p *Processor) format(result string, quote bool) (string, error) {
+	if p.Config.Host != "" {
+		result = hostEscape(result, p.Config.Host)
+	}
+
+	// Concatenated fragments carry their own quotes; everything else is
+	// quoted first so the quotes count towards the wrap column
+	width := p.Config.WrapColumn
+	if width == 0 {
+		width = defaultConcatWidth
+	}
+	if p.Config.EmitConcat != "" {
+		result = emitConcat(result, width, p.Config.EmitConcat)
+	} else if p.Config.EmitBytes != "" {
+		if quote {
+			result = `"` + result + `"`
+		}
+		result = emitBytes(result, width, p.Config.EmitBytes)
+	} else if p.Config.WrapColumn > 0 && p.Config.WrapStyle == wrapConcat {
+		result = wrapWithConcat(result, p.Config.WrapColumn)
 	} else {
-		fmt.Fprintln(p.Output, result)
+		if quote {
+			result = `"` + result + `"`
+		}
+		if p.Config.WrapColumn > 0 {
+			result = wrapWithBackslash(result, p.Config.WrapColumn)
+		}
 	}
 
-	p.count++
-	return nil
+	if p.Config.Heredoc != "" {
+		return heredoc(result, p.Config.Heredoc, p.Config.HeredocSet)
+	}
+	return result, nil
 }
 
-// jsonEscape escapes a string for use in JSON
-func jsonEscape(s string, asciiOnly, htmlSafe bool) string {
-	var buf bytes.Buffer
-	buf.Grow(len(s) + 10) // Pre-allocate with some headroom
-
-	for _, r := range s {
-		switch r {
-		case '"':
-			buf.WriteString(`\"`)
-		case '\\':
-			buf.WriteString(`\\`)
-		case '\b':
-			buf.WriteString(`\b`)
-		case '\f':
-			buf.WriteString(`\f`)
-		case '\n':
-			buf.WriteString(`\n`)
-		case '\r':
-			buf.WriteString(`\r`)
-		case '\t':
-			buf.WriteString(`\t`)
-		case '<':
-			if htmlSafe {
-				buf.WriteString(`\u003c`)
-			} else {
-				buf.WriteRune(r)
-			}
-		case '>':
-			if htmlSafe {
-				buf.WriteString(`\u003e`)
-			} else {
-				buf.WriteRune(r)
-			}
-		case '&':
-			if htmlSafe {
-				buf.WriteString(`\u0026`)
-			} else {
-				buf.WriteRune(r)
-			}
-		default:
-			// Control characters (U+0000 through U+001F) must be escaped
-			if r < 0x20 {
-				fmt.Fprintf(&buf, `\u%04x`, r)
-			} else if asciiOnly && r > 127 {
-				// Escape non-ASCII characters
-				if r <= 0xFFFF {
-					fmt.Fprintf(&buf, `\u%04x`, r)
-				} else {
-					// Use surrogate pairs for characters outside BMP
-					r1, r2 := utf16Surrogates(r)
-					fmt.Fprintf(&buf, `\u%04x\u%04x`, r1, r2)
-				}
-			} else {
-				buf.WriteRune(r)
-			}
+// applyControlPolicy handles C0 control characters that have no short escape
+// form (everything below U+0020 except \b, \f, \n, \r and \t) according
+// to the --controls policy. The default policy leaves them for jsonescape.Escape to
+// encode as \uXXXX.
+func applyControlPolicy(s, policy, repl string) (string, error) {
+	if policy == "" || policy == "escape" {
+		return s, nil
+	}
+
+	var buf strings.Builder
+	for i, r := range s {
+		if !isBareControl(r) {
+			buf.WriteRune(r)
+			continue
+		}
+		switch policy {
+		case "strip":
+			// drop it
+		case "replace":
+			buf.WriteString(repl)
+		case "error":
+			return "", fmt.Errorf("input contains control character U+%04X at byte %d", r, i)
 		}
 	}
+	return buf.String(), nil
+}
 
-	return buf.String()
+// isBareControl reports whether r is a C0 control character that JSON can
+// only represent as a \uXXXX escape
+func isBareControl(r rune) bool {
+	if r >= 0x20 {
+		return false
+	}
+	switch r {
+	case '\b', '\f', '\n', '\r', '\t':
+		return false
+	}
+	return true
 }
 
-// utf16Surrogates returns the UTF-16 surrogate pair for a rune outside the BMP
-func utf16Surrogates(r rune) (rune, rune) {
-	r -= 0x10000
-	return 0xD800 + (r>>10)&0x3FF, 0xDC00 + r&0x3FF
+// quotedString reports whether s is a complete quoted JSON string, returning
+// the escaped text between the quotes
+func quotedString(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", false
+	}
+	inner := s[1 : len(s)-1]
+	for i := 0; i < len(inner); i++ {
+		if inner[i] == '\\' {
+			i++
+		} else if inner[i] == '"' || inner[i] < 0x20 {
+			return "", false
+		}
+	}
+	if _, err := jsonescape.Unescape(inner); err != nil {
+		return "", false
+	}
+	return inner, true
 }
 
-// jsonUnescape unescapes a JSON string
-func jsonUnescape(s string) (string, error) {
-	var buf bytes.Buffer
-	buf.Grow(len(s))
+// parseHexRune parses the four hex digits of a \uXXXX escape
+func parseHexRune(hex string) (rune, error) {
+	var r rune
+	for _, c := range hex {
+		r <<= 4
+		switch {
+		case c >= '0' && c <= '9':
+			r |= rune(c - '0')
+		case c >= 'a' && c <= 'f':
+			r |= rune(c - 'a' + 10)
+		case c >= 'A' && c <= 'F':
+			r |= rune(c - 'A' + 10)
+		default:
+			return 0, fmt.Errorf("invalid hex character %q", c)
+		}
+	}
+	return r, nil
+}
+
+// parseArgs parses command-line arguments
+func parseArgs(args []string) (*Config, error) {
+	config := &Config{RecordSep: "\n"}
 
 	i := 0
-	for i < len(s) {
-		if s[i] != '\\' {
-			buf.WriteByte(s[i])
-			i++
-			continue
+	for i < len(args) {
+		arg := args[i]
+
+		// Stop processing flags after --
+		if arg == "--" {
+			config.Args = append(config.Args, args[i+1:]...)
+			break
 		}
 
-		// Handle escape sequence
-		if i+1 >= len(s) {
-			return "", errors.New("incomplete escape sequence at end of string")
-		}
-
-		i++ // skip the backslash
-		switch s[i] {
-		case '"':
-			buf.WriteByte('"')
-		case '\\':
-			buf.WriteByte('\\')
-		case '/':
-			buf.WriteByte('/')
-		case 'b':
-			buf.WriteByte('\b')
-		case 'f':
-			buf.WriteByte('\f')
-		case 'n':
-			buf.WriteByte('\n')
-		case 'r':
-			buf.WriteByte('\r')
-		case 't':
-			buf.WriteByte('\t')
-		case 'u':
-			// Unicode escape: \uXXXX
-			if i+4 >= len(s) {
-				return "", errors.New("incomplete unicode escape sequence")
-			}
-			hex := s[i+1 : i+5]
-			r, err := parseHexRune(hex)
-			if err != nil {
-				return "", fmt.Errorf("invalid unicode escape \\u%s: %w", hex, err)
-			}
+		// Long options
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue := strings.Cut(arg[2:], "=")
 			
-			// Check for surrogate pair
-			if r >= 0xD800 && r <= 0xDBFF {
-				// High surrogate - look for low surrogate
-				if i+10 < len(s) && s[i+5] == '\\' && s[i+6] == 'u' {
-					hex2 := s[i+7 : i+11]
-					r2, err := parseHexRune(hex2)
-					if err == nil && r2 >= 0xDC00 && r2 <= 0xDFFF {
-						// Valid surrogate pair
-						combined := 0x10000 + (rune(r)-0xD800)*0x400 + (rune(r2) - 0xDC00)
-						buf.WriteRune(combined)
-						i += 11 // skip past \uXXXX\uXXXX (will be incremented to 12 at end of loop)
-						continue
+			switch name {
+			case "help":
+				config.ShowHelp = true
+			case "version":
+				config.ShowVersion = true
+			case "unescape":
+				config.Unescape = true
+			case "quote":
+				config.WrapQuotes = true
+			case "raw":
+				config.RecordSep = ""
+			case "print0":
+				config.RecordSep = "\x00"
+			case "final-newline":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value (%s)", "--final-newline", "always, never, preserve")
+					}
+					value = args[i]
+				}
+				switch value {
+				case finalAlways, finalNever, finalPreserve:
+					config.FinalNewline = value
+				default:
+					return nil, msgf("invalid %s value %q (expected %s)", "--final-newline", value, "always, never, preserve")
+				}
+			case "output-separator":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--output-separator")
+					}
+					value = args[i]
+				}
+				sep, err := jsonescape.Unescape(value)
+				if err != nil {
+					return nil, msgf("invalid %s value %q: %w", "--output-separator", value, err)
+				}
+				config.OutputSep, config.OutputSepSet = sep, true
+			case "record-separator":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--record-separator")
+					}
+					value = args[i]
+				}
+				sep, err := jsonescape.Unescape(value)
+				if err != nil {
+					return nil, msgf("invalid %s value %q: %w", "--record-separator", value, err)
+				}
+				config.RecordSep, config.RecordSepSet = sep, true
+			case "null":
+				config.NullDelimited = true
+			case "lines":
+				config.LineMode = true
+			case "delimiter":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--delimiter")
+					}
+					value = args[i]
+				}
+				delim, err := jsonescape.Unescape(value)
+				if err != nil {
+					return nil, msgf("invalid %s value %q: %w", "--delimiter", value, err)
+				}
+				if delim == "" {
+					return nil, msgf("%s cannot be empty", "--delimiter")
+				}
+				config.Delimiter = delim
+			case "framing":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value (%s)", "--framing", "varint, u32le")
+					}
+					value = args[i]
+				}
+				if !slices.Contains(framings, value) {
+					return nil, msgf("invalid %s value %q (expected %s)", "--framing", value, "varint, u32le")
+				}
+				config.Framing = value
+			case "ascii":
+				config.ASCIIOnly = true
+			case "html-safe":
+				config.HTMLSafe = true
+			case "strict":
+				config.StrictUTF8 = true
+			case "replace":
+				config.ReplaceUTF8 = true
+			case "pedantic":
+				config.Pedantic = true
+			case "use-daemon":
+				// The socket is optional, so it must be attached with =
+				config.UseDaemon = defaultSocket()
+				if hasValue {
+					config.UseDaemon = value
+				}
+			case "log-backend":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value (%s)", "--log-backend", "stderr, syslog, journald, file:<PATH>")
+					}
+					value = args[i]
+				}
+				if err := parseLogBackend(value); err != nil {
+					return nil, err
+				}
+				config.LogBackend = value
+			case "stream":
+				config.Stream = true
+			case "flush-bytes":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--flush-bytes")
+					}
+					value = args[i]
+				}
+				n, err := strconv.Atoi(value)
+				if err != nil || n < minFlushBytes {
+					return nil, msgf("invalid %s value %q (expected a number of at least %d)", "--flush-bytes", value, minFlushBytes)
+				}
+				config.FlushBytes = n
+			case "no-simd":
+				config.NoSIMD = true
+			case "lang":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value (%s)", "--lang", "en, de, es, fr")
+					}
+					value = args[i]
+				}
+				if !slices.Contains(languages, value) {
+					return nil, msgf("invalid %s value %q (expected %s)", "--lang", value, "en, de, es, fr")
+				}
+				config.Lang = value
+			case "strict-hex":
+				config.StrictHex = true
+			case "stdin":
+				config.ReadStdin = true
+			case "stdio-server":
+				config.StdioServer = true
+			case "args-are-files":
+				config.ArgsAreFiles = true
+			case "literal-args":
+				config.LiteralArgs = true
+			case "secret-prompt":
+				config.SecretPrompt = true
+			case "multiline-prompt":
+				config.Multiline = true
+				config.Terminator = defaultPromptTerminator
+				if hasValue {
+					if value == "" {
+						return nil, msgf("%s terminator cannot be empty", "--multiline-prompt")
+					}
+					config.Terminator = value
+				}
+			case "file":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--file")
+					}
+					value = args[i]
+				}
+				config.InputFiles = append(config.InputFiles, value)
+			case "label":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--label")
+					}
+					value = args[i]
+				}
+				config.Labels = append(config.Labels, value)
+			case "output":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--output")
+					}
+					value = args[i]
+				}
+				config.OutputFile = value
+			case "append":
+				config.Append = true
+			case "tee":
+				config.Tee = true
+			case "atomic":
+				config.Atomic = true
+			case "in-place":
+				// The suffix is optional, so it must be attached with =
+				config.InPlace = true
+				config.BackupSuffix = value
+			case "confirm":
+				// As with --in-place, the value is optional
+				if hasValue && value != "all" {
+					return nil, msgf("invalid %s value %q (expected %s)", "--confirm", value, "all")
+				}
+				config.Confirm = true
+				config.ConfirmAll = hasValue
+			case "completion":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a shell name (%s)", "--completion", "bash, zsh, fish")
+					}
+					value = args[i]
+				}
+				config.GenerateCompletion = value
+			case "controls":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value (%s)", "--controls", "escape, strip, replace:<char>, error")
+					}
+					value = args[i]
+				}
+				policy, repl, _ := strings.Cut(value, ":")
+				switch policy {
+				case "escape", "strip", "error":
+					if repl != "" {
+						return nil, msgf("%s does not take an argument", "--controls="+policy)
+					}
+				case "replace":
+					if utf8.RuneCountInString(repl) != 1 {
+						return nil, msgf("%s requires a single character, e.g. %s", "--controls=replace", "replace:?")
+					}
+				default:
+					return nil, msgf("invalid %s value %q (expected %s)", "--controls", value, "escape, strip, replace:<char>, error")
+				}
+				config.Controls = policy
+				config.ControlRepl = repl
+			case "map-file":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--map-file")
+					}
+					value = args[i]
+				}
+				config.MapFile = value
+			case "wrap-column":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--wrap-column")
+					}
+					value = args[i]
+				}
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 2 {
+					return nil, msgf("invalid %s value %q (expected a number of at least %d)", "--wrap-column", value, 2)
+				}
+				config.WrapColumn = n
+			case "wrap-style":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value (%s)", "--wrap-style", "backslash, concat")
+					}
+					value = args[i]
+				}
+				if value != wrapBackslash && value != wrapConcat {
+					return nil, msgf("invalid %s value %q (expected %s)", "--wrap-style", value, "backslash, concat")
+				}
+				config.WrapStyle = value
+			case "emit-concat":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a language (%s)", "--emit-concat", "go, python, c, js")
+					}
+					value = args[i]
+				}
+				if !slices.Contains(concatLanguages, value) {
+					return nil, msgf("invalid %s value %q (expected %s)", "--emit-concat", value, "go, python, c, js")
+				}
+				config.EmitConcat = value
+			case "smart-quotes":
+				config.SmartQuotes = true
+			case "host":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value (%s)", "--host", "single-quote, double-quote, backtick")
+					}
+					value = args[i]
+				}
+				if value != hostSingleQuote && value != hostDoubleQuote && value != hostBacktick {
+					return nil, msgf("invalid %s value %q (expected %s)", "--host", value, "single-quote, double-quote, backtick")
+				}
+				config.Host = value
+			case "emit-bytes":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a language (%s)", "--emit-bytes", "go, c, python")
+					}
+					value = args[i]
+				}
+				if !slices.Contains(bytesLanguages, value) {
+					return nil, msgf("invalid %s value %q (expected %s)", "--emit-bytes", value, "go, c, python")
+				}
+				config.EmitBytes = value
+			case "max-expansion-ratio":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--max-expansion-ratio")
+					}
+					value = args[i]
+				}
+				ratio, err := strconv.ParseFloat(value, 64)
+				if err != nil || ratio <= 0 {
+					return nil, msgf("invalid %s value %q (expected a positive number)", "--max-expansion-ratio", value)
+				}
+				config.MaxExpansion = ratio
+			case "output-encoding":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value (%s)", "--output-encoding", "utf-8, utf-8-bom, utf-16le")
+					}
+					value = args[i]
+				}
+				if !slices.Contains(outputEncodings, value) {
+					return nil, msgf("invalid %s value %q (expected %s)", "--output-encoding", value, "utf-8, utf-8-bom, utf-16le")
+				}
+				config.OutputEncoding = value
+			case "shard-size":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--shard-size")
+					}
+					value = args[i]
+				}
+				records, bytes, err := parseShardSize(value)
+				if err != nil {
+					return nil, err
+				}
+				config.ShardRecords, config.ShardBytes = records, bytes
+			case "output-pattern":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--output-pattern")
 					}
+					value = args[i]
 				}
-			}
-			
-			buf.WriteRune(r)
-			i += 4
-		default:
-			return "", fmt.Errorf("invalid escape sequence \\%c", s[i])
-		}
-		i++
-	}
-
-	return buf.String(), nil
-}
-
-func parseHexRune(hex string) (rune, error) {
-	var r rune
-	for _, c := range hex {
-		r <<= 4
-		switch {
-		case c >= '0' && c <= '9':
-			r |= rune(c - '0')
-		case c >= 'a' && c <= 'f':
-			r |= rune(c - 'a' + 10)
-		case c >= 'A' && c <= 'F':
-			r |= rune(c - 'A' + 10)
-		default:
-			return 0, fmt.Errorf("invalid hex character %q", c)
-		}
-	}
-	return r, nil
-}
-
-// parseArgs parses command-line arguments
-func parseArgs(args []string) (*Config, error) {
-	config := &Config{}
-
-	i := 0
-	for i < len(args) {
-		arg := args[i]
-
-		// Stop processing flags after --
-		if arg == "--" {
-			config.Args = append(config.Args, args[i+1:]...)
-			break
-		}
-
-		// Long options
-		if strings.HasPrefix(arg, "--") {
-			name, value, hasValue := strings.Cut(arg[2:], "=")
-			
-			switch name {
-			case "help":
-				config.ShowHelp = true
-			case "version":
-				config.ShowVersion = true
-			case "unescape":
-				config.Unescape = true
-			case "quote":
-				config.WrapQuotes = true
-			case "raw":
-				config.RawOutput = true
-			case "null":
-				config.NullDelimited = true
-			case "lines":
-				config.LineMode = true
-			case "ascii":
-				config.ASCIIOnly = true
-			case "html-safe":
-				config.HTMLSafe = true
-			case "strict":
-				config.StrictUTF8 = true
-			case "replace":
-				config.ReplaceUTF8 = true
-			case "stdin":
-				config.ReadStdin = true
-			case "file":
+				if !strings.Contains(value, shardPlaceholder) {
+					return nil, msgf("%s %q must contain %s", "--output-pattern", value, shardPlaceholder)
+				}
+				config.OutputPattern = value
+			case "state-file":
 				if !hasValue {
 					i++
 					if i >= len(args) {
-						return nil, errors.New("--file requires a value")
+						return nil, msgf("%s requires a value", "--state-file")
 					}
 					value = args[i]
 				}
-				config.InputFiles = append(config.InputFiles, value)
-			case "output":
+				config.StateFile = value
+			case "resume":
+				config.Resume = true
+			case "keep-going":
+				config.KeepGoing = true
+			case "error-summary":
+				config.ErrorSummary = true
+			case "report":
 				if !hasValue {
 					i++
 					if i >= len(args) {
-						return nil, errors.New("--output requires a value")
+						return nil, msgf("%s requires a format (%s)", "--report", "text, json")
 					}
 					value = args[i]
 				}
-				config.OutputFile = value
-			case "completion":
+				if value != reportText && value != reportJSON {
+					return nil, msgf("invalid %s value %q (expected %s)", "--report", value, "text, json")
+				}
+				config.Report = value
+			case "trace":
 				if !hasValue {
 					i++
 					if i >= len(args) {
-						return nil, errors.New("--completion requires a shell name (bash, zsh, fish)")
+						return nil, msgf("%s requires a value", "--trace")
 					}
 					value = args[i]
 				}
-				config.GenerateCompletion = value
+				config.TraceFile = value
+			case "per-file-stats":
+				config.PerFileStats = true
+			case "cache":
+				// The size is optional, so it must be attached with =
+				config.CacheSize = defaultCacheSize
+				if hasValue {
+					n, err := strconv.Atoi(value)
+					if err != nil || n < 1 {
+						return nil, msgf("invalid %s size %q (expected a positive number of records)", "--cache", value)
+					}
+					config.CacheSize = n
+				}
+			case "jobs":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--jobs")
+					}
+					value = args[i]
+				}
+				jobs, err := parseJobs(value)
+				if err != nil {
+					return nil, err
+				}
+				config.Jobs = jobs
+			case "predict-length":
+				config.PredictLength = true
+			case "unordered":
+				config.Unordered = true
+			case "unbuffered":
+				config.Unbuffered = true
+			case "timings":
+				config.Timings = true
+			case "sniff":
+				config.Sniff = true
+			case "skip-binary":
+				config.SkipBinary = true
+			case "force-binary":
+				config.ForceBinary = true
+			case "assume-text":
+				config.AssumeText = true
+			case "diff-output":
+				config.DiffOutput = true
+			case "rewrite-strings":
+				config.RewriteStrings = true
+			case "ndjson-in":
+				config.NDJSONIn = true
+			case "fields":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--fields")
+					}
+					value = args[i]
+				}
+				fields, err := parseFields(value)
+				if err != nil {
+					return nil, err
+				}
+				config.Fields = fields
+			case "allow-comments":
+				config.AllowComments = true
+			case "allow-trailing-commas":
+				config.AllowTrailingCommas = true
+			case "sort-keys":
+				config.SortKeys = true
+			case "dup-keys":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value (%s)", "--dup-keys", "error, first, last")
+					}
+					value = args[i]
+				}
+				if !slices.Contains(dupPolicies, value) {
+					return nil, msgf("invalid %s value %q (expected %s)", "--dup-keys", value, "error, first, last")
+				}
+				config.DupKeys = value
+			case "between", "between-regex":
+				if hasValue || i+2 >= len(args) {
+					return nil, msgf("%s requires two values: START END", "--"+name)
+				}
+				between, err := parseBetween(args[i+1], args[i+2], name == "between-regex")
+				if err != nil {
+					return nil, err
+				}
+				config.Between = between
+				i += 2
+			case "subst":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--subst")
+					}
+					value = args[i]
+				}
+				re, err := regexp.Compile(value)
+				if err != nil {
+					return nil, msgf("invalid %s pattern: %w", "--subst", err)
+				}
+				if re.MatchString("") {
+					return nil, msgf("%s pattern %q matches empty text", "--subst", value)
+				}
+				config.Subst = re
+			case "subst-template":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--subst-template")
+					}
+					value = args[i]
+				}
+				tmpl, err := parseSubstTemplate(value)
+				if err != nil {
+					return nil, err
+				}
+				config.SubstTemplate = tmpl
+			case "grep-escape":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return nil, msgf("%s requires a value", "--grep-escape")
+					}
+					value = args[i]
+				}
+				targets, err := parseGrepTargets(value)
+				if err != nil {
+					return nil, err
+				}
+				config.GrepEscape = targets
+			case "with-original":
+				// The separator is optional, so it must be attached with =
+				config.WithOriginal = true
+				config.OriginalSep = "\t"
+				if hasValue {
+					sep, err := jsonescape.Unescape(value)
+					if err != nil {
+						return nil, msgf("invalid %s separator %q: %w", "--with-original", value, err)
+					}
+					config.OriginalSep = sep
+				}
+			case "heredoc":
+				// The marker is optional, so it must be attached with =
+				config.Heredoc = defaultHeredocMarker
+				if hasValue {
+					if !validHeredocMarker(value) {
+						return nil, msgf("invalid heredoc marker %q (letters, digits and _ only)", value)
+					}
+					config.Heredoc = value
+					config.HeredocSet = true
+				}
 			default:
-				return nil, fmt.Errorf("unknown option: --%s", name)
+				if guess, ok := suggestOption(name); ok {
+					return nil, msgf("unknown option: %s (did you mean %s?)", "--"+name, "--"+guess)
+				}
+				return nil, msgf("unknown option: %s", "--"+name)
 			}
 			i++
 			continue
@@ -508,7 +1707,9 @@ func parseArgs(args []string) (*Config, error) {
 				case 'q':
 					config.WrapQuotes = true
 				case 'r':
-					config.RawOutput = true
+					config.RecordSep = ""
+				case 'Z':
+					config.RecordSep = "\x00"
 				case '0':
 					config.NullDelimited = true
 				case 'l':
@@ -525,10 +1726,33 @@ func parseArgs(args []string) (*Config, error) {
 					} else {
 						i++
 						if i >= len(args) {
-							return nil, errors.New("-f requires a value")
+							return nil, msgf("%s requires a value", "-f")
 						}
 						config.InputFiles = append(config.InputFiles, args[i])
 					}
+				case 'j':
+					// -j requires a value
+					var value string
+					if j+1 < len(arg) {
+						value = arg[j+1:]
+						j = len(arg) // end inner loop
+					} else {
+						i++
+						if i >= len(args) {
+							return nil, msgf("%s requires a value", "-j")
+						}
+						value = args[i]
+					}
+					jobs, err := parseJobs(value)
+					if err != nil {
+						return nil, err
+					}
+					config.Jobs = jobs
+				case 'i':
+					// Like sed, the backup suffix can only be attached
+					config.InPlace = true
+					config.BackupSuffix = arg[j+1:]
+					j = len(arg) // end inner loop
 				case 'o':
 					// -o requires a value
 					if j+1 < len(arg) {
@@ -537,12 +1761,12 @@ func parseArgs(args []string) (*Config, error) {
 					} else {
 						i++
 						if i >= len(args) {
-							return nil, errors.New("-o requires a value")
+							return nil, msgf("%s requires a value", "-o")
 						}
 						config.OutputFile = args[i]
 					}
 				default:
-					return nil, fmt.Errorf("unknown option: -%c", c)
+					return nil, msgf("unknown option: %s", "-"+string(c))
 				}
 			}
 			i++
@@ -554,19 +1778,461 @@ func parseArgs(args []string) (*Config, error) {
 		i++
 	}
 
+	if config.ArgsAreFiles || config.InPlace {
+		config.InputFiles = append(config.InputFiles, config.Args...)
+		config.Args = nil
+	}
+	// An output separator is a record separator held back after the last
+	// record, which ends as --final-newline says or else with nothing
+	finalFlag := "--final-newline"
+	if config.OutputSepSet {
+		if config.RecordSep != "\n" {
+			return nil, msgf("%s cannot be combined with %s", "--output-separator", "--record-separator, --raw or --print0")
+		}
+		config.RecordSep = config.OutputSep
+		if config.FinalNewline == "" {
+			config.FinalNewline = finalNever
+			finalFlag = "--output-separator"
+		}
+	}
+	if len(config.Labels) > len(config.InputFiles)+1 {
+		return nil, msgf("%d %s names for %d %s inputs and stdin", len(config.Labels), "--label", len(config.InputFiles), "--file")
+	}
+
 	// Validate conflicting options
+	if config.Pedantic {
+		if config.ReplaceUTF8 {
+			return nil, msgf("%s cannot be used with %s", "--pedantic", "--replace")
+		}
+		config.StrictUTF8 = true
+		config.StrictHex = true
+	}
 	if config.StrictUTF8 && config.ReplaceUTF8 {
-		return nil, errors.New("--strict and --replace are mutually exclusive")
+		return nil, msgf("%s and %s are mutually exclusive", "--strict", "--replace")
 	}
 	if config.NullDelimited && config.LineMode {
-		return nil, errors.New("--null and --lines are mutually exclusive")
+		return nil, msgf("%s and %s are mutually exclusive", "--null", "--lines")
+	}
+	if config.Delimiter != "" && (config.NullDelimited || config.LineMode) {
+		return nil, msgf("%s cannot be combined with %s", "--delimiter", "--lines or --null")
+	}
+	if config.Framing != "" {
+		if config.RecordSep != "\n" {
+			return nil, msgf("%s cannot be combined with %s", "--framing", "--record-separator, --output-separator, --raw or --print0")
+		}
+		// Records are delimited by their lengths alone
+		if err := conflicts("--framing", []conflict{
+			{config.LineMode, "--lines"},
+			{config.NullDelimited, "--null"},
+			{config.Delimiter != "", "--delimiter"},
+			{config.Stream, "--stream"},
+			{config.RewriteStrings, "--rewrite-strings"},
+			{config.Between != nil, "--between"},
+			{config.Subst != nil, "--subst"},
+			{config.WithOriginal, "--with-original"},
+			{config.WrapColumn > 0, "--wrap-column"},
+			{config.DiffOutput, "--diff-output"},
+			{config.Sniff, "--sniff"},
+			{config.GrepEscape != nil, "--grep-escape"},
+			{config.FinalNewline != "", finalFlag},
+			{config.OutputPattern != "", "--output-pattern"},
+			{config.StdioServer, "--stdio-server"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	parallelFiles := config.Jobs > 1 && len(config.InputFiles) > 1
+	if config.Jobs > 1 && !config.LineMode && !config.NullDelimited && config.Delimiter == "" && config.Framing == "" && !parallelFiles {
+		return nil, msgf("%s requires %s or several %s inputs", "--jobs", "--lines, --null, --delimiter, --framing", "--file")
+	}
+	if config.Unordered && config.Jobs == 0 {
+		return nil, msgf("%s requires %s", "--unordered", "--jobs")
+	}
+	if parallelFiles {
+		// These follow the run record by record, across files
+		if err := conflicts("--jobs with several --file inputs", []conflict{
+			{config.TraceFile != "", "--trace"},
+			{config.Timings, "--timings"},
+			{config.StateFile != "", "--state-file"},
+			{config.OutputPattern != "", "--output-pattern"},
+			{config.FinalNewline != "", finalFlag},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.WrapColumn > 0 && config.Unescape {
+		return nil, msgf("%s cannot be used with %s", "--wrap-column", "--unescape")
+	}
+	if config.WrapStyle != "" && config.WrapColumn == 0 {
+		return nil, msgf("%s requires %s", "--wrap-style", "--wrap-column")
+	}
+	if form, least := minWrapColumn(config); config.WrapColumn > 0 && config.WrapColumn < least {
+		return nil, msgf("%s %d is too narrow for %s (expected at least %d)", "--wrap-column", config.WrapColumn, form, least)
+	}
+	if config.EmitConcat != "" && config.WrapStyle != "" {
+		return nil, msgf("%s and %s are mutually exclusive", "--emit-concat", "--wrap-style")
+	}
+	if config.EmitConcat != "" && config.Unescape {
+		return nil, msgf("%s cannot be used with %s", "--emit-concat", "--unescape")
+	}
+	if config.Host != "" {
+		if err := conflicts("--host", []conflict{
+			{config.Unescape, "--unescape"},
+			{config.WrapColumn > 0, "--wrap-column"},
+			{config.EmitConcat != "", "--emit-concat"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.EmitBytes != "" && (config.EmitConcat != "" || config.WrapStyle != "") {
+		return nil, msgf("%s cannot be combined with %s", "--emit-bytes", "--emit-concat or --wrap-style")
+	}
+	if config.RewriteStrings {
+		if err := conflicts("--rewrite-strings", []conflict{
+			{config.Unescape, "--unescape"},
+			{config.WrapQuotes, "--quote"},
+			{config.LineMode, "--lines"},
+			{config.NullDelimited, "--null"},
+			{config.Delimiter != "", "--delimiter"},
+			{config.WrapColumn > 0, "--wrap-column"},
+			{config.EmitConcat != "", "--emit-concat"},
+			{config.EmitBytes != "", "--emit-bytes"},
+			{config.Host != "", "--host"},
+			{config.SmartQuotes, "--smart-quotes"},
+			{config.Heredoc != "", "--heredoc"},
+			{config.WithOriginal, "--with-original"},
+			{config.MaxExpansion > 0, "--max-expansion-ratio"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.SubstTemplate != nil && config.Subst == nil {
+		return nil, msgf("%s requires %s", "--subst-template", "--subst")
+	}
+	if region := regionFlag(config); region != "" {
+		if err := conflicts(region, []conflict{
+			{config.Between != nil && config.Subst != nil, "--subst"},
+			{config.RewriteStrings, "--rewrite-strings"},
+			{config.WrapQuotes, "--quote"},
+			{config.SmartQuotes, "--smart-quotes"},
+			{config.LineMode, "--lines"},
+			{config.NullDelimited, "--null"},
+			{config.Delimiter != "", "--delimiter"},
+			{config.Stream, "--stream"},
+			{config.WrapColumn > 0, "--wrap-column"},
+			{config.EmitConcat != "", "--emit-concat"},
+			{config.EmitBytes != "", "--emit-bytes"},
+			{config.Host != "", "--host"},
+			{config.Heredoc != "", "--heredoc"},
+			{config.WithOriginal, "--with-original"},
+			{config.GrepEscape != nil, "--grep-escape"},
+			{config.MaxExpansion > 0, "--max-expansion-ratio"},
+			{config.FinalNewline != "", finalFlag},
+			{config.OutputPattern != "", "--output-pattern"},
+			{config.StateFile != "", "--state-file"},
+			{config.StdioServer, "--stdio-server"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.NDJSONIn && !config.RewriteStrings {
+		return nil, msgf("%s requires a document mode (%s)", "--ndjson-in", "--rewrite-strings")
+	}
+	if config.Fields != nil && !config.RewriteStrings {
+		return nil, msgf("%s requires a document mode (%s)", "--fields", "--rewrite-strings")
+	}
+	if (config.AllowComments || config.AllowTrailingCommas) && !config.RewriteStrings {
+		return nil, msgf("%s and %s require a document mode (%s)", "--allow-comments", "--allow-trailing-commas", "--rewrite-strings")
+	}
+	if config.SortKeys && !config.RewriteStrings {
+		return nil, msgf("%s requires a document mode (%s)", "--sort-keys", "--rewrite-strings")
+	}
+	if config.DupKeys != "" && !config.RewriteStrings {
+		return nil, msgf("%s requires a document mode (%s)", "--dup-keys", "--rewrite-strings")
+	}
+	if config.SkipBinary && config.ForceBinary {
+		return nil, msgf("%s and %s are mutually exclusive", "--skip-binary", "--force-binary")
+	}
+	if config.ErrorSummary && !config.KeepGoing {
+		return nil, msgf("%s requires %s", "--error-summary", "--keep-going")
+	}
+	if config.Resume && config.StateFile == "" {
+		return nil, msgf("%s requires %s", "--resume", "--state-file")
+	}
+	if config.StateFile != "" {
+		if config.OutputFile == "" {
+			return nil, msgf("%s requires %s", "--state-file", "--output")
+		}
+		if config.RewriteStrings || config.DiffOutput {
+			return nil, msgf("%s only works with record output, not %s or %s", "--state-file", "--rewrite-strings", "--diff-output")
+		}
+	}
+	if config.GrepEscape != nil {
+		if err := conflicts("--grep-escape", []conflict{
+			{config.Unescape, "--unescape"},
+			{config.RewriteStrings, "--rewrite-strings"},
+			{config.DiffOutput, "--diff-output"},
+			{config.WithOriginal, "--with-original"},
+			{config.StateFile != "", "--state-file"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if (config.ShardRecords > 0 || config.ShardBytes > 0) != (config.OutputPattern != "") {
+		return nil, msgf("%s and %s must be used together", "--shard-size", "--output-pattern")
+	}
+	if config.OutputPattern != "" {
+		if err := conflicts("--output-pattern", []conflict{
+			{config.OutputFile != "", "--output"},
+			{config.StateFile != "", "--state-file"},
+			{config.DiffOutput, "--diff-output"},
+			{config.OutputEncoding != "" && config.OutputEncoding != "utf-8", "--output-encoding " + config.OutputEncoding},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.PredictLength {
+		// Only what escaping itself does can be predicted without doing it
+		if err := conflicts("--predict-length", []conflict{
+			{config.Unescape, "--unescape"},
+			{config.SmartQuotes, "--smart-quotes"},
+			{config.Stream, "--stream"},
+			{config.RewriteStrings, "--rewrite-strings"},
+			{regionFlag(config) != "", regionFlag(config)},
+			{config.DiffOutput, "--diff-output"},
+			{config.GrepEscape != nil, "--grep-escape"},
+			{config.WithOriginal, "--with-original"},
+			{config.WrapColumn > 0, "--wrap-column"},
+			{config.EmitConcat != "", "--emit-concat"},
+			{config.EmitBytes != "", "--emit-bytes"},
+			{config.Host != "", "--host"},
+			{config.Heredoc != "", "--heredoc"},
+			{config.Controls != "" && config.Controls != "escape", "--controls " + config.Controls},
+			{config.MapFile != "", "--map-file"},
+			{config.MaxExpansion > 0, "--max-expansion-ratio"},
+			{config.Sniff, "--sniff"},
+			{config.StdioServer, "--stdio-server"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.Sniff {
+		if err := conflicts("--sniff", []conflict{
+			{config.Unescape, "--unescape"},
+			{config.WrapQuotes, "--quote"},
+			{config.SmartQuotes, "--smart-quotes"},
+			{config.LineMode, "--lines"},
+			{config.NullDelimited, "--null"},
+			{config.Delimiter != "", "--delimiter"},
+			{config.Stream, "--stream"},
+			{config.RewriteStrings, "--rewrite-strings"},
+			{regionFlag(config) != "", regionFlag(config)},
+			{config.DiffOutput, "--diff-output"},
+			{config.GrepEscape != nil, "--grep-escape"},
+			{config.WithOriginal, "--with-original"},
+			{config.WrapColumn > 0, "--wrap-column"},
+			{config.EmitConcat != "", "--emit-concat"},
+			{config.EmitBytes != "", "--emit-bytes"},
+			{config.Host != "", "--host"},
+			{config.Heredoc != "", "--heredoc"},
+			{config.FinalNewline != "", finalFlag},
+			{config.OutputPattern != "", "--output-pattern"},
+			{config.StateFile != "", "--state-file"},
+			{config.StdioServer, "--stdio-server"},
+			{config.SecretPrompt, "--secret-prompt"},
+			{config.Multiline, "--multiline-prompt"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.PerFileStats && (config.RewriteStrings || config.GrepEscape != nil) {
+		return nil, msgf("%s only works when escaping or unescaping records", "--per-file-stats")
+	}
+	if config.StdioServer {
+		if err := conflicts("--stdio-server", []conflict{
+			{len(config.Args) > 0, "[STRING...]"},
+			{len(config.InputFiles) > 0, "--file"},
+			{config.ReadStdin, "--stdin"},
+			{config.SecretPrompt, "--secret-prompt"},
+			{config.LineMode, "--lines"},
+			{config.NullDelimited, "--null"},
+			{config.Delimiter != "", "--delimiter"},
+			{config.OutputFile != "", "--output"},
+			{config.OutputPattern != "", "--output-pattern"},
+			{config.OutputEncoding != "", "--output-encoding"},
+			{config.StateFile != "", "--state-file"},
+			{config.DiffOutput, "--diff-output"},
+			{config.RewriteStrings, "--rewrite-strings"},
+			{config.GrepEscape != nil, "--grep-escape"},
+			{config.UseDaemon != "", "--use-daemon"},
+			{config.LogBackend != "", "--log-backend"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.UseDaemon != "" {
+		// The daemon sends the output back once the run is over
+		if err := conflicts("--use-daemon", []conflict{
+			{config.SecretPrompt, "--secret-prompt"},
+			{config.Unbuffered, "--unbuffered"},
+			{config.Stream, "--stream"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.Multiline {
+		if err := conflicts("--multiline-prompt", []conflict{
+			{config.ReadStdin, "--stdin"},
+			{config.LineMode, "--lines"},
+			{config.NullDelimited, "--null"},
+			{config.Delimiter != "", "--delimiter"},
+			{config.StdioServer, "--stdio-server"},
+			{config.UseDaemon != "", "--use-daemon"},
+			{config.LogBackend != "", "--log-backend"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.FlushBytes > 0 {
+		if !config.Stream {
+			return nil, msgf("%s requires %s", "--flush-bytes", "--stream")
+		}
+		// Shards buffer each file themselves
+		if err := conflicts("--flush-bytes", []conflict{
+			{config.ShardRecords > 0 || config.ShardBytes > 0, "--shard-size"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.Stream {
+		if err := conflicts("--stream", []conflict{
+			{config.LineMode, "--lines"},
+			{config.NullDelimited, "--null"},
+			{config.Delimiter != "", "--delimiter"},
+			{config.SmartQuotes, "--smart-quotes"},
+			{config.WithOriginal, "--with-original"},
+			{config.WrapColumn > 0, "--wrap-column"},
+			{config.EmitConcat != "", "--emit-concat"},
+			{config.EmitBytes != "", "--emit-bytes"},
+			{config.Host != "", "--host"},
+			{config.Heredoc != "", "--heredoc"},
+			{config.GrepEscape != nil, "--grep-escape"},
+			{config.DiffOutput, "--diff-output"},
+			{config.RewriteStrings, "--rewrite-strings"},
+			{config.MaxExpansion > 0, "--max-expansion-ratio"},
+			{config.KeepGoing, "--keep-going"},
+			{config.MapFile != "", "--map-file"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.FinalNewline != "" {
+		if err := conflicts(finalFlag, []conflict{
+			{config.RewriteStrings, "--rewrite-strings"},
+			{config.DiffOutput, "--diff-output"},
+			{config.GrepEscape != nil, "--grep-escape"},
+			{config.StdioServer, "--stdio-server"},
+			{config.OutputPattern != "", "--output-pattern"},
+			{config.StateFile != "", "--state-file"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.WithOriginal && config.DiffOutput {
+		return nil, msgf("%s cannot be used with %s", "--with-original", "--diff-output")
+	}
+	if config.DiffOutput && (len(config.InputFiles) == 0 || len(config.Args) > 0 || config.ReadStdin) {
+		return nil, msgf("%s only works with %s inputs", "--diff-output", "--file")
+	}
+	if config.Tee && config.OutputFile == "" {
+		return nil, msgf("%s requires %s", "--tee", "--output")
+	}
+	if config.Append {
+		if config.OutputFile == "" {
+			return nil, msgf("%s requires %s", "--append", "--output")
+		}
+		if err := conflicts("--append", []conflict{
+			{config.Atomic, "--atomic"},
+			{config.StateFile != "", "--state-file"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.Atomic {
+		if config.OutputFile == "" {
+			return nil, msgf("%s requires %s", "--atomic", "--output")
+		}
+		// A resumed run adds to the output file it left behind
+		if config.StateFile != "" {
+			return nil, msgf("%s cannot be combined with %s", "--atomic", "--state-file")
+		}
+	}
+	if config.InPlace {
+		if len(config.InputFiles) == 0 {
+			return nil, msgf("%s requires files to rewrite", "-i")
+		}
+		// The output goes back into the files and nowhere else
+		if err := conflicts("-i", []conflict{
+			{config.ReadStdin, "--stdin"},
+			{config.SecretPrompt, "--secret-prompt"},
+			{config.Multiline, "--multiline-prompt"},
+			{config.OutputFile != "", "--output"},
+			{config.OutputPattern != "", "--output-pattern"},
+			{config.DiffOutput, "--diff-output"},
+			{config.Sniff, "--sniff"},
+			{config.GrepEscape != nil, "--grep-escape"},
+			{config.FinalNewline != "", finalFlag},
+			{config.StateFile != "", "--state-file"},
+			{config.StdioServer, "--stdio-server"},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if config.Confirm {
+		if !config.InPlace {
+			return nil, msgf("%s requires %s", "--confirm", "-i")
+		}
+		// The questions must come one at a time, and from the user
+		if err := conflicts("--confirm", []conflict{
+			{config.Jobs > 1, "--jobs"},
+			{config.UseDaemon != "", "--use-daemon"},
+			{config.LogBackend != "", "--log-backend"},
+		}); err != nil {
+			return nil, err
+		}
 	}
 
 	return config, nil
 }
 
+// conflict is an option that cannot be combined with another, and whether
+// it was given
+type conflict struct {
+	set  bool
+	flag string
+}
+
+// conflicts reports the first of others that was given alongside flag
+func conflicts(flag string, others []conflict) error {
+	for _, c := range others {
+		if c.set {
+			return msgf("%s cannot be combined with %s", flag, c.flag)
+		}
+	}
+	return nil
+}
+
+// isTerminalWriter reports whether w is a terminal
+func isTerminalWriter(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && isTerminal(f)
+}
+
 // isTerminal attempts to detect if the reader is a terminal
 func isTerminal(r io.Reader) bool {
+	if _, ok := r.(noStdin); ok {
+		return true
+	}
 	f, ok := r.(*os.File)
 	if !ok {
 		return false
@@ -578,8 +2244,9 @@ func isTerminal(r io.Reader) bool {
 	return (stat.Mode() & os.ModeCharDevice) != 0
 }
 
-func printHelp(w io.Writer) {
+func printHelp(w io.Writer, msgs *catalog) {
 	help := `Usage: %s [OPTIONS] [STRING...]
+       %s COMMAND [OPTIONS]
 
 A robust CLI tool for escaping and unescaping JSON strings.
 
@@ -588,26 +2255,223 @@ Arguments:
 
 Input Options:
   -f, --file <PATH>        Read input from file (can be used multiple times)
+      --label <NAME>       Call the next --file input, or stdin after them,
+                           NAME in output, reports and errors instead of its
+                           path (can be used multiple times)
       --stdin              Explicitly read from stdin
+      --args-are-files     Treat [STRING...] as files to read, like --file
+      --literal-args       Don't warn when a [STRING] is the name of a file
+      --secret-prompt      Read a value from the terminal without echoing it,
+                           keeping it out of shell history and ps output
+      --multiline-prompt[=TERM]
+                           Read lines from stdin up to a lone "." (or TERM)
+                           and escape them as one block
   -l, --lines              Process each line as a separate string
+      --stdio-server       Run as a coprocessor: answer length-prefixed
+                           requests on stdin with responses on stdout (see
+                           the README for the protocol)
   -0, --null               Input is null-delimited (like xargs -0)
+      --delimiter <SEP>    Split the input into records at each SEP, one or
+                           more characters; JSON escapes such as \u001e are
+                           understood
+      --framing <FORMAT>   Read and write records preceded by their length in
+                           bytes, as a varint or a 4-byte little-endian u32le
+  -j, --jobs <N>           Escape or unescape --lines, --null, --delimiter or
+                           --framing records, or several --file inputs at
+                           once, on N threads (0 for one per CPU); output
+                           keeps the input order
+      --unordered          With --jobs, write each file's output as soon as
+                           it is done instead of in the order given
+      --stream             Escape or unescape files and stdin a chunk at a
+                           time, so memory use stays the same however large
+                           they are
+      --flush-bytes <N>    With --stream, read N bytes at a time and write out
+                           each chunk at once, never splitting a character
+                           or escape
 
 Output Options:
   -u, --unescape           Unescape JSON string instead of escaping
   -q, --quote              Wrap output in double quotes
-  -r, --raw                Don't add trailing newline to output
+      --smart-quotes       Treat input that is already a quoted JSON string
+                           as such: escaping keeps one set of quotes and
+                           unescaping removes them
+      --record-separator <SEP>
+                           Write SEP after each record instead of a newline;
+                           JSON escapes such as \t and \u0000 are understood
+      --output-separator <SEP>
+                           Write SEP between records and nothing after the
+                           last one (unless --final-newline says otherwise),
+                           e.g. ',' for a comma-separated list
+  -r, --raw                Same as --record-separator '' (no newline)
+  -Z, --print0             End each record with a NUL instead of a newline,
+                           for xargs -0 (same as --record-separator '\u0000')
+      --final-newline <WHEN>
+                           End the last record with a newline always, never,
+                           or if its input ended with one (preserve), in place
+                           of its separator
   -o, --output <PATH>      Write output to file instead of stdout
+      --tee                Write the output to stdout as well as to --output
+      --append             Add to the end of the --output file instead of
+                           replacing it
+      --atomic             Write --output under a temporary name and rename
+                           it into place once the run succeeds, so a failed
+                           run leaves no truncated file behind
+  -i[SUFFIX], --in-place[=SUFFIX]
+                           Rewrite each file with its output (arguments are
+                           files), keeping the original as FILE.SUFFIX if a
+                           suffix is given
+      --confirm[=all]      With -i, show each file's diff and ask before
+                           rewriting it, or with =all show every diff and ask
+                           once; answers are read from stdin
+      --unbuffered         Write each record out as soon as it is done rather
+                           than in blocks (the default unless writing to a
+                           terminal), for pipelines that must see it at once
+      --wrap-column <N>    Break escaped output into lines of at most N columns
+      --wrap-style <STYLE> How to break lines: backslash (default) or concat
+      --emit-concat <LANG> Emit concatenated string literals for go, python, c
+                           or js (width from --wrap-column, default 80)
+      --host <DELIM>       Also escape the quote of the string the output is
+                           pasted into: single-quote (as ''), double-quote or
+                           backtick (JS template literals)
+      --emit-bytes <LANG>  Emit the output as a byte slice or array literal
+                           for go, c or python
+      --heredoc[=MARKER]   Wrap output in a quoted shell heredoc
+      --grep-escape <LIST> Instead of escaping, print the records of escaped
+                           input that contain these escapes or characters,
+                           with their positions, e.g. '\u2028,U+0000,\t'
+      --predict-length     Instead of escaping, print the length in bytes of
+                           each record's escaped form, without building it
+      --with-original[=SEP]
+                           Write each input record, SEP (default a tab) and
+                           then its output, for eyeballing or joining
+      --diff-output        Print a unified diff of each --file against its
+                           transformed content instead of the content
+      --shard-size <N>     Split output into files of N records each, or of
+                           about N bytes with a B, K, M or G suffix
+      --output-pattern <PATTERN>
+                           Shard file names, with {shard} for the shard number
+                           (e.g. 'out-{shard}.ndjson'); a manifest listing the
+                           shards is written as 'out-manifest.json'
+      --output-encoding <ENC>
+                           Encode output as utf-8 (default), utf-8-bom or
+                           utf-16le (with a byte order mark)
 
 Encoding Options:
   -a, --ascii              Escape all non-ASCII characters as \uXXXX
       --html-safe          Also escape <, >, & for HTML embedding
   -s, --strict             Reject invalid UTF-8 input
       --replace            Replace invalid UTF-8 with replacement character
+      --strict-hex         When unescaping, reject \U0041 and blanks inside
+                           \uXXXX escapes instead of accepting them with a
+                           warning
+      --controls <POLICY>  Handle control characters without a short escape:
+                           escape (default), strip, replace:<char>, error
+      --map-file <PATH>    Make the literal replacements listed in PATH, one
+                           'TEXT<tab>REPLACEMENT' per line, in each record
+                           before escaping (after unescaping with -u)
+      --pedantic           Turn on --strict and --strict-hex and treat every
+                           warning as an error, for conformance testing
+
+Document Options:
+      --rewrite-strings    Treat input as a JSON document and re-encode every
+                           string in it with the escaping options above;
+                           concatenated documents are written one per line
+      --ndjson-in          Treat each input line as a separate JSON document
+      --fields <PATHS>     Only re-encode string values at these comma-separated
+                           paths, e.g. 'message,errors[*].detail'
+      --allow-comments     Accept // and /* */ comments in documents (JSONC)
+      --allow-trailing-commas
+                           Accept a trailing comma in objects and arrays
+      --sort-keys          Write the members of every object in order of
+                           their keys, for byte-reproducible documents
+      --dup-keys <POLICY>  Fail on a key repeated within an object (error), or
+                           warn and keep only its first or last member
+      --between <START> <END>
+                           Treat input as text and transform only what lies
+                           between each START and the next END, leaving the
+                           markers and the rest as they are
+      --between-regex <START> <END>
+                           The same with regular expressions as markers
+      --subst <REGEX>      Treat input as text and replace each match of
+                           REGEX with its escaped form
+      --subst-template <TEMPLATE>
+                           Replace matches with TEMPLATE instead, where
+                           {{.Escaped}} is the escaped match, {{.Match}} the
+                           original and {{index .Groups 0}} the first group
+
+Safety Options:
+      --max-expansion-ratio <N>
+                           Fail a record whose output is more than N times
+                           the size of its input
+      --skip-binary        Skip input files that look binary
+      --force-binary       Process input files even if they look binary
+      --assume-text        Escape stdin even if it looks binary (by default
+                           that is an error, to spare the terminal)
+      --state-file <PATH>  Checkpoint progress of a run writing to --output
+      --resume             Continue an interrupted run from its --state-file
+      --keep-going         Report records and files that fail and carry on,
+                           exiting with status 1 at the end
+      --error-summary      With --keep-going, print errors grouped by kind
+                           with counts and examples at the end
+      --report <FORMAT>    Print records, changes, failures and time for each
+                           input at the end, as a text table or json
+      --trace <FILE>       Log each record's index, source, what was done to
+                           it and how long it took to FILE as NDJSON, as an
+                           audit trail
+      --per-file-stats     Print record bytes (less line endings), escapes and
+                           invalid UTF-8 bytes for each input at the end, to
+                           find the sources of problematic strings
+      --timings            Print the time spent reading, transforming and
+                           writing at the end, to tell whether a slow run is
+                           I/O-bound or CPU-bound
+      --sniff              Describe each input instead of transforming it:
+                           likely encoding, byte order mark, newlines, how
+                           much escaping would change and invalid sequences
+
+Commands:
+  check-file [--format nagios] [--ndjson] FILE...
+                           Check that each line of the files is a properly
+                           escaped string (or a JSON document with --ndjson)
+                           and report OK/WARNING/CRITICAL per file, with
+                           thresholds set by --warning N and --critical N
+  cmp [--files] A B        Tell whether two escaped strings (or files holding
+                           them) decode to the same string, and where they
+                           first differ in content or in escaping
+  daemon [--socket PATH] [--log-backend BACKEND]
+                           Serve --use-daemon clients on a unix socket
+  gen-corpus --out <DIR> [--count N] [--seed N]
+                           Write a reproducible corpus of tricky strings, raw
+                           and escaped, for seeding parser fuzzers
+  grep [--field PATH]... [-i] [-v] [-c] [-n] PATTERN [FILE...]
+                           Print the NDJSON lines whose string values (or
+                           those at the --field paths) match PATTERN once
+                           unescaped, so \u escapes can't hide a match
+  normalize-corpus --out <DIR> [--ascii] [--html-safe] <DIR>
+                           Unescape and re-escape every file of a corpus of
+                           fixtures canonically, dropping duplicates, into a
+                           new tree
+  selftest [--matrix] [--count N] [--seed N]
+                           Round-trip random strings through every
+                           combination of escaping flags and check the
+                           results against encoding/json
 
 Other Options:
   -h, --help               Show this help message
   -V, --version            Show version information
       --completion <SHELL> Generate shell completion (bash, zsh, fish)
+      --use-daemon[=SOCKET]
+                           Hand the work to '%s daemon' to skip process
+                           startup; runs normally if no daemon answers
+      --log-backend <BACKEND>
+                           Send errors, warnings and reports to stderr
+                           (default), syslog, journald or file:<PATH>
+      --no-simd            Scan for characters to escape a byte at a time
+                           instead of a word at a time (amd64, arm64)
+      --cache[=N]          Remember the results for the last N distinct
+                           records (default 4096) and reuse them for repeats,
+                           such as duplicate lines in logs
+      --lang <LANG>        Language for messages: en, de, es or fr (default
+                           from LC_ALL, LC_MESSAGES or LANG)
 
 Examples:
   # Escape a string from argument
@@ -631,12 +2495,23 @@ Examples:
   # Process null-delimited input (handles strings with newlines)
   find . -print0 | %s -0
 
+  # Build an auth payload without the password showing up anywhere
+  %s -q --secret-prompt
+
+  # Normalize the string escaping of a whole JSON document
+  %s --rewrite-strings --ascii -f data.json
+
 Exit Codes:
   0    Success
   1    Error during processing
   2    Invalid usage
 `
-	fmt.Fprintf(w, help, name, name, name, name, name, name, name, name)
+	// Headings and the like are translated line by line
+	lines := strings.Split(help, "\n")
+	for i, line := range lines {
+		lines[i] = msgs.format(line)
+	}
+	fmt.Fprintf(w, strings.Join(lines, "\n"), name, name, name, name, name, name, name, name, name, name, name, name)
 }
 
 func generateCompletion(shell string, stdout, stderr io.Writer) int {
@@ -660,10 +2535,10 @@ _jsonescape() {
     COMPREPLY=()
     cur="${COMP_WORDS[COMP_CWORD]}"
     prev="${COMP_WORDS[COMP_CWORD-1]}"
-    opts="-h --help -V --version -u --unescape -q --quote -r --raw -f --file -o --output -l --lines -0 --null -a --ascii --html-safe -s --strict --replace --stdin --completion"
+    opts="-h --help -V --version -u --unescape -q --quote --smart-quotes --output-separator -r --raw -Z --print0 --record-separator --final-newline -f --file --label -o --output --tee --append --atomic -i --in-place --confirm --unbuffered -l --lines -0 --null --delimiter --framing -j --jobs --unordered --stream --flush-bytes -a --ascii --html-safe -s --strict --replace --strict-hex --pedantic --controls --map-file --wrap-column --wrap-style --host --emit-concat --emit-bytes --heredoc --with-original --grep-escape --predict-length --diff-output --output-encoding --shard-size --output-pattern --rewrite-strings --ndjson-in --fields --allow-comments --allow-trailing-commas --sort-keys --dup-keys --between --between-regex --subst --subst-template --max-expansion-ratio --skip-binary --force-binary --assume-text --state-file --resume --keep-going --error-summary --report --per-file-stats --timings --sniff --trace --stdin --args-are-files --literal-args --secret-prompt --multiline-prompt --stdio-server --use-daemon --log-backend --no-simd --cache --lang --completion"
 
     case "${prev}" in
-        -f|--file|-o|--output)
+        -f|--file|-o|--output|--state-file|--output-pattern|--trace|--map-file)
             COMPREPLY=( $(compgen -f -- "${cur}") )
             return 0
             ;;
@@ -671,6 +2546,54 @@ _jsonescape() {
             COMPREPLY=( $(compgen -W "bash zsh fish" -- "${cur}") )
             return 0
             ;;
+        --final-newline)
+            COMPREPLY=( $(compgen -W "always never preserve" -- "${cur}") )
+            return 0
+            ;;
+        --framing)
+            COMPREPLY=( $(compgen -W "varint u32le" -- "${cur}") )
+            return 0
+            ;;
+        --dup-keys)
+            COMPREPLY=( $(compgen -W "error first last" -- "${cur}") )
+            return 0
+            ;;
+        --controls)
+            COMPREPLY=( $(compgen -W "escape strip replace: error" -- "${cur}") )
+            return 0
+            ;;
+        --wrap-style)
+            COMPREPLY=( $(compgen -W "backslash concat" -- "${cur}") )
+            return 0
+            ;;
+        --emit-concat)
+            COMPREPLY=( $(compgen -W "go python c js" -- "${cur}") )
+            return 0
+            ;;
+        --host)
+            COMPREPLY=( $(compgen -W "single-quote double-quote backtick" -- "${cur}") )
+            return 0
+            ;;
+        --emit-bytes)
+            COMPREPLY=( $(compgen -W "go c python" -- "${cur}") )
+            return 0
+            ;;
+        --report)
+            COMPREPLY=( $(compgen -W "text json" -- "${cur}") )
+            return 0
+            ;;
+        --lang)
+            COMPREPLY=( $(compgen -W "en de es fr" -- "${cur}") )
+            return 0
+            ;;
+        --log-backend)
+            COMPREPLY=( $(compgen -W "stderr syslog journald file:" -- "${cur}") )
+            return 0
+            ;;
+        --output-encoding)
+            COMPREPLY=( $(compgen -W "utf-8 utf-8-bom utf-16le" -- "${cur}") )
+            return 0
+            ;;
     esac
 
     if [[ ${cur} == -* ]]; then
@@ -693,23 +2616,95 @@ _jsonescape() {
         '--unescape[Unescape mode]' \
         '-q[Wrap in quotes]' \
         '--quote[Wrap in quotes]' \
+        '--smart-quotes[Keep or drop the quotes of a quoted JSON string input]' \
+        '--output-separator[Separator written between records]:separator:' \
         '-r[Raw output]' \
         '--raw[Raw output]' \
+        '-Z[NUL after each record]' \
+        '--print0[NUL after each record]' \
+        '--record-separator[Separator written after each record]:separator:' \
+        '--final-newline[How the last record ends]:when:(always never preserve)' \
         '-f[Input file]:file:_files' \
         '--file[Input file]:file:_files' \
+        '--label[Name for the next input]:name:' \
         '-o[Output file]:file:_files' \
         '--output[Output file]:file:_files' \
+        '--tee[Write output to stdout too]' \
+        '--append[Append to the output file]' \
+        '--atomic[Rename output into place on success]' \
+        '-i-[Rewrite files in place]::suffix:' \
+        '--in-place=-[Rewrite files in place]::suffix:' \
+        '--confirm=-[Ask before rewriting each file]::all:(all)' \
+        '--unbuffered[Write each record out at once]' \
+        '--wrap-column[Wrap output at column]:column:' \
+        '--wrap-style[Line break style]:style:(backslash concat)' \
+        '--emit-concat[Emit concatenated literals]:language:(go python c js)' \
+        '--host[Also escape the host string delimiter]:delimiter:(single-quote double-quote backtick)' \
+        '--emit-bytes[Emit a byte literal]:language:(go c python)' \
+        '--heredoc=-[Wrap in shell heredoc]::marker:' \
+        '--with-original=-[Write the input before each output]::separator:' \
+        '--grep-escape[Print records containing these escapes]:escapes:' \
+        '--predict-length[Print escaped lengths instead]' \
+        '--diff-output[Print unified diff per file]' \
+        '--output-encoding[Output encoding]:encoding:(utf-8 utf-8-bom utf-16le)' \
+        '--shard-size[Records or bytes per output shard]:size:' \
+        '--output-pattern[Shard file names with {shard}]:pattern:_files' \
         '-l[Line mode]' \
         '--lines[Line mode]' \
         '-0[Null-delimited input]' \
         '--null[Null-delimited input]' \
+        '--delimiter[Input record delimiter]:delimiter:' \
+        '--framing[Length-prefixed records]:format:(varint u32le)' \
+        '-j[Worker threads for records]:workers:' \
+        '--jobs[Worker threads for records]:workers:' \
+        '--unordered[Write files in the order they finish]' \
+        '--stream[Process input a chunk at a time]' \
+        '--flush-bytes[Write out every N bytes of input]:bytes:' \
         '-a[ASCII only]' \
         '--ascii[ASCII only]' \
         '--html-safe[HTML safe escaping]' \
         '-s[Strict UTF-8]' \
         '--strict[Strict UTF-8]' \
         '--replace[Replace invalid UTF-8]' \
+        '--strict-hex[Reject non-standard unicode escapes]' \
+        '--pedantic[Every strictness check on, warnings are errors]' \
+        '--controls[Control character policy]:policy:(escape strip replace\: error)' \
+        '--map-file[Literal replacements to make first]:file:_files' \
+        '--rewrite-strings[Re-encode strings in a JSON document]' \
+        '--ndjson-in[One JSON document per line]' \
+        '--fields[Only re-encode strings at these paths]:paths:' \
+        '--allow-comments[Accept comments in documents]' \
+        '--allow-trailing-commas[Accept trailing commas in documents]' \
+        '--sort-keys[Sort object members by key]' \
+        '--dup-keys[Policy for repeated keys]:policy:(error first last)' \
+        '--between[Transform only text between two markers]:start marker: :end marker: ' \
+        '--between-regex[Transform only text between two patterns]:start pattern: :end pattern: ' \
+        '--subst[Replace matches of a pattern with their escaped form]:pattern: ' \
+        '--subst-template[Template to replace --subst matches with]:template: ' \
+        '--max-expansion-ratio[Limit output size relative to input]:ratio:' \
+        '--skip-binary[Skip binary input files]' \
+        '--force-binary[Process binary input files]' \
+        '--assume-text[Escape stdin even if it looks binary]' \
+        '--state-file[Checkpoint progress]:file:_files' \
+        '--resume[Continue an interrupted run]' \
+        '--keep-going[Carry on after errors]' \
+        '--error-summary[Group errors by kind]' \
+        '--report[Per-input report]:format:(text json)' \
+        '--per-file-stats[Per-input escape statistics]' \
+        '--timings[Time spent reading, transforming and writing]' \
+        '--sniff[Describe each input instead of transforming it]' \
+        '--trace[Log each record as NDJSON]:file:_files' \
         '--stdin[Read from stdin]' \
+        '--args-are-files[Treat arguments as files]' \
+        '--literal-args[No warning for arguments naming files]' \
+        '--secret-prompt[Read a secret without echo]' \
+        '--multiline-prompt=-[Read a block up to a terminator line]::terminator:' \
+        '--stdio-server[Answer length-prefixed requests on stdin]' \
+        '--use-daemon=-[Run in a running daemon]::socket:_files' \
+        '--log-backend[Where diagnostics go]:backend:(stderr syslog journald file\:)' \
+        '--no-simd[Scan a byte at a time]' \
+        '--cache=-[Reuse results for repeated records]::size:' \
+        '--lang[Language for messages]:language:(en de es fr)' \
         '--completion[Generate completion]:shell:(bash zsh fish)'
 }
 `
@@ -719,15 +2714,84 @@ complete -c jsonescape -s h -l help -d 'Show help'
 complete -c jsonescape -s V -l version -d 'Show version'
 complete -c jsonescape -s u -l unescape -d 'Unescape mode'
 complete -c jsonescape -s q -l quote -d 'Wrap in quotes'
+complete -c jsonescape -l smart-quotes -d 'Keep or drop the quotes of a quoted JSON string input'
+complete -c jsonescape -l output-separator -x -d 'Separator written between records'
 complete -c jsonescape -s r -l raw -d 'Raw output (no trailing newline)'
+complete -c jsonescape -s Z -l print0 -d 'NUL after each record'
+complete -c jsonescape -l record-separator -x -d 'Separator written after each record'
+complete -c jsonescape -l final-newline -xa 'always never preserve' -d 'How the last record ends'
 complete -c jsonescape -s f -l file -r -d 'Input file'
+complete -c jsonescape -l label -x -d 'Name for the next input'
 complete -c jsonescape -s o -l output -r -d 'Output file'
+complete -c jsonescape -l tee -d 'Write output to stdout too'
+complete -c jsonescape -l append -d 'Append to the output file'
+complete -c jsonescape -l atomic -d 'Rename output into place on success'
+complete -c jsonescape -s i -l in-place -d 'Rewrite files in place'
+complete -c jsonescape -l confirm -d 'Ask before rewriting each file'
+complete -c jsonescape -l unbuffered -d 'Write each record out at once'
+complete -c jsonescape -l wrap-column -x -d 'Wrap output at column'
+complete -c jsonescape -l wrap-style -xa 'backslash concat' -d 'Line break style'
+complete -c jsonescape -l emit-concat -xa 'go python c js' -d 'Emit concatenated literals'
+complete -c jsonescape -l host -xa 'single-quote double-quote backtick' -d 'Also escape the host string delimiter'
+complete -c jsonescape -l emit-bytes -xa 'go c python' -d 'Emit a byte literal'
+complete -c jsonescape -l heredoc -d 'Wrap in shell heredoc'
+complete -c jsonescape -l with-original -d 'Write the input before each output'
+complete -c jsonescape -l grep-escape -x -d 'Print records containing these escapes'
+complete -c jsonescape -l predict-length -d 'Print escaped lengths instead'
+complete -c jsonescape -l diff-output -d 'Print unified diff per file'
+complete -c jsonescape -l output-encoding -xa 'utf-8 utf-8-bom utf-16le' -d 'Output encoding'
+complete -c jsonescape -l shard-size -x -d 'Records or bytes per output shard'
+complete -c jsonescape -l output-pattern -r -d 'Shard file names with {shard}'
 complete -c jsonescape -s l -l lines -d 'Process each line separately'
 complete -c jsonescape -s 0 -l null -d 'Null-delimited input'
+complete -c jsonescape -l delimiter -x -d 'Input record delimiter'
+complete -c jsonescape -l framing -xa 'varint u32le' -d 'Length-prefixed records'
+complete -c jsonescape -s j -l jobs -x -d 'Worker threads for records'
+complete -c jsonescape -l unordered -d 'Write files in the order they finish'
+complete -c jsonescape -l stream -d 'Process input a chunk at a time'
+complete -c jsonescape -l flush-bytes -x -d 'Write out every N bytes of input'
 complete -c jsonescape -s a -l ascii -d 'Escape non-ASCII as \\uXXXX'
 complete -c jsonescape -l html-safe -d 'Escape <, >, & for HTML'
 complete -c jsonescape -s s -l strict -d 'Reject invalid UTF-8'
 complete -c jsonescape -l replace -d 'Replace invalid UTF-8'
+complete -c jsonescape -l strict-hex -d 'Reject non-standard unicode escapes'
+complete -c jsonescape -l pedantic -d 'Every strictness check on, warnings are errors'
+complete -c jsonescape -l controls -xa 'escape strip replace: error' -d 'Control character policy'
+complete -c jsonescape -l map-file -r -d 'Literal replacements to make first'
+complete -c jsonescape -l rewrite-strings -d 'Re-encode strings in a JSON document'
+complete -c jsonescape -l ndjson-in -d 'One JSON document per line'
+complete -c jsonescape -l fields -x -d 'Only re-encode strings at these paths'
+complete -c jsonescape -l allow-comments -d 'Accept comments in documents'
+complete -c jsonescape -l allow-trailing-commas -d 'Accept trailing commas in documents'
+complete -c jsonescape -l sort-keys -d 'Sort object members by key'
+complete -c jsonescape -l dup-keys -xa 'error first last' -d 'Policy for repeated keys'
+complete -c jsonescape -l between -r -d 'Transform only text between two markers'
+complete -c jsonescape -l between-regex -r -d 'Transform only text between two patterns'
+complete -c jsonescape -l subst -r -d 'Replace matches of a pattern with their escaped form'
+complete -c jsonescape -l subst-template -r -d 'Template to replace --subst matches with'
+complete -c jsonescape -l max-expansion-ratio -x -d 'Limit output size relative to input'
+complete -c jsonescape -l skip-binary -d 'Skip binary input files'
+complete -c jsonescape -l force-binary -d 'Process binary input files'
+complete -c jsonescape -l assume-text -d 'Escape stdin even if it looks binary'
+complete -c jsonescape -l state-file -r -d 'Checkpoint progress'
+complete -c jsonescape -l resume -d 'Continue an interrupted run'
+complete -c jsonescape -l keep-going -d 'Carry on after errors'
+complete -c jsonescape -l error-summary -d 'Group errors by kind'
+complete -c jsonescape -l report -xa 'text json' -d 'Per-input report'
+complete -c jsonescape -l per-file-stats -d 'Per-input escape statistics'
+complete -c jsonescape -l timings -d 'Time spent reading, transforming and writing'
+complete -c jsonescape -l sniff -d 'Describe each input instead of transforming it'
+complete -c jsonescape -l trace -r -d 'Log each record as NDJSON'
 complete -c jsonescape -l stdin -d 'Read from stdin'
+complete -c jsonescape -l args-are-files -d 'Treat arguments as files'
+complete -c jsonescape -l literal-args -d 'No warning for arguments naming files'
+complete -c jsonescape -l secret-prompt -d 'Read a secret without echo'
+complete -c jsonescape -l multiline-prompt -d 'Read a block up to a terminator line'
+complete -c jsonescape -l stdio-server -d 'Answer length-prefixed requests on stdin'
+complete -c jsonescape -l use-daemon -d 'Run in a running daemon'
+complete -c jsonescape -l log-backend -xa 'stderr syslog journald file:' -d 'Where diagnostics go'
+complete -c jsonescape -l no-simd -d 'Scan a byte at a time'
+complete -c jsonescape -l cache -d 'Reuse results for repeated records'
+complete -c jsonescape -l lang -xa 'en de es fr' -d 'Language for messages'
 complete -c jsonescape -l completion -xa 'bash zsh fish' -d 'Generate shell completion'
 `
\ No newline at end of file
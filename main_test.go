@@ -2,221 +2,78 @@ package main
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 )
 
-func TestJsonEscape(t *testing.T) {
+func TestLenientHexWarning(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	run([]string{"-u", `\U0041`, `\U0042`}, strings.NewReader(""), &stdout, &stderr)
+	if stdout.String() != "A\nB\n" || strings.Count(stderr.String(), "--strict-hex") != 1 {
+		t.Errorf("stdout = %q, stderr = %q, want A and B with one warning", stdout.String(), stderr.String())
+	}
+	stdout.Reset()
+	if exitCode := run([]string{"-u", "--strict-hex", `\U0041`}, strings.NewReader(""), &stdout, &stderr); exitCode != 1 {
+		t.Errorf("exit code = %d, want 1 with --strict-hex", exitCode)
+	}
+}
+
+func TestSmartQuotes(t *testing.T) {
 	tests := []struct {
-		name      string
-		input     string
-		asciiOnly bool
-		htmlSafe  bool
-		expected  string
+		name     string
+		args     []string
+		input    string
+		expected string
 	}{
-		{
-			name:     "simple string",
-			input:    "hello world",
-			expected: "hello world",
-		},
-		{
-			name:     "quotes",
-			input:    `say "hello"`,
-			expected: `say \"hello\"`,
-		},
-		{
-			name:     "backslash",
-			input:    `path\to\file`,
-			expected: `path\\to\\file`,
-		},
-		{
-			name:     "newline",
-			input:    "line1\nline2",
-			expected: `line1\nline2`,
-		},
-		{
-			name:     "tab",
-			input:    "col1\tcol2",
-			expected: `col1\tcol2`,
-		},
-		{
-			name:     "carriage return",
-			input:    "line1\r\nline2",
-			expected: `line1\r\nline2`,
-		},
-		{
-			name:     "all special chars",
-			input:    "\b\f\n\r\t\"\\",
-			expected: `\b\f\n\r\t\"\\`,
-		},
-		{
-			name:     "control characters",
-			input:    "hello\x00\x1fworld",
-			expected: `hello\u0000\u001fworld`,
-		},
-		{
-			name:     "unicode preserved",
-			input:    "日本語",
-			expected: "日本語",
-		},
-		{
-			name:      "unicode escaped with ascii mode",
-			input:     "日本語",
-			asciiOnly: true,
-			expected:  `\u65e5\u672c\u8a9e`,
-		},
-		{
-			name:      "emoji with ascii mode",
-			input:     "Hello 👋",
-			asciiOnly: true,
-			expected:  `Hello \ud83d\udc4b`,
-		},
-		{
-			name:     "html characters preserved by default",
-			input:    "<script>&</script>",
-			expected: "<script>&</script>",
-		},
-		{
-			name:     "html characters escaped in html-safe mode",
-			input:    "<script>&</script>",
-			htmlSafe: true,
-			expected: `\u003cscript\u003e\u0026\u003c/script\u003e`,
-		},
+		{"escape quoted", []string{"--smart-quotes", "-a"}, `"café \"x\""` + "\n", `"caf\u00e9 \"x\""` + "\n"},
+		{"escape quoted with quote", []string{"--smart-quotes", "-q"}, `"a"`, `"a"` + "\n"},
+		{"unescape quoted", []string{"--smart-quotes", "-u"}, `"a\tb\"c"`, "a\tb\"c\n"},
+		{"escape unquoted", []string{"--smart-quotes"}, `plain"`, `plain\"` + "\n"},
+		{"escape invalid quoted", []string{"--smart-quotes"}, `"a"b"`, `\"a\"b\"` + "\n"},
+		{"unescape bad escape", []string{"--smart-quotes", "-u"}, `"\q"`, ""},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := jsonEscape(tt.input, tt.asciiOnly, tt.htmlSafe)
-			if result != tt.expected {
-				t.Errorf("jsonEscape(%q, %v, %v) = %q, want %q",
-					tt.input, tt.asciiOnly, tt.htmlSafe, result, tt.expected)
+			var stdout, stderr bytes.Buffer
+			run(tt.args, strings.NewReader(tt.input), &stdout, &stderr)
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q (stderr: %s)", stdout.String(), tt.expected, stderr.String())
 			}
 		})
 	}
 }
 
-func TestJsonUnescape(t *testing.T) {
+func TestPedantic(t *testing.T) {
 	tests := []struct {
 		name     string
-		input    string
+		args     []string
 		expected string
-		wantErr  bool
+		exitCode int
 	}{
-		{
-			name:     "simple string",
-			input:    "hello world",
-			expected: "hello world",
-		},
-		{
-			name:     "escaped quotes",
-			input:    `say \"hello\"`,
-			expected: `say "hello"`,
-		},
-		{
-			name:     "escaped backslash",
-			input:    `path\\to\\file`,
-			expected: `path\to\file`,
-		},
-		{
-			name:     "escaped newline",
-			input:    `line1\nline2`,
-			expected: "line1\nline2",
-		},
-		{
-			name:     "escaped tab",
-			input:    `col1\tcol2`,
-			expected: "col1\tcol2",
-		},
-		{
-			name:     "all escapes",
-			input:    `\b\f\n\r\t\"\\\/`,
-			expected: "\b\f\n\r\t\"\\/",
-		},
-		{
-			name:     "unicode escape",
-			input:    `\u0048\u0065\u006c\u006c\u006f`,
-			expected: "Hello",
-		},
-		{
-			name:     "unicode japanese",
-			input:    `\u65e5\u672c\u8a9e`,
-			expected: "日本語",
-		},
-		{
-			name:     "surrogate pair",
-			input:    `\ud83d\udc4b`,
-			expected: "👋",
-		},
-		{
-			name:     "mixed content",
-			input:    `Hello\nWorld \u0021`,
-			expected: "Hello\nWorld !",
-		},
-		{
-			name:    "incomplete escape",
-			input:   `hello\`,
-			wantErr: true,
-		},
-		{
-			name:    "invalid escape char",
-			input:   `hello\x`,
-			wantErr: true,
-		},
-		{
-			name:    "incomplete unicode",
-			input:   `hello\u00`,
-			wantErr: true,
-		},
-		{
-			name:    "invalid unicode hex",
-			input:   `hello\uXXXX`,
-			wantErr: true,
-		},
+		{"clean", []string{"--pedantic", "a\tb"}, `a\tb` + "\n", 0},
+		{"invalid UTF-8", []string{"--pedantic", "a\xffb"}, "", 1},
+		{"lenient hex", []string{"--pedantic", "-u", `\U0041`}, "", 1},
+		{"warning", []string{"--pedantic", "-r", "a", "b"}, "ab", 1},
+		{"warning without pedantic", []string{"-r", "a", "b"}, "ab", 0},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := jsonUnescape(tt.input)
-			if tt.wantErr {
-				if err == nil {
-					t.Errorf("jsonUnescape(%q) expected error, got nil", tt.input)
-				}
-				return
-			}
-			if err != nil {
-				t.Errorf("jsonUnescape(%q) unexpected error: %v", tt.input, err)
-				return
-			}
-			if result != tt.expected {
-				t.Errorf("jsonUnescape(%q) = %q, want %q", tt.input, result, tt.expected)
+			var stdout, stderr bytes.Buffer
+			exitCode := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+			if exitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", exitCode, tt.exitCode, stderr.String())
 			}
-		})
-	}
-}
-
-func TestRoundTrip(t *testing.T) {
-	tests := []string{
-		"hello world",
-		"line1\nline2\nline3",
-		`quotes "and" 'stuff'`,
-		"日本語テスト",
-		"emoji: 👋🌍🎉",
-		"\x00\x01\x02\x1f",
-		"mixed: hello\tworld\n日本語",
-	}
-
-	for _, input := range tests {
-		t.Run(input[:min(20, len(input))], func(t *testing.T) {
-			escaped := jsonEscape(input, false, false)
-			unescaped, err := jsonUnescape(escaped)
-			if err != nil {
-				t.Errorf("round trip failed: escape(%q) = %q, unescape error: %v",
-					input, escaped, err)
-				return
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
 			}
-			if unescaped != input {
-				t.Errorf("round trip failed: escape(%q) = %q, unescape = %q",
-					input, escaped, unescaped)
+			if tt.exitCode == 1 && !strings.HasPrefix(stderr.String(), "Error: ") {
+				t.Errorf("stderr = %q, want an error", stderr.String())
 			}
 		})
 	}
@@ -347,6 +204,191 @@ func TestNullDelimited(t *testing.T) {
 	}
 }
 
+func TestDelimiter(t *testing.T) {
+	tests := []struct {
+		delim    string
+		input    string
+		expected string
+	}{
+		{`\u001e`, "one\x1etwo\\n\x1ethree", "one\ntwo\\\\n\nthree\n"},
+		{"\n---\n", "a\n-\n---\nb\n---\n", "a\\n-\nb\n"},
+		{"ab", "xaaby", "xa\ny\n"},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if exitCode := run([]string{"--delimiter", tt.delim}, strings.NewReader(tt.input), &stdout, &stderr); exitCode != 0 {
+			t.Fatalf("%q: exit code = %d, want 0 (stderr: %s)", tt.delim, exitCode, stderr.String())
+		}
+		if stdout.String() != tt.expected {
+			t.Errorf("%q: stdout = %q, want %q", tt.delim, stdout.String(), tt.expected)
+		}
+	}
+
+	// Records are located by the line they start on
+	var stdout, stderr bytes.Buffer
+	run([]string{"-u", "--delimiter", ";"}, strings.NewReader("ok\n;bad \\q;"), &stdout, &stderr)
+	if !strings.Contains(stderr.String(), "-:2: unescaping") {
+		t.Errorf("stderr = %q, want the error at -:2", stderr.String())
+	}
+}
+
+func TestRecordSeparator(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--record-separator", ",", "a", "b"}, "a,b,"},
+		{[]string{"--record-separator=\\u0000", "a", "b"}, "a\x00b\x00"},
+		{[]string{"-0", "--record-separator", "\\t"}, "one\ttwo\t"},
+		{[]string{"--record-separator=,", "-r", "a"}, "a"},
+		{[]string{"-0uZ"}, "one\x00two\x00"},
+		{[]string{"--print0", "a\nb"}, "a\\nb\x00"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		run(tt.args, strings.NewReader("one\x00two\x00"), &stdout, &stderr)
+		if stdout.String() != tt.expected {
+			t.Errorf("%v: stdout = %q, want %q", tt.args, stdout.String(), tt.expected)
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("%v: unexpected stderr %q", tt.args, stderr.String())
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	run([]string{"-r", "a", "b", "c"}, strings.NewReader(""), &stdout, &stderr)
+	if stdout.String() != "abc" {
+		t.Errorf("stdout = %q, want %q", stdout.String(), "abc")
+	}
+	if strings.Count(stderr.String(), "Warning:") != 1 || !strings.Contains(stderr.String(), "--record-separator") {
+		t.Errorf("stderr = %q, want one warning about --record-separator", stderr.String())
+	}
+}
+
+func TestWithOriginal(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	run([]string{"-l", "--with-original"}, strings.NewReader("plain\nsay \"hi\"\n"), &stdout, &stderr)
+	expected := "plain\tplain\nsay \"hi\"\tsay \\\"hi\\\"\n"
+	if stdout.String() != expected {
+		t.Errorf("stdout = %q, want %q", stdout.String(), expected)
+	}
+
+	stdout.Reset()
+	run([]string{"-q", "--with-original= => ", "a\tb"}, strings.NewReader(""), &stdout, &stderr)
+	if expected := "a\tb => \"a\\tb\"\n"; stdout.String() != expected {
+		t.Errorf("stdout = %q, want %q", stdout.String(), expected)
+	}
+}
+
+func TestFinalNewline(t *testing.T) {
+	tests := []struct {
+		args     []string
+		stdin    string
+		expected string
+	}{
+		{[]string{"-l", "--final-newline=never"}, "a\nb\n", "a\nb"},
+		{[]string{"-l", "-r", "--final-newline=always"}, "a\nb", "ab\n"},
+		{[]string{"-l", "--final-newline=preserve"}, "a\nb", "a\nb"},
+		{[]string{"-l", "--final-newline=preserve"}, "a\nb\r\n", "a\nb\n"},
+		{[]string{"--final-newline=preserve"}, "x\n", "x\n"},
+		{[]string{"--final-newline=preserve", "--stream"}, "x", "x"},
+		{[]string{"--final-newline", "always", "--record-separator", ", ", "one", "two"}, "", "one, two\n"},
+		{[]string{"--final-newline=never", "--stream", "-q", "-f", "/dev/null", "--stdin"}, "x\n", "\"\"\n\"x\""},
+		{[]string{"-q", "-l", "--output-separator", ","}, "a\nb\nc\n", `"a","b","c"`},
+		{[]string{"--output-separator=\\t", "--final-newline=always", "one", "two"}, "", "one\ttwo\n"},
+		{[]string{"--output-separator", "", "one", "two"}, "", "onetwo"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		exitCode := run(append(tt.args, "--assume-text"), strings.NewReader(tt.stdin), &stdout, &stderr)
+		if exitCode != 0 || stdout.String() != tt.expected {
+			t.Errorf("%v on %q = %d, %q, want 0, %q (stderr %q)", tt.args, tt.stdin, exitCode, stdout.String(), tt.expected, stderr.String())
+		}
+	}
+}
+
+func TestJoinedWarning(t *testing.T) {
+	const warning = "records are written with nothing between them"
+	tests := []struct {
+		args []string
+		warn bool
+	}{
+		{[]string{"-r", "one", "two"}, true},
+		{[]string{"-r", "one"}, false},
+		{[]string{"--record-separator", "", "one", "two"}, false},
+		{[]string{"--output-separator", "", "one", "two"}, false},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if exitCode := run(tt.args, strings.NewReader(""), &stdout, &stderr); exitCode != 0 {
+			t.Fatalf("%v: exit code = %d, want 0 (stderr: %s)", tt.args, exitCode, stderr.String())
+		}
+		if got := strings.Contains(stderr.String(), warning); got != tt.warn {
+			t.Errorf("%v: stderr = %q, want the warning %v", tt.args, stderr.String(), tt.warn)
+		}
+	}
+}
+
+func TestRecordMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		input    string
+		expected Record
+	}{
+		{
+			name:     "whole input",
+			input:    "hello\n",
+			expected: Record{Index: 0, Source: "-", Line: 1, Offset: 0, Changed: false, Newline: true},
+		},
+		{
+			name:     "lines with CRLF",
+			config:   Config{LineMode: true},
+			input:    "a\r\nbb\nc\"c",
+			expected: Record{Index: 2, Source: "-", Line: 3, Offset: 6, Changed: true},
+		},
+		{
+			name:     "null-delimited with embedded newline",
+			config:   Config{NullDelimited: true},
+			input:    "a\x00b\nc\x00d",
+			expected: Record{Index: 2, Source: "-", Line: 2, Offset: 6, Changed: false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			proc := &Processor{Config: &tt.config, Output: &stdout, Stderr: &stdout}
+			if err := proc.ProcessReader(strings.NewReader(tt.input)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if proc.record != tt.expected {
+				t.Errorf("last record = %+v, want %+v", proc.record, tt.expected)
+			}
+		})
+	}
+}
+
+func TestErrorLocation(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"-u", "-l"}, strings.NewReader("ok\\n\nbad\\x\n"), &stdout, &stderr)
+	if exitCode != 1 {
+		t.Fatalf("exit code = %d, want 1", exitCode)
+	}
+	if !strings.Contains(stderr.String(), "-:2: unescaping") {
+		t.Errorf("stderr = %q, want location -:2", stderr.String())
+	}
+
+	stderr.Reset()
+	run([]string{"-u", "ok", `bad\x`}, strings.NewReader(""), &stdout, &stderr)
+	if !strings.Contains(stderr.String(), "argument 2: unescaping") {
+		t.Errorf("stderr = %q, want location argument 2", stderr.String())
+	}
+}
+
 func TestCombinedFlags(t *testing.T) {
 	var stdout, stderr bytes.Buffer
 
@@ -378,6 +420,127 @@ func TestDoubleDash(t *testing.T) {
 	}
 }
 
+func TestArgsAreFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	os.WriteFile(a, []byte("say \"hi\"\n"), 0o644)
+	os.WriteFile(b, []byte("tab\there"), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"--args-are-files", a, b}, strings.NewReader(""), &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	expected := `say \"hi\"` + "\n" + `tab\there` + "\n"
+	if stdout.String() != expected {
+		t.Errorf("stdout = %q, want %q", stdout.String(), expected)
+	}
+
+	stdout.Reset()
+	exitCode = run([]string{"--args-are-files", filepath.Join(dir, "missing")}, strings.NewReader(""), &stdout, &stderr)
+	if exitCode != 1 {
+		t.Errorf("exit code = %d, want 1 for a missing file", exitCode)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "tmp-1234.txt")
+	b := filepath.Join(dir, "tmp-5678.txt")
+	os.WriteFile(a, []byte(`ok\n`), 0o644)
+	os.WriteFile(b, []byte(`bad \q`), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-u", "--keep-going", "--report", "text", "-f", a, "--label", "prod-logs", "-f", b, "--label", "staging-logs", "--stdin", "--label", "piped"}
+	exitCode := run(args, strings.NewReader(`\q`), &stdout, &stderr)
+	if exitCode != 1 {
+		t.Errorf("exit code = %d, want 1", exitCode)
+	}
+	for _, want := range []string{"Error: staging-logs:1: unescaping", "Error: piped:1: unescaping", "\nprod-logs ", "\nstaging-logs "} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("stderr = %q, want it to contain %q", stderr.String(), want)
+		}
+	}
+	if strings.Contains(stderr.String(), "tmp-") {
+		t.Errorf("stderr = %q, want labels instead of paths", stderr.String())
+	}
+}
+
+func TestArgNamingFileWarning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	os.WriteFile(path, []byte("content"), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	run([]string{path}, strings.NewReader(""), &stdout, &stderr)
+	if !strings.Contains(stderr.String(), "Warning: argument 1") || !strings.Contains(stderr.String(), "--file") {
+		t.Errorf("stderr = %q, want a warning suggesting --file", stderr.String())
+	}
+	if stdout.String() != path+"\n" {
+		t.Errorf("stdout = %q, want the name itself", stdout.String())
+	}
+
+	stderr.Reset()
+	run([]string{"--literal-args", path, "not a file"}, strings.NewReader(""), &stdout, &stderr)
+	if stderr.Len() != 0 {
+		t.Errorf("stderr = %q, want no warning with --literal-args", stderr.String())
+	}
+}
+
+func TestControlPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+		exitCode int
+	}{
+		{"escape is default", []string{"a\x07b\nc"}, `a\u0007b\nc` + "\n", 0},
+		{"explicit escape", []string{"--controls=escape", "a\x07b"}, `a\u0007b` + "\n", 0},
+		{"strip", []string{"--controls=strip", "a\x07b\x00c\td"}, `abc\td` + "\n", 0},
+		{"replace", []string{"--controls", "replace:?", "a\x07b"}, "a?b\n", 0},
+		{"replace with escaped char", []string{"--controls=replace:\"", "a\x07b"}, `a\"b` + "\n", 0},
+		{"error", []string{"--controls=error", "a\x07b"}, "", 1},
+		{"error ignores short escapes", []string{"--controls=error", "a\nb"}, `a\nb` + "\n", 0},
+		{"unescape unaffected", []string{"-u", "--controls=strip", `a\u0007b`}, "a\x07b\n", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			exitCode := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+			if exitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", exitCode, tt.exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestMaxExpansionRatio(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode int
+	}{
+		{"within limit", []string{"--max-expansion-ratio=2", `a"b`}, 0},
+		{"control characters exceed limit", []string{"--max-expansion-ratio", "3", "\x00\x00"}, 1},
+		{"unescape shrinks", []string{"-u", "--max-expansion-ratio=1", `\u0000\u0000`}, 0},
+		{"empty input", []string{"--max-expansion-ratio=1", ""}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			exitCode := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+			if exitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", exitCode, tt.exitCode, stderr.String())
+			}
+		})
+	}
+}
+
 func TestParseArgsErrors(t *testing.T) {
 	tests := []struct {
 		name string
@@ -389,6 +552,93 @@ func TestParseArgsErrors(t *testing.T) {
 		{"short output without value", []string{"-o"}},
 		{"strict and replace", []string{"--strict", "--replace"}},
 		{"null and lines", []string{"--null", "--lines"}},
+		{"controls without value", []string{"--controls"}},
+		{"unknown controls policy", []string{"--controls=drop"}},
+		{"replace without char", []string{"--controls=replace"}},
+		{"replace with string", []string{"--controls=replace:ab"}},
+		{"strip with argument", []string{"--controls=strip:x"}},
+		{"wrap column not a number", []string{"--wrap-column=ten"}},
+		{"wrap style without column", []string{"--wrap-style=concat"}},
+		{"unknown wrap style", []string{"--wrap-column=10", "--wrap-style=zigzag"}},
+		{"wrap column with unescape", []string{"-u", "--wrap-column=10"}},
+		{"unknown concat language", []string{"--emit-concat=cobol"}},
+		{"emit concat with wrap style", []string{"--emit-concat=go", "--wrap-column=10", "--wrap-style=concat"}},
+		{"unknown bytes language", []string{"--emit-bytes=rust"}},
+		{"emit bytes with emit concat", []string{"--emit-bytes=go", "--emit-concat=go"}},
+		{"unknown host", []string{"--host=guillemet"}},
+		{"host with unescape", []string{"--host=backtick", "-u"}},
+		{"diff output without files", []string{"--diff-output", "x"}},
+		{"expansion ratio not a number", []string{"--max-expansion-ratio=lots"}},
+		{"expansion ratio not positive", []string{"--max-expansion-ratio=0"}},
+		{"skip and force binary", []string{"--skip-binary", "--force-binary"}},
+		{"rewrite strings with unescape", []string{"--rewrite-strings", "-u"}},
+		{"rewrite strings with lines", []string{"--rewrite-strings", "-l"}},
+		{"ndjson without document mode", []string{"--ndjson-in"}},
+		{"fields without document mode", []string{"--fields=a"}},
+		{"invalid field path", []string{"--rewrite-strings", "--fields=a..b"}},
+		{"comments without document mode", []string{"--allow-comments"}},
+		{"unknown output encoding", []string{"--output-encoding=latin1"}},
+		{"resume without state file", []string{"--resume"}},
+		{"state file without output", []string{"--state-file=s", "x"}},
+		{"error summary without keep going", []string{"--error-summary"}},
+		{"bad record separator", []string{"--record-separator", `\x`}},
+		{"with original in document mode", []string{"--rewrite-strings", "--with-original"}},
+		{"grep escape with unescape", []string{"-u", "--grep-escape", `\n`}},
+		{"daemon with secret prompt", []string{"--use-daemon", "--secret-prompt"}},
+		{"shard size without pattern", []string{"--shard-size=10", "x"}},
+		{"pattern without placeholder", []string{"--shard-size=10", "--output-pattern=out.txt", "x"}},
+		{"pattern with output", []string{"--shard-size=10", "--output-pattern={shard}", "-o", "f", "x"}},
+		{"unknown log backend", []string{"--log-backend=eventlog", "x"}},
+		{"log file without path", []string{"--log-backend=file", "x"}},
+		{"stdio server with arguments", []string{"--stdio-server", "x"}},
+		{"empty multiline terminator", []string{"--multiline-prompt="}},
+		{"multiline prompt with lines", []string{"--multiline-prompt", "-l"}},
+		{"pedantic with replace", []string{"--pedantic", "--replace"}},
+		{"stream with lines", []string{"--stream", "-l"}},
+		{"more labels than inputs", []string{"--label", "a", "--label", "b", "x"}},
+		{"between missing end marker", []string{"--between", "<<"}},
+		{"between empty marker", []string{"--between", "", ">>"}},
+		{"between regex matching empty", []string{"--between-regex", "a*", ">>"}},
+		{"between with lines", []string{"--between", "<<", ">>", "-l"}},
+		{"subst matching empty", []string{"--subst", "x*"}},
+		{"subst invalid template", []string{"--subst", "x", "--subst-template", "{{"}},
+		{"subst template without subst", []string{"--subst-template", "{{.Escaped}}"}},
+		{"subst with between", []string{"--subst", "x", "--between", "<<", ">>"}},
+		{"sniff with unescape", []string{"--sniff", "-u"}},
+		{"cache size zero", []string{"--cache=0", "x"}},
+		{"jobs without lines", []string{"-j", "4", "x"}},
+		{"jobs invalid", []string{"-l", "--jobs", "-1"}},
+		{"unordered without jobs", []string{"--unordered", "-f", "a", "-f", "b"}},
+		{"predict length with unescape", []string{"--predict-length", "-u", "x"}},
+		{"unknown framing", []string{"--framing", "u16be"}},
+		{"framing with lines", []string{"--framing", "varint", "-l"}},
+		{"framing with raw", []string{"--framing", "varint", "-r"}},
+		{"in place without files", []string{"-i.bak", "-l"}},
+		{"in place with output", []string{"-i", "-o", "out.txt", "a.txt"}},
+		{"confirm without in place", []string{"--confirm", "a.txt"}},
+		{"flush bytes without stream", []string{"--flush-bytes", "100", "x"}},
+		{"rewrite strings with max expansion", []string{"--rewrite-strings", "--max-expansion-ratio", "1.1"}},
+		{"wrap column too narrow for concat", []string{"--wrap-column", "4", "--wrap-style", "concat", "x"}},
+		{"wrap column too narrow for emit bytes", []string{"--wrap-column", "8", "--emit-bytes", "go", "x"}},
+		{"flush bytes too small", []string{"--stream", "--flush-bytes", "8"}},
+		{"confirm with a bad value", []string{"-i", "--confirm=some", "a.txt"}},
+		{"confirm with jobs", []string{"-i", "--confirm", "-j", "2", "a.txt", "b.txt"}},
+		{"jobs over files with trace", []string{"-j", "2", "-f", "a", "-f", "b", "--trace", "t.ndjson"}},
+		{"final newline invalid", []string{"--final-newline=sometimes"}},
+		{"final newline with state file", []string{"--final-newline=never", "-o", "x", "--state-file", "s"}},
+		{"atomic without output", []string{"--atomic", "x"}},
+		{"atomic with state file", []string{"--atomic", "-o", "x", "--state-file", "s", "-l"}},
+		{"sort keys without document mode", []string{"--sort-keys", "x"}},
+		{"append without output", []string{"--append", "x"}},
+		{"append with atomic", []string{"--append", "--atomic", "-o", "x", "y"}},
+		{"unknown dup keys policy", []string{"--rewrite-strings", "--dup-keys=merge"}},
+		{"tee without output", []string{"--tee", "x"}},
+		{"empty delimiter", []string{"--delimiter", ""}},
+		{"delimiter with null", []string{"--delimiter", ";", "-0"}},
+		{"output separator with raw", []string{"--output-separator", ",", "-r", "x"}},
+		{"daemon with unbuffered", []string{"--use-daemon", "--unbuffered", "-l"}},
+		{"daemon with stream", []string{"--use-daemon", "--stream"}},
+		{"output separator with state file", []string{"--output-separator", ",", "-o", "x", "--state-file", "s", "-l"}},
 	}
 
 	for _, tt := range tests {
@@ -401,6 +651,36 @@ func TestParseArgsErrors(t *testing.T) {
 	}
 }
 
+// fullWriter accepts limit bytes and then fails the way a full disk does
+type fullWriter struct {
+	limit int
+}
+
+func (w *fullWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, syscall.ENOSPC
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func TestWriteError(t *testing.T) {
+	for _, args := range [][]string{
+		{"a", "b", "c"},
+		{"--keep-going", "a", "b", "c"},
+		{"--rewrite-strings", `["a", "b"]`},
+		{"--grep-escape", `\n`, `a\nb`},
+	} {
+		var stderr bytes.Buffer
+		exitCode := run(args, strings.NewReader(""), &fullWriter{limit: 2}, &stderr)
+		if exitCode != 1 || stderr.String() != "Error: writing output: no space left on device\n" {
+			t.Errorf("%v: exit code = %d, stderr = %q, want 1 and one write error", args, exitCode, stderr.String())
+		}
+	}
+}
+
 func TestCompletionGeneration(t *testing.T) {
 	shells := []string{"bash", "zsh", "fish"}
 
@@ -433,3 +713,67 @@ func min(a, b int) int {
 	}
 	return b
 }
+
+// countingWrites records how many writes reach it
+type countingWrites struct {
+	buf    bytes.Buffer
+	writes int
+}
+
+func (w *countingWrites) Write(p []byte) (int, error) {
+	w.writes++
+	return w.buf.Write(p)
+}
+
+func TestOutputBuffering(t *testing.T) {
+	input := strings.Repeat("line\n", 100)
+	for _, tt := range []struct {
+		args   []string
+		writes int
+	}{
+		{[]string{"-l", "--stdin"}, 1},
+		{[]string{"-l", "--stdin", "--unbuffered"}, 100},
+	} {
+		var stdout countingWrites
+		var stderr bytes.Buffer
+		if exitCode := run(tt.args, strings.NewReader(input), &stdout, &stderr); exitCode != 0 {
+			t.Fatalf("%v: exit code = %d, want 0 (stderr: %s)", tt.args, exitCode, stderr.String())
+		}
+		if stdout.writes != tt.writes || stdout.buf.String() != input {
+			t.Errorf("%v: %d writes of %q, want %d of the input", tt.args, stdout.writes, stdout.buf.String(), tt.writes)
+		}
+	}
+}
+
+func TestPredictLength(t *testing.T) {
+	input := "plain\nsay \"hi\"\ncafé \U0001F600\n"
+	for _, flags := range [][]string{{"-l"}, {"-l", "-q", "--ascii"}, {"-l", "--html-safe"}} {
+		var want, got, stderr bytes.Buffer
+		run(append(flags, "--stdin"), strings.NewReader(input), &want, &stderr)
+		if exitCode := run(append(flags, "--stdin", "--predict-length"), strings.NewReader(input), &got, &stderr); exitCode != 0 {
+			t.Fatalf("%v exit code = %d, want 0 (stderr: %s)", flags, exitCode, stderr.String())
+		}
+		var lengths []string
+		for _, line := range strings.Split(strings.TrimSuffix(want.String(), "\n"), "\n") {
+			lengths = append(lengths, strconv.Itoa(len(line)))
+		}
+		if expected := strings.Join(lengths, "\n") + "\n"; got.String() != expected {
+			t.Errorf("%v --predict-length = %q, want %q", flags, got.String(), expected)
+		}
+	}
+}
+
+func TestTee(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.txt")
+	var stdout, stderr bytes.Buffer
+	if exitCode := run([]string{"-l", "--tee", "-o", out}, strings.NewReader("a\"b\nc\n"), &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	want := "a\\\"b\nc\n"
+	if got, _ := os.ReadFile(out); string(got) != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+	if stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+}
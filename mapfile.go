@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadMapFile reads the replacements of a --map-file: one per line, the text
+// to find and the text to put in its place separated by a tab. Blank lines
+// and lines starting with # are skipped. Where two entries match at the same
+// place, the one on the earlier line wins.
+func loadMapFile(path string) (*strings.Replacer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open map file: %w", err)
+	}
+	defer f.Close()
+
+	var pairs []string
+	seen := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		from, to, ok := strings.Cut(text, "\t")
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("%s:%d: expected the text to replace and its replacement separated by a tab", path, line)
+		case from == "":
+			return nil, fmt.Errorf("%s:%d: the text to replace is empty", path, line)
+		case seen[from] > 0:
+			return nil, fmt.Errorf("%s:%d: %q is already replaced on line %d", path, line, from, seen[from])
+		}
+		seen[from] = line
+		pairs = append(pairs, from, to)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading map file: %w", err)
+	}
+	return strings.NewReplacer(pairs...), nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMapFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "map.tsv")
+	os.WriteFile(path, []byte("# hosts\ndb01.corp.internal\t<db>\ndb01\t<short>\n\nalice\t\"user\"\r\n"), 0o644)
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"escape", []string{"-l", "--stdin"}, `connect \"user\" to <db>, not <short>` + "\n" + `\"user\" hi` + "\n"},
+		{"unescape", []string{"-u", "--stdin"}, `connect "user" to <db>, not <short>` + "\n" + `"user" hi` + "\n"},
+	}
+	input := map[string]string{
+		"escape":   "connect alice to db01.corp.internal, not db01\nalice hi\n",
+		"unescape": `connect alice to db01.corp.internal, not db01\nalice hi`,
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append(tt.args, "--map-file", path)
+			if exitCode := run(args, strings.NewReader(input[tt.name]), &stdout, &stderr); exitCode != 0 {
+				t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadMapFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		content string
+		want    string
+	}{
+		{"a\tb\nno tab\n", "map.tsv:2: expected"},
+		{"\tb\n", "map.tsv:1: the text to replace is empty"},
+		{"a\tb\na\tc\n", `map.tsv:2: "a" is already replaced on line 1`},
+	} {
+		path := filepath.Join(dir, "map.tsv")
+		os.WriteFile(path, []byte(tt.content), 0o644)
+		if _, err := loadMapFile(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("loadMapFile(%q) error = %v, want it to contain %q", tt.content, err, tt.want)
+		}
+	}
+	if _, err := loadMapFile(filepath.Join(dir, "missing.tsv")); err == nil {
+		t.Error("loadMapFile of a missing file succeeded")
+	}
+}
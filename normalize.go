@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/jsonescape/pkg/jsonescape"
+)
+
+// normalizeOptions holds the arguments of the normalize-corpus subcommand
+type normalizeOptions struct {
+	Src       string
+	Out       string
+	ASCIIOnly bool
+	HTMLSafe  bool
+}
+
+// normalizeCorpus implements the normalize-corpus subcommand. Every file
+// under the source directory holds one escaped string, optionally quoted;
+// it is unescaped and escaped again with the canonical options, and written
+// to the same relative path under --out unless an earlier file (in path
+// order) normalized to the same content. Files that do not unescape are
+// reported and left out.
+func normalizeCorpus(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, err := parseNormalizeArgs(args)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		fmt.Fprintf(stderr, "Usage: %s normalize-corpus --out <DIR> [--ascii] [--html-safe] <DIR>\n", name)
+		return exitUsageError
+	}
+
+	seen := make(map[string]string) // normalized content -> first file with it
+	var files, written, changed, duplicates, failed int
+	err = filepath.WalkDir(opts.Src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// Don't walk into the output when it is inside the source
+			if filepath.Clean(path) == filepath.Clean(opts.Out) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(opts.Src, path)
+		if err != nil {
+			return err
+		}
+		files++
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		normalized, err := normalizeFixture(string(data), opts)
+		if err != nil {
+			fmt.Fprintf(stdout, "failed     %s: %v\n", rel, err)
+			failed++
+			return nil
+		}
+		if first, ok := seen[normalized]; ok {
+			fmt.Fprintf(stdout, "duplicate  %s (same as %s)\n", rel, first)
+			duplicates++
+			return nil
+		}
+		seen[normalized] = rel
+		if normalized != string(data) {
+			fmt.Fprintf(stdout, "normalized %s\n", rel)
+			changed++
+		}
+
+		target := filepath.Join(opts.Out, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		written++
+		return os.WriteFile(target, []byte(normalized), 0o644)
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	fmt.Fprintf(stdout, "%d files: %d written to %s (%d normalized), %d duplicates, %d failed\n",
+		files, written, opts.Out, changed, duplicates, failed)
+	if failed > 0 {
+		return exitError
+	}
+	return exitSuccess
+}
+
+// normalizeFixture re-escapes the string held in a fixture file, keeping its
+// quotes and final newline if it has them
+func normalizeFixture(data string, opts *normalizeOptions) (string, error) {
+	body, quoted, newline := splitFixture(data)
+	s, _, err := jsonescape.UnescapeLenient(body)
+	if err != nil {
+		return "", err
+	}
+	result := jsonescape.Escape(s, jsonescape.Options{ASCII: opts.ASCIIOnly, HTMLSafe: opts.HTMLSafe})
+	if quoted {
+		result = `"` + result + `"`
+	}
+	if newline {
+		result += "\n"
+	}
+	return result, nil
+}
+
+func parseNormalizeArgs(args []string) (*normalizeOptions, error) {
+	opts := &normalizeOptions{}
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(args[i], "--"), "=")
+		switch {
+		case !strings.HasPrefix(args[i], "--"):
+			if opts.Src != "" {
+				return nil, fmt.Errorf("unexpected argument %q", args[i])
+			}
+			opts.Src = args[i]
+		case name == "ascii":
+			opts.ASCIIOnly = true
+		case name == "html-safe":
+			opts.HTMLSafe = true
+		case name == "out":
+			if !hasValue {
+				i++
+				if i >= len(args) {
+					return nil, errors.New("--out requires a value")
+				}
+				value = args[i]
+			}
+			opts.Out = value
+		default:
+			return nil, fmt.Errorf("unknown option: --%s", name)
+		}
+	}
+
+	if opts.Src == "" {
+		return nil, errors.New("no corpus directory given")
+	}
+	if opts.Out == "" {
+		return nil, errors.New("--out is required")
+	}
+	if filepath.Clean(opts.Src) == filepath.Clean(opts.Out) {
+		return nil, errors.New("--out must differ from the corpus directory")
+	}
+	return opts, nil
+}
+
+// splitFixture returns the escaped string held in a fixture file, without
+// the surrounding quotes and final newline it may have
+func splitFixture(data string) (body string, quoted, newline bool) {
+	body, newline = strings.CutSuffix(data, "\n")
+	quoted = len(body) >= 2 && body[0] == '"' && body[len(body)-1] == '"'
+	if quoted {
+		body = body[1 : len(body)-1]
+	}
+	return body, quoted, newline
+}
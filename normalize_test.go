@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeFixture(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`"caf\u00e9\/x"` + "\n", `"café/x"` + "\n"},
+		{`a\u000Ab`, `a\nb`},
+		{"tab\there", `tab\there`},
+		{`"\ud83d\ude00"`, `"😀"`},
+	}
+	for _, tt := range tests {
+		got, err := normalizeFixture(tt.input, &normalizeOptions{})
+		if err != nil {
+			t.Errorf("normalizeFixture(%q) error: %v", tt.input, err)
+		} else if got != tt.expected {
+			t.Errorf("normalizeFixture(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+
+	if _, err := normalizeFixture(`bad\q`, &normalizeOptions{}); err == nil {
+		t.Error("expected error for invalid escape")
+	}
+}
+
+func TestNormalizeCorpus(t *testing.T) {
+	src, out := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"a.json":     `"caf\u00e9"` + "\n",
+		"b.json":     `"café"` + "\n",
+		"sub/c.json": "\"x\ty\"",
+		"sub/d.json": `"bad\q"`,
+	}
+	for file, content := range files {
+		path := filepath.Join(src, file)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"normalize-corpus", "--out", out, src}, strings.NewReader(""), &stdout, &stderr)
+	if exitCode != 1 {
+		t.Fatalf("exit code = %d, want 1 (stderr: %s)", exitCode, stderr.String())
+	}
+	for _, want := range []string{
+		"normalized a.json\n",
+		"duplicate  b.json (same as a.json)\n",
+		"normalized " + filepath.Join("sub", "c.json") + "\n",
+		"failed     " + filepath.Join("sub", "d.json") + ":",
+		"4 files: 2 written to " + out + " (2 normalized), 1 duplicates, 1 failed\n",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("stdout missing %q:\n%s", want, stdout.String())
+		}
+	}
+
+	for file, expected := range map[string]string{"a.json": `"café"` + "\n", "sub/c.json": `"x\ty"`} {
+		data, err := os.ReadFile(filepath.Join(out, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("%s = %q, want %q", file, data, expected)
+		}
+	}
+	for _, file := range []string{"b.json", "sub/d.json"} {
+		if _, err := os.Stat(filepath.Join(out, file)); err == nil {
+			t.Errorf("%s should not have been written", file)
+		}
+	}
+}
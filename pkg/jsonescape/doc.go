@@ -0,0 +1,10 @@
+// Package jsonescape escapes and unescapes the body of JSON string
+// literals. It is the core of the jsonescape command, usable on its own:
+//
+//	s := jsonescape.Escape("say \"hi\"\n", jsonescape.Options{})
+//	// s == `say \"hi\"\n`
+//	t, err := jsonescape.Unescape(s)
+//	// t == "say \"hi\"\n"
+//
+// Neither function adds or expects the surrounding double quotes.
+package jsonescape
@@ -0,0 +1,148 @@
+package jsonescape
+
+import "unicode/utf8"
+
+// Options controls how Escape writes characters that JSON allows either way
+type Options struct {
+	// ASCII escapes every non-ASCII character as \uXXXX, using a surrogate
+	// pair outside the Basic Multilingual Plane
+	ASCII bool
+	// HTMLSafe escapes <, > and & as \u003c, \u003e and \u0026 so the
+	// result can be embedded in an HTML script element
+	HTMLSafe bool
+	// ByteScan looks for characters that need escaping a byte at a time,
+	// rather than eight bytes at a time as on amd64 and arm64 (unless built
+	// with the purego tag). The result is the same either way.
+	ByteScan bool
+}
+
+// Escape escapes s for use inside a JSON string literal, without the
+// surrounding quotes. Invalid UTF-8 is written as U+FFFD. When nothing in s
+// needs escaping, s itself is returned without allocating.
+func Escape(s string, opts Options) string {
+	n := cleanPrefix(s, opts)
+	if n == len(s) {
+		return s
+	}
+	buf := make([]byte, 0, len(s)+10)
+	return string(AppendEscape(append(buf, s[:n]...), s[n:], opts))
+}
+
+// AppendEscape appends s, escaped as by Escape, to dst and returns the
+// extended buffer, like strconv.AppendQuote. It allocates only to grow dst.
+func AppendEscape(dst []byte, s string, opts Options) []byte {
+	for i := 0; i < len(s); {
+		// Copy runs that need no escaping in one go
+		if n := cleanPrefix(s[i:], opts); n > 0 {
+			dst = append(dst, s[i:i+n]...)
+			i += n
+			continue
+		}
+
+		if c := s[i]; c < utf8.RuneSelf {
+			// Anything in the ASCII range that cleanPrefix stopped at is
+			// escaped: by its short form if it has one, else as \u00XX
+			if esc := shortEscapes[c]; esc != "" {
+				dst = append(dst, esc...)
+			} else {
+				dst = appendUnicodeEscape(dst, rune(c))
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case !opts.ASCII:
+			// Only invalid UTF-8 gets here, and is written as U+FFFD
+			dst = utf8.AppendRune(dst, r)
+		case r <= 0xFFFF:
+			dst = appendUnicodeEscape(dst, r)
+		default:
+			// Use surrogate pairs for characters outside BMP
+			r1, r2 := utf16Surrogates(r)
+			dst = appendUnicodeEscape(appendUnicodeEscape(dst, r1), r2)
+		}
+	}
+
+	return dst
+}
+
+// EscapedLen returns the length in bytes of Escape(s, opts) without
+// building it, so a buffer can be sized or a length limit checked up front
+func EscapedLen(s string, opts Options) int {
+	n := 0
+	for i := 0; i < len(s); {
+		if clean := cleanPrefix(s[i:], opts); clean > 0 {
+			n += clean
+			i += clean
+			continue
+		}
+
+		if c := s[i]; c < utf8.RuneSelf {
+			if shortEscapes[c] != "" {
+				n += 2
+			} else {
+				n += 6
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case !opts.ASCII:
+			n += utf8.RuneLen(r) // U+FFFD in place of invalid UTF-8
+		case r <= 0xFFFF:
+			n += 6
+		default:
+			n += 12
+		}
+	}
+	return n
+}
+
+// shortEscapes holds the two-character escapes JSON has for some ASCII
+// characters
+var shortEscapes = [utf8.RuneSelf]string{
+	'"':  `\"`,
+	'\\': `\\`,
+	'\b': `\b`,
+	'\f': `\f`,
+	'\n': `\n`,
+	'\r': `\r`,
+	'\t': `\t`,
+}
+
+// cleanPrefix returns the length of the leading run of s that AppendEscape
+// copies unchanged. Past the printable ASCII safePrefix covers, that takes in
+// valid UTF-8 sequences unless opts.ASCII is set.
+func cleanPrefix(s string, opts Options) int {
+	i := 0
+	for {
+		i += safePrefix(s[i:], opts)
+		if i == len(s) || opts.ASCII || s[i] < utf8.RuneSelf {
+			return i
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendUnicodeEscape appends the \uXXXX escape for a code unit
+func appendUnicodeEscape(dst []byte, r rune) []byte {
+	return append(dst, '\\', 'u', hexDigits[r>>12&0xF], hexDigits[r>>8&0xF], hexDigits[r>>4&0xF], hexDigits[r&0xF])
+}
+
+// utf16Surrogates returns the UTF-16 surrogate pair for a rune outside the BMP
+func utf16Surrogates(r rune) (rune, rune) {
+	r -= 0x10000
+	return 0xD800 + (r>>10)&0x3FF, 0xDC00 + r&0x3FF
+}
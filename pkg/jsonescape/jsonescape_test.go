@@ -0,0 +1,343 @@
+package jsonescape
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		asciiOnly bool
+		htmlSafe  bool
+		expected  string
+	}{
+		{
+			name:     "simple string",
+			input:    "hello world",
+			expected: "hello world",
+		},
+		{
+			name:     "quotes",
+			input:    `say "hello"`,
+			expected: `say \"hello\"`,
+		},
+		{
+			name:     "backslash",
+			input:    `path\to\file`,
+			expected: `path\\to\\file`,
+		},
+		{
+			name:     "newline",
+			input:    "line1\nline2",
+			expected: `line1\nline2`,
+		},
+		{
+			name:     "tab",
+			input:    "col1\tcol2",
+			expected: `col1\tcol2`,
+		},
+		{
+			name:     "carriage return",
+			input:    "line1\r\nline2",
+			expected: `line1\r\nline2`,
+		},
+		{
+			name:     "all special chars",
+			input:    "\b\f\n\r\t\"\\",
+			expected: `\b\f\n\r\t\"\\`,
+		},
+		{
+			name:     "control characters",
+			input:    "hello\x00\x1fworld",
+			expected: `hello\u0000\u001fworld`,
+		},
+		{
+			name:     "unicode preserved",
+			input:    "日本語",
+			expected: "日本語",
+		},
+		{
+			name:      "unicode escaped with ascii mode",
+			input:     "日本語",
+			asciiOnly: true,
+			expected:  `\u65e5\u672c\u8a9e`,
+		},
+		{
+			name:      "emoji with ascii mode",
+			input:     "Hello 👋",
+			asciiOnly: true,
+			expected:  `Hello \ud83d\udc4b`,
+		},
+		{
+			name:     "html characters preserved by default",
+			input:    "<script>&</script>",
+			expected: "<script>&</script>",
+		},
+		{
+			name:     "html characters escaped in html-safe mode",
+			input:    "<script>&</script>",
+			htmlSafe: true,
+			expected: `\u003cscript\u003e\u0026\u003c/script\u003e`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Escape(tt.input, Options{ASCII: tt.asciiOnly, HTMLSafe: tt.htmlSafe})
+			if result != tt.expected {
+				t.Errorf("Escape(%q, ascii=%v, html=%v) = %q, want %q",
+					tt.input, tt.asciiOnly, tt.htmlSafe, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "simple string",
+			input:    "hello world",
+			expected: "hello world",
+		},
+		{
+			name:     "escaped quotes",
+			input:    `say \"hello\"`,
+			expected: `say "hello"`,
+		},
+		{
+			name:     "escaped backslash",
+			input:    `path\\to\\file`,
+			expected: `path\to\file`,
+		},
+		{
+			name:     "escaped newline",
+			input:    `line1\nline2`,
+			expected: "line1\nline2",
+		},
+		{
+			name:     "escaped tab",
+			input:    `col1\tcol2`,
+			expected: "col1\tcol2",
+		},
+		{
+			name:     "all escapes",
+			input:    `\b\f\n\r\t\"\\\/`,
+			expected: "\b\f\n\r\t\"\\/",
+		},
+		{
+			name:     "unicode escape",
+			input:    `\u0048\u0065\u006c\u006c\u006f`,
+			expected: "Hello",
+		},
+		{
+			name:     "unicode japanese",
+			input:    `\u65e5\u672c\u8a9e`,
+			expected: "日本語",
+		},
+		{
+			name:     "surrogate pair",
+			input:    `\ud83d\udc4b`,
+			expected: "👋",
+		},
+		{
+			name:     "mixed content",
+			input:    `Hello\nWorld \u0021`,
+			expected: "Hello\nWorld !",
+		},
+		{
+			name:    "incomplete escape",
+			input:   `hello\`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid escape char",
+			input:   `hello\x`,
+			wantErr: true,
+		},
+		{
+			name:    "incomplete unicode",
+			input:   `hello\u00`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid unicode hex",
+			input:   `hello\uXXXX`,
+			wantErr: true,
+		},
+		{
+			name:    "high surrogate then lone backslash",
+			input:   `\ud83d\`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Unescape(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Unescape(%q) expected error, got nil", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unescape(%q) unexpected error: %v", tt.input, err)
+				return
+			}
+			if result != tt.expected {
+				t.Errorf("Unescape(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLenientUnescape(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    string
+		nonstandard bool
+	}{
+		{`\u0041`, "A", false},
+		{`\U0041`, "A", true},
+		{`\u00 41\t`, "A\t", true},
+		{"\\u\t0041", "A", true},
+		{`\ud83d\U DE00`, "\U0001F600", true},
+		{`\u0041 B`, "A B", false},
+	}
+
+	for _, tt := range tests {
+		result, nonstandard, err := UnescapeLenient(tt.input)
+		if err != nil {
+			t.Errorf("UnescapeLenient(%q) unexpected error: %v", tt.input, err)
+			continue
+		}
+		if result != tt.expected || nonstandard != tt.nonstandard {
+			t.Errorf("UnescapeLenient(%q) = %q, %v, want %q, %v", tt.input, result, nonstandard, tt.expected, tt.nonstandard)
+		}
+		if _, err := Unescape(tt.input); err == nil && tt.nonstandard {
+			t.Errorf("Unescape(%q) expected error, got nil", tt.input)
+		}
+	}
+
+	// A high surrogate followed by a lone backslash is cut short
+	if _, _, err := UnescapeLenient(`\ud83d\`); err == nil {
+		t.Errorf("UnescapeLenient(%q) expected error, got nil", `\ud83d\`)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []string{
+		"hello world",
+		"line1\nline2\nline3",
+		`quotes "and" 'stuff'`,
+		"日本語テスト",
+		"emoji: 👋🌍🎉",
+		"\x00\x01\x02\x1f",
+		"mixed: hello\tworld\n日本語",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			escaped := Escape(input, Options{})
+			unescaped, err := Unescape(escaped)
+			if err != nil {
+				t.Errorf("round trip failed: escape(%q) = %q, unescape error: %v",
+					input, escaped, err)
+				return
+			}
+			if unescaped != input {
+				t.Errorf("round trip failed: escape(%q) = %q, unescape = %q",
+					input, escaped, unescaped)
+			}
+		})
+	}
+}
+
+func TestAppendEscape(t *testing.T) {
+	inputs := []string{"", "plain", "tab\there \"q\" <b>", "café \U0001F600 \x01\xff"}
+	for _, input := range inputs {
+		for _, opts := range []Options{{}, {ASCII: true, HTMLSafe: true}} {
+			got := AppendEscape([]byte("prefix:"), input, opts)
+			if want := "prefix:" + Escape(input, opts); string(got) != want {
+				t.Errorf("AppendEscape(%q, %+v) = %q, want %q", input, opts, got, want)
+			}
+		}
+	}
+
+	buf := make([]byte, 0, 256)
+	input := "line\n\"quoted\" café \U0001F600 \x01"
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = AppendEscape(buf[:0], input, Options{ASCII: true})
+	})
+	if allocs != 0 {
+		t.Errorf("AppendEscape into a big enough buffer made %v allocations, want 0", allocs)
+	}
+}
+
+func TestEscapeUnchanged(t *testing.T) {
+	tests := []struct {
+		input string
+		opts  Options
+		clean bool
+	}{
+		{"", Options{}, true},
+		{"plain ascii, with <tags> & more", Options{}, true},
+		{"café \U0001F600  ", Options{}, true},
+		{"<tag>", Options{HTMLSafe: true}, false},
+		{"café", Options{ASCII: true}, false},
+		{"bad \xff byte", Options{}, false},
+		{"ends in a tab\t", Options{}, false},
+	}
+	for _, tt := range tests {
+		var got string
+		allocs := testing.AllocsPerRun(10, func() {
+			got = Escape(tt.input, tt.opts)
+		})
+		if clean := got == tt.input && allocs == 0; clean != tt.clean {
+			t.Errorf("Escape(%q, %+v) = %q with %v allocations, want unchanged without allocating: %v",
+				tt.input, tt.opts, got, allocs, tt.clean)
+		}
+	}
+}
+
+func BenchmarkEscape(b *testing.B) {
+	input := strings.Repeat("mostly plain text, \"quoted\", café \U0001F600\tand a tab\n", 64)
+	for _, opts := range []Options{{}, {ASCII: true}, {HTMLSafe: true}} {
+		b.Run(fmt.Sprintf("%+v", opts), func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			buf := make([]byte, 0, 4*len(input))
+			for i := 0; i < b.N; i++ {
+				buf = AppendEscape(buf[:0], input, opts)
+			}
+		})
+	}
+}
+
+func TestEscapedLen(t *testing.T) {
+	inputs := []string{
+		"", "plain", "tab\there \"q\" \\ <b> & </b>", "café \U0001F600 日本",
+		"\x00\x01\x1f\x7f", "bad \xff\xe2\x82 bytes", "  ", "\xef\xbf\xbd",
+	}
+	for _, input := range inputs {
+		for _, opts := range []Options{{}, {ASCII: true}, {HTMLSafe: true}, {ASCII: true, HTMLSafe: true}} {
+			if got, want := EscapedLen(input, opts), len(Escape(input, opts)); got != want {
+				t.Errorf("EscapedLen(%q, %+v) = %d, want %d", input, opts, got, want)
+			}
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		EscapedLen("line\n\"quoted\" café \U0001F600", Options{ASCII: true})
+	})
+	if allocs != 0 {
+		t.Errorf("EscapedLen made %v allocations, want 0", allocs)
+	}
+}
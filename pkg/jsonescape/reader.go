@@ -0,0 +1,156 @@
+package jsonescape
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// readerChunkSize is how much escaped input an UnescapingReader reads at a
+// time
+const readerChunkSize = 32 * 1024
+
+// UnescapingReader decodes the escaped body of a JSON string as it is read
+// from an underlying reader, so it can be fed to a decoder or written out
+// without holding the whole string in memory. It is strict, like Unescape:
+// the first bad escape ends the stream with the error Unescape would give,
+// after the output decoded before it.
+type UnescapingReader struct {
+	r   io.Reader
+	buf []byte
+	out []byte // decoded and not yet returned
+	err error  // returned once out is drained
+
+	esc  int     // bytes of the current escape seen so far, 0 outside one
+	hex  [4]byte // digits of the current \uXXXX escape
+	high rune    // high surrogate waiting for its low half, or 0
+}
+
+// NewUnescapingReader returns an UnescapingReader reading from r. The quotes
+// around the string value should not be part of r.
+func NewUnescapingReader(r io.Reader) *UnescapingReader {
+	return &UnescapingReader{r: r, buf: make([]byte, readerChunkSize)}
+}
+
+// Read reads decoded bytes into p
+func (u *UnescapingReader) Read(p []byte) (int, error) {
+	for len(u.out) == 0 && u.err == nil {
+		n, err := u.r.Read(u.buf)
+		u.decode(u.buf[:n])
+		if u.err == nil && err == io.EOF {
+			u.finish()
+		}
+		if u.err == nil && err != nil {
+			u.err = err
+		}
+	}
+
+	n := copy(p, u.out)
+	u.out = u.out[n:]
+	if len(u.out) > 0 {
+		return n, nil
+	}
+	u.out = u.out[:0:0]
+	return n, u.err
+}
+
+// decode runs the escaped bytes of b through the state machine, appending
+// what they decode to to out
+func (u *UnescapingReader) decode(b []byte) {
+	for _, c := range b {
+		switch u.esc {
+		case 0:
+			if c == '\\' {
+				u.esc = 1
+				continue
+			}
+			u.flushHigh()
+			u.out = append(u.out, c)
+		case 1:
+			if c == 'u' {
+				u.esc = 2
+				continue
+			}
+			d, ok := shortEscape(c)
+			if !ok {
+				u.err = fmt.Errorf("invalid escape sequence \\%c", c)
+				return
+			}
+			u.flushHigh()
+			u.out = append(u.out, d)
+			u.esc = 0
+		default:
+			u.hex[u.esc-2] = c
+			u.esc++
+			if u.esc < 6 {
+				continue
+			}
+			u.esc = 0
+			r, err := parseHexRune(string(u.hex[:]))
+			if err != nil {
+				u.err = fmt.Errorf("invalid unicode escape \\u%s: %w", u.hex[:], err)
+				return
+			}
+			u.codeUnit(r)
+		}
+	}
+}
+
+// codeUnit writes the UTF-16 code unit of a \uXXXX escape, pairing a low
+// surrogate with the high one before it
+func (u *UnescapingReader) codeUnit(r rune) {
+	if u.high != 0 {
+		if r >= 0xDC00 && r <= 0xDFFF {
+			u.out = utf8.AppendRune(u.out, 0x10000+(u.high-0xD800)*0x400+(r-0xDC00))
+			u.high = 0
+			return
+		}
+		u.flushHigh()
+	}
+	if r >= 0xD800 && r <= 0xDBFF {
+		u.high = r
+		return
+	}
+	u.out = utf8.AppendRune(u.out, r)
+}
+
+// flushHigh writes a high surrogate that turned out to have no low half,
+// as U+FFFD
+func (u *UnescapingReader) flushHigh() {
+	if u.high != 0 {
+		u.out = utf8.AppendRune(u.out, utf8.RuneError)
+		u.high = 0
+	}
+}
+
+// finish checks that the input didn't end part way through an escape
+func (u *UnescapingReader) finish() {
+	switch {
+	case u.esc == 1:
+		u.err = errors.New("incomplete escape sequence at end of string")
+	case u.esc > 1:
+		u.err = errors.New("incomplete unicode escape sequence")
+	default:
+		u.flushHigh()
+	}
+}
+
+// shortEscape returns the byte a two-character escape like \n stands for
+func shortEscape(c byte) (byte, bool) {
+	switch c {
+	case '"', '\\', '/':
+		return c, true
+	case 'b':
+		return '\b', true
+	case 'f':
+		return '\f', true
+	case 'n':
+		return '\n', true
+	case 'r':
+		return '\r', true
+	case 't':
+		return '\t', true
+	}
+	return 0, false
+}
@@ -0,0 +1,49 @@
+package jsonescape
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestUnescapingReader(t *testing.T) {
+	inputs := []string{
+		``,
+		`plain`,
+		`a\\nb\\`,
+		`\"quoted\" \u00e9\n\/`,
+		`\ud83d\ude00`,
+		`\ud83d\ude00\ud83d`,
+		`\ud83d x \ude00 \ud83d\n`,
+		`\ud83d\ud83d\ude00`,
+		`raw bytes ` + "\xff\xe2",
+		`bad \x escape`,
+		`bad \u00zz digits`,
+		`cut short \u00`,
+		`cut short \`,
+		strings.Repeat(`\ud83d\ude00\\`, readerChunkSize/8),
+	}
+
+	for _, input := range inputs {
+		want, wantErr := Unescape(input)
+		// One byte at a time splits every escape that can be split
+		got, err := io.ReadAll(NewUnescapingReader(iotest.OneByteReader(strings.NewReader(input))))
+		if wantErr != nil {
+			if err == nil || err.Error() != wantErr.Error() {
+				t.Errorf("UnescapingReader(%.20q) error = %v, want %v", input, err, wantErr)
+			}
+			continue
+		}
+		if err != nil || string(got) != want {
+			t.Errorf("UnescapingReader(%.20q) = %.40q, %v, want %.40q", input, got, err, want)
+		}
+	}
+}
+
+func TestUnescapingReaderOutputBeforeError(t *testing.T) {
+	got, err := io.ReadAll(NewUnescapingReader(strings.NewReader(`ok\n \q`)))
+	if string(got) != "ok\n " || err == nil {
+		t.Errorf("got %q, %v, want the output before the bad escape and an error", got, err)
+	}
+}
@@ -0,0 +1,109 @@
+package jsonescape
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Framing says how ProcessReaderFunc splits its input into records
+type Framing struct {
+	// Delimiter ends each record and may be several bytes long. Empty
+	// means lines: each record ends at a \n, and a \r before it is dropped.
+	Delimiter string
+}
+
+// The framings of the jsonescape command's --lines and --null
+var (
+	Lines = Framing{}
+	NUL   = Framing{Delimiter: "\x00"}
+)
+
+// MaxLineSize is the longest line Lines framing reads. A longer one is an
+// error, bufio.ErrTooLong.
+const MaxLineSize = 10 * 1024 * 1024
+
+// Record is one record of the input to ProcessReaderFunc
+type Record struct {
+	Text    string // the record, without its delimiter or line ending
+	Line    int    // line of the input it starts on, from 1
+	Offset  int64  // byte offset of its start within the input
+	Newline bool   // it ended with its delimiter, not with the end of the input
+}
+
+// ProcessReaderFunc splits r into records as framing says and calls fn with
+// each in turn, as the jsonescape command does for --lines, --null and
+// --delimiter. Whatever follows the last delimiter is a record too, unless
+// it is empty. An error from fn stops it and is returned as it is; an error
+// reading r is returned once fn has had every record before it.
+func ProcessReaderFunc(r io.Reader, framing Framing, fn func(Record) error) error {
+	if framing.Delimiter == "" {
+		return processLines(r, fn)
+	}
+	br := bufio.NewReader(r)
+	rec := Record{Line: 1}
+	for {
+		item, err := readDelimited(br, framing.Delimiter)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		next := rec
+		next.Offset += int64(len(item))
+		next.Line += strings.Count(item, "\n")
+
+		rec.Text = strings.TrimSuffix(item, framing.Delimiter)
+		rec.Newline = err == nil
+		if rec.Text != "" || err == nil {
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		rec = next
+	}
+}
+
+func processLines(r io.Reader, fn func(Record) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+
+	// ScanLines drops the line ending, so remember how much it consumed to
+	// keep byte offsets exact for \r\n input
+	var advance int
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		n, token, err := bufio.ScanLines(data, atEOF)
+		advance = n
+		return n, token, err
+	})
+
+	rec := Record{Line: 1}
+	for scanner.Scan() {
+		rec.Text = scanner.Text()
+		rec.Newline = advance > len(scanner.Bytes())
+		if err := fn(rec); err != nil {
+			return err
+		}
+		rec.Line++
+		rec.Offset += int64(advance)
+	}
+	return scanner.Err()
+}
+
+// readDelimited reads up to and including the first delim, which may be
+// several bytes long, like bufio.Reader.ReadString
+func readDelimited(r *bufio.Reader, delim string) (string, error) {
+	last := delim[len(delim)-1]
+	item, err := r.ReadString(last)
+	if err != nil || strings.HasSuffix(item, delim) {
+		return item, err
+	}
+	var b strings.Builder
+	b.WriteString(item)
+	for err == nil && !strings.HasSuffix(b.String(), delim) {
+		item, err = r.ReadString(last)
+		b.WriteString(item)
+	}
+	return b.String(), err
+}
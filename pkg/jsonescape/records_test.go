@@ -0,0 +1,61 @@
+package jsonescape
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProcessReaderFunc(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		framing Framing
+		want    []Record
+	}{
+		{"lines", "a\r\nbb\nc", Lines, []Record{
+			{"a", 1, 0, true},
+			{"bb", 2, 3, true},
+			{"c", 3, 6, false},
+		}},
+		{"empty lines", "\n\n", Lines, []Record{
+			{"", 1, 0, true},
+			{"", 2, 1, true},
+		}},
+		{"nul", "x\x00y\nz\x00", NUL, []Record{
+			{"x", 1, 0, true},
+			{"y\nz", 1, 2, true},
+		}},
+		{"delimiter", "one--two--", Framing{Delimiter: "--"}, []Record{
+			{"one", 1, 0, true},
+			{"two", 1, 5, true},
+		}},
+		{"unterminated", "one-two", Framing{Delimiter: "-"}, []Record{
+			{"one", 1, 0, true},
+			{"two", 1, 4, false},
+		}},
+	}
+
+	for _, tt := range tests {
+		var got []Record
+		err := ProcessReaderFunc(strings.NewReader(tt.input), tt.framing, func(rec Record) error {
+			got = append(got, rec)
+			return nil
+		})
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, %v; want %+v", tt.name, got, err, tt.want)
+		}
+	}
+
+	// An error from fn stops the records there
+	stop := errors.New("stop")
+	n := 0
+	err := ProcessReaderFunc(strings.NewReader("a\nb\nc\n"), Lines, func(Record) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("got %d records, %v; want 1, %v", n, err, stop)
+	}
+}
@@ -0,0 +1,35 @@
+package jsonescape
+
+import "unicode/utf8"
+
+// safePrefix returns the length of the leading run of s that Escape copies
+// unchanged: printable ASCII other than " and \ (and <, >, & under
+// opts.HTMLSafe). Unless opts.ByteScan is set it looks eight bytes at a time
+// where it can.
+func safePrefix(s string, opts Options) int {
+	htmlSafe := opts.HTMLSafe
+	i := 0
+	if !opts.ByteScan && haveWordScan {
+		i = safeWords(s, htmlSafe)
+	}
+	set := &safeSet
+	if htmlSafe {
+		set = &htmlSafeSet
+	}
+	for i < len(s) && set[s[i]] {
+		i++
+	}
+	return i
+}
+
+// safeSet and htmlSafeSet say which bytes Escape copies as they are, like
+// encoding/json's tables of the same names
+var safeSet, htmlSafeSet = safeSets()
+
+func safeSets() (safe, html [256]bool) {
+	for c := 0x20; c < utf8.RuneSelf; c++ {
+		safe[c] = c != '"' && c != '\\'
+		html[c] = safe[c] && c != '<' && c != '>' && c != '&'
+	}
+	return safe, html
+}
@@ -0,0 +1,9 @@
+//go:build !(amd64 || arm64) || purego
+
+package jsonescape
+
+const haveWordScan = false
+
+func safeWords(s string, htmlSafe bool) int {
+	return 0
+}
@@ -0,0 +1,56 @@
+package jsonescape
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestSafePrefix(t *testing.T) {
+	tests := []struct {
+		input    string
+		htmlSafe bool
+		expected int
+	}{
+		{"", false, 0},
+		{"plain", false, 5},
+		{"sixteen bytes ok", false, 16},
+		{"sixteen bytes ok\n", false, 16},
+		{"eight ok" + `"` + "rest", false, 8},
+		{"1234567890<b>", false, 13},
+		{"1234567890<b>", true, 10},
+		{"caf\u00e9", false, 3},
+		{strings.Repeat("x", 20) + "\x7f\x00", false, 21},
+	}
+
+	for _, byteScan := range []bool{false, true} {
+		for _, tt := range tests {
+			if got := safePrefix(tt.input, Options{HTMLSafe: tt.htmlSafe, ByteScan: byteScan}); got != tt.expected {
+				t.Errorf("safePrefix(%q, %v) with word scan %v = %d, want %d", tt.input, tt.htmlSafe, !byteScan && haveWordScan, got, tt.expected)
+			}
+		}
+	}
+}
+
+func TestWordScanMatchesByteScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	alphabet := []byte("abc \"\\<>&\x00\x1f\x20\x7f\x80\xc3\xa9\xff")
+	for n := 0; n < 2000; n++ {
+		b := make([]byte, r.Intn(40))
+		for i := range b {
+			// Mostly safe bytes, so that runs span whole words
+			if r.Intn(8) == 0 {
+				b[i] = alphabet[r.Intn(len(alphabet))]
+			} else {
+				b[i] = byte('a' + r.Intn(26))
+			}
+		}
+		s := string(b)
+		for _, html := range []bool{false, true} {
+			want := Escape(s, Options{HTMLSafe: html, ByteScan: true})
+			if got := Escape(s, Options{HTMLSafe: html}); got != want {
+				t.Fatalf("Escape(%q, html=%v) = %q with the word scan, %q without", s, html, got, want)
+			}
+		}
+	}
+}
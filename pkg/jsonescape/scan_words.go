@@ -0,0 +1,37 @@
+//go:build (amd64 || arm64) && !purego
+
+package jsonescape
+
+import "unsafe"
+
+const haveWordScan = true
+
+const (
+	lsb = 0x0101010101010101
+	msb = 0x8080808080808080
+)
+
+// hasZero reports in the top bit of each byte whether some byte of w is zero
+// (bytes above the first zero may be flagged falsely)
+func hasZero(w uint64) uint64 {
+	return (w - lsb) & ^w & msb
+}
+
+// safeWords returns the length of the leading run of s, in whole 8-byte
+// words, in which every byte is safe. Both platforms allow unaligned loads.
+func safeWords(s string, htmlSafe bool) int {
+	p := unsafe.Pointer(unsafe.StringData(s))
+	i := 0
+	for ; i+8 <= len(s); i += 8 {
+		w := *(*uint64)(unsafe.Add(p, i))
+		// Top bit set, below 0x20, " or \
+		bad := w&msb | (w-lsb*0x20)&^w&msb | hasZero(w^(lsb*'"')) | hasZero(w^(lsb*'\\'))
+		if htmlSafe {
+			bad |= hasZero(w^(lsb*'<')) | hasZero(w^(lsb*'>')) | hasZero(w^(lsb*'&'))
+		}
+		if bad != 0 {
+			break
+		}
+	}
+	return i
+}
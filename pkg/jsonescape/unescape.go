@@ -0,0 +1,153 @@
+package jsonescape
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Unescape decodes the escapes in the body of a JSON string literal, given
+// without its surrounding quotes. Other bytes, including invalid UTF-8 and
+// control characters, are passed through unchanged.
+func Unescape(s string) (string, error) {
+	result, _, err := unescape(s, false)
+	return result, err
+}
+
+// UnescapeLenient is like Unescape but also accepts \U for \u and spaces or
+// tabs between the hex digits of a \uXXXX escape, as hand-edited or
+// line-wrapped input sometimes has. It reports whether s used either form.
+func UnescapeLenient(s string) (string, bool, error) {
+	return unescape(s, true)
+}
+
+// unescape unescapes a JSON string. If lenient, it also accepts \U for \u
+// and spaces or tabs inside \uXXXX escapes, reporting whether it did.
+func unescape(s string, lenient bool) (string, bool, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(s))
+
+	nonstandard := false
+	i := 0
+	for i < len(s) {
+		if s[i] != '\\' {
+			buf.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		// Handle escape sequence
+		if i+1 >= len(s) {
+			return "", false, errors.New("incomplete escape sequence at end of string")
+		}
+
+		i++ // skip the backslash
+		switch s[i] {
+		case '"':
+			buf.WriteByte('"')
+		case '\\':
+			buf.WriteByte('\\')
+		case '/':
+			buf.WriteByte('/')
+		case 'b':
+			buf.WriteByte('\b')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 't':
+			buf.WriteByte('\t')
+		case 'u', 'U':
+			// Unicode escape: \uXXXX
+			r, n, odd, err := readUnicodeEscape(s[i-1:], lenient)
+			if err != nil {
+				return "", false, err
+			}
+			nonstandard = nonstandard || odd
+			i += n - 1
+
+			// Check for surrogate pair
+			if r >= 0xD800 && r <= 0xDBFF && i < len(s) && s[i] == '\\' {
+				r2, n2, odd2, err := readUnicodeEscape(s[i:], lenient)
+				if err == nil && r2 >= 0xDC00 && r2 <= 0xDFFF {
+					// Valid surrogate pair
+					buf.WriteRune(0x10000 + (r-0xD800)*0x400 + (r2 - 0xDC00))
+					nonstandard = nonstandard || odd2
+					i += n2
+					continue
+				}
+			}
+
+			buf.WriteRune(r)
+			continue
+		default:
+			return "", false, fmt.Errorf("invalid escape sequence \\%c", s[i])
+		}
+		i++
+	}
+
+	return buf.String(), nonstandard, nil
+}
+
+// readUnicodeEscape decodes the \uXXXX escape at the start of s, returning
+// the code unit, the length of the escape and whether it took the lenient
+// forms to read it
+func readUnicodeEscape(s string, lenient bool) (rune, int, bool, error) {
+	if len(s) < 2 {
+		return 0, 0, false, errors.New("incomplete escape sequence at end of string")
+	}
+	if s[1] != 'u' && !(lenient && s[1] == 'U') {
+		return 0, 0, false, fmt.Errorf("invalid escape sequence \\%c", s[1])
+	}
+	odd := s[1] == 'U'
+
+	if !lenient {
+		if len(s) < 6 {
+			return 0, 0, false, errors.New("incomplete unicode escape sequence")
+		}
+		r, err := parseHexRune(s[2:6])
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("invalid unicode escape \\u%s: %w", s[2:6], err)
+		}
+		return r, 6, false, nil
+	}
+
+	// Gather four hex digits, skipping blanks between them
+	var hex []byte
+	n := 2
+	for ; n < len(s) && len(hex) < 4; n++ {
+		if s[n] == ' ' || s[n] == '\t' {
+			odd = true
+			continue
+		}
+		hex = append(hex, s[n])
+	}
+	if len(hex) < 4 {
+		return 0, 0, false, errors.New("incomplete unicode escape sequence")
+	}
+	r, err := parseHexRune(string(hex))
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("invalid unicode escape %s: %w", s[:n], err)
+	}
+	return r, n, odd, nil
+}
+
+func parseHexRune(hex string) (rune, error) {
+	var r rune
+	for _, c := range hex {
+		r <<= 4
+		switch {
+		case c >= '0' && c <= '9':
+			r |= rune(c - '0')
+		case c >= 'a' && c <= 'f':
+			r |= rune(c - 'a' + 10)
+		case c >= 'A' && c <= 'F':
+			r |= rune(c - 'A' + 10)
+		default:
+			return 0, fmt.Errorf("invalid hex character %q", c)
+		}
+	}
+	return r, nil
+}
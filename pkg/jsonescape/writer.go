@@ -0,0 +1,70 @@
+package jsonescape
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// EscapingWriter escapes everything written to it and writes the result to
+// an underlying writer, so output can be streamed into a JSON string value
+// as it is produced. A UTF-8 sequence split between two writes is held back
+// until the rest of it arrives; Close escapes whatever is still held.
+type EscapingWriter struct {
+	w       io.Writer
+	opts    Options
+	pending []byte // start of a UTF-8 sequence cut off by the last write
+}
+
+// NewEscapingWriter returns an EscapingWriter that writes to w. The quotes
+// around the string value are up to the caller.
+func NewEscapingWriter(w io.Writer, opts Options) *EscapingWriter {
+	return &EscapingWriter{w: w, opts: opts}
+}
+
+// Write escapes p and writes it to the underlying writer. It returns
+// len(p) unless the underlying writer fails.
+func (e *EscapingWriter) Write(p []byte) (int, error) {
+	data := p
+	if len(e.pending) > 0 {
+		data = append(e.pending, p...)
+		e.pending = nil
+	}
+
+	keep := incompleteSuffix(data)
+	if keep > 0 {
+		e.pending = append([]byte(nil), data[len(data)-keep:]...)
+		data = data[:len(data)-keep]
+	}
+	if len(data) > 0 {
+		if _, err := io.WriteString(e.w, Escape(string(data), e.opts)); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close writes out a UTF-8 sequence left incomplete by the last write, as
+// U+FFFD. It does not close the underlying writer.
+func (e *EscapingWriter) Close() error {
+	if len(e.pending) == 0 {
+		return nil
+	}
+	s := Escape(string(e.pending), e.opts)
+	e.pending = nil
+	_, err := io.WriteString(e.w, s)
+	return err
+}
+
+// incompleteSuffix returns the length of the UTF-8 sequence that b ends
+// part way through, or 0
+func incompleteSuffix(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return len(b) - i
+			}
+			return 0
+		}
+	}
+	return 0
+}
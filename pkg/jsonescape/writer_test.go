@@ -0,0 +1,36 @@
+package jsonescape
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEscapingWriter(t *testing.T) {
+	inputs := []string{
+		"",
+		"plain",
+		"line\n\"quoted\"\t<b>",
+		"café \U0001F600",
+		"bad \xff\xe2\x82 bytes",
+		"cut \xf0\x9f\x98",
+	}
+
+	for _, input := range inputs {
+		for _, opts := range []Options{{}, {ASCII: true, HTMLSafe: true}} {
+			var buf bytes.Buffer
+			w := NewEscapingWriter(&buf, opts)
+			// One byte at a time splits every sequence that can be split
+			for i := 0; i < len(input); i++ {
+				if n, err := w.Write([]byte{input[i]}); n != 1 || err != nil {
+					t.Fatalf("Write = %d, %v, want 1, nil", n, err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if want := Escape(input, opts); buf.String() != want {
+				t.Errorf("EscapingWriter(%q, %+v) wrote %q, want %q", input, opts, buf.String(), want)
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Default terminator line for --multiline-prompt
+const defaultPromptTerminator = "."
+
+// readMultiline reads lines from r until one consisting of just terminator,
+// or end of input, and returns them joined with newlines. Like mail(1), it
+// announces how to finish when r is a terminal.
+func readMultiline(r io.Reader, prompt io.Writer, terminator string) (string, error) {
+	if isTerminal(r) {
+		fmt.Fprintf(prompt, "Enter the payload; end it with a line containing only %q (or Ctrl-D).\n", terminator)
+	}
+
+	var lines []string
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("reading payload: %w", err)
+		}
+		if err == io.EOF && line == "" {
+			break
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == terminator {
+			break
+		}
+		lines = append(lines, line)
+		if err == io.EOF {
+			break
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadMultiline(t *testing.T) {
+	tests := []struct {
+		name, input, terminator, expected string
+	}{
+		{"terminator", "a\nb\n.\nignored\n", ".", "a\nb"},
+		{"end of input", "a\nb", ".", "a\nb"},
+		{"crlf", "a\r\n.\r\n", ".", "a"},
+		{"custom terminator", "a\n.\nEOF\n", "EOF", "a\n."},
+		{"empty", ".\n", ".", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prompt bytes.Buffer
+			got, err := readMultiline(strings.NewReader(tt.input), &prompt, tt.terminator)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("readMultiline = %q, want %q", got, tt.expected)
+			}
+			if prompt.Len() != 0 {
+				t.Errorf("banner printed for non-terminal input: %q", prompt.String())
+			}
+		})
+	}
+}
+
+func TestMultilinePromptRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader("say \"hi\"\n\tbye\n.\n")
+	exitCode := run([]string{"-q", "--multiline-prompt"}, stdin, &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	if expected := "\"say \\\"hi\\\"\\n\\tbye\"\n"; stdout.String() != expected {
+		t.Errorf("stdout = %q, want %q", stdout.String(), expected)
+	}
+}
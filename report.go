@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+// Formats for --report
+const (
+	reportText = "text"
+	reportJSON = "json"
+)
+
+// sourceReport is one input's line in the --report and --per-file-stats
+// tables
+type sourceReport struct {
+	Source   string        `json:"source"`
+	Records  int           `json:"records"`
+	Changed  int           `json:"changed"`
+	Failed   int           `json:"failed"`
+	Bytes    int64         `json:"bytes"`
+	Escapes  int           `json:"escapes"`
+	Invalid  int           `json:"invalid_utf8"`
+	Duration time.Duration `json:"-"`
+	Millis   float64       `json:"duration_ms"`
+	Error    string        `json:"error,omitempty"`
+
+	start time.Time
+}
+
+// beginSource starts the --report entry for an input
+func (p *Processor) beginSource(source string) {
+	if p.Config.Report == "" && !p.Config.PerFileStats {
+		return
+	}
+	p.source = &sourceReport{Source: source, start: time.Now()}
+	p.reports = append(p.reports, p.source)
+}
+
+// endSource finishes the --report entry for the current input, noting the
+// error that stopped it, if any
+func (p *Processor) endSource(err error) {
+	if p.source == nil {
+		return
+	}
+	p.source.Duration = time.Since(p.source.start)
+	p.source.Millis = float64(p.source.Duration.Microseconds()) / 1000
+	if err != nil {
+		p.source.Error = err.Error()
+	}
+	p.source = nil
+}
+
+// noteRecord counts a record of the current input for --report
+func (p *Processor) noteRecord(changed, failed bool) {
+	if p.source == nil {
+		return
+	}
+	switch {
+	case failed:
+		p.source.Failed++
+	case changed:
+		p.source.Records++
+		p.source.Changed++
+	default:
+		p.source.Records++
+	}
+}
+
+// noteStats adds a record's input, and its output unless it failed, to the
+// --per-file-stats of the current input
+func (p *Processor) noteStats(in, out string, failed bool) {
+	if p.source == nil {
+		return
+	}
+	p.source.Bytes += int64(len(in))
+	p.source.Invalid += countInvalidUTF8(in)
+	if failed {
+		return
+	}
+	if p.Config.Unescape {
+		p.source.Escapes += countEscapes(in)
+	} else {
+		p.source.Escapes += countEscapes(out)
+	}
+}
+
+// countInvalidUTF8 counts the bytes of s that are not part of a valid UTF-8
+// sequence
+func countInvalidUTF8(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			n++
+		}
+		i += size
+	}
+	return n
+}
+
+// countEscapes counts the escape sequences in an escaped string
+func countEscapes(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			n++
+			i++ // the escaped character may itself be a backslash
+		}
+	}
+	return n
+}
+
+// writeStats prints the --per-file-stats table, with a total
+func (p *Processor) writeStats(w io.Writer) error {
+	total := sourceReport{Source: "TOTAL"}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tBYTES\tESCAPES\tINVALID-UTF8\t")
+	for _, r := range p.reports {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t\n", r.Source, r.Bytes, r.Escapes, r.Invalid)
+		total.Bytes += r.Bytes
+		total.Escapes += r.Escapes
+		total.Invalid += r.Invalid
+	}
+	fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t\n", total.Source, total.Bytes, total.Escapes, total.Invalid)
+	return tw.Flush()
+}
+
+// writeReport prints the --report table or JSON array
+func (p *Processor) writeReport(w io.Writer) error {
+	if p.Config.Report == reportJSON {
+		reports := p.reports
+		if reports == nil {
+			reports = []*sourceReport{}
+		}
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tRECORDS\tCHANGED\tFAILED\tTIME\t")
+	for _, r := range p.reports {
+		status := ""
+		if r.Error != "" {
+			status = "  " + r.Error
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\n", r.Source, r.Records, r.Changed, r.Failed,
+			r.Duration.Round(time.Microsecond), status)
+	}
+	return tw.Flush()
+}
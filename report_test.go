@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.txt")
+	bad := filepath.Join(dir, "bad.txt")
+	os.WriteFile(good, []byte("a\nb\"\nc\n"), 0o644)
+	os.WriteFile(bad, []byte("x\\y\nz\n"), 0o644)
+	missing := filepath.Join(dir, "missing.txt")
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-u", "-l", "--keep-going", "--report", "json", "-f", good, "-f", bad, "-f", missing}
+	if exitCode := run(args, strings.NewReader(""), &stdout, &stderr); exitCode != 1 {
+		t.Fatalf("exit code = %d, want 1", exitCode)
+	}
+
+	// The report follows the --keep-going error lines
+	report := stderr.String()[strings.Index(stderr.String(), "["):]
+	var got []sourceReport
+	if err := json.Unmarshal([]byte(report), &got); err != nil {
+		t.Fatalf("invalid JSON report %q: %v", report, err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d entries, want 3", len(got))
+	}
+	expected := []sourceReport{
+		{Source: good, Records: 3, Changed: 0},
+		{Source: bad, Records: 1, Changed: 0, Failed: 1},
+		{Source: missing},
+	}
+	for i, want := range expected {
+		r := got[i]
+		if r.Source != want.Source || r.Records != want.Records || r.Changed != want.Changed || r.Failed != want.Failed {
+			t.Errorf("entry %d = %+v, want %+v", i, r, want)
+		}
+	}
+	if got[2].Error == "" {
+		t.Errorf("missing file has no error in the report")
+	}
+
+	stderr.Reset()
+	run([]string{"--report=text", "a", `b"`}, strings.NewReader(""), &stdout, &stderr)
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "SOURCE") || !strings.HasPrefix(lines[2], "argument 2  1        1        0") {
+		t.Errorf("text report = %q", stderr.String())
+	}
+}
+
+func TestPerFileStats(t *testing.T) {
+	dir := t.TempDir()
+	dirty := filepath.Join(dir, "dirty.txt")
+	clean := filepath.Join(dir, "clean.txt")
+	os.WriteFile(dirty, []byte("tab\there \"quoted\"\nbad \xff byte\n"), 0o644)
+	os.WriteFile(clean, []byte("plain\n"), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-l", "--per-file-stats", "--force-binary", "-f", dirty, "-f", clean}
+	if exitCode := run(args, strings.NewReader(""), &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+
+	var got [][]string
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		got = append(got, strings.Fields(line))
+	}
+	expected := [][]string{
+		{"SOURCE", "BYTES", "ESCAPES", "INVALID-UTF8"},
+		{dirty, "27", "3", "1"},
+		{clean, "5", "0", "0"},
+		{"TOTAL", "32", "3", "1"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("stats = %q, want %q", got, expected)
+	}
+}
+
+func TestCountEscapes(t *testing.T) {
+	for s, want := range map[string]int{``: 0, `plain`: 0, `a\"b`: 1, `\\\\`: 2, `\\n`: 1, `é\n`: 1} {
+		if got := countEscapes(s); got != want {
+			t.Errorf("countEscapes(%q) = %d, want %d", s, got, want)
+		}
+	}
+}
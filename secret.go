@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// Prompt shown by --secret-prompt
+const secretPrompt = "Secret (not echoed): "
+
+// readSecret prompts on the controlling terminal and reads one line with
+// echo turned off, so the value never shows up on screen, in shell history
+// or in the process list. The terminal is restored even on Ctrl-C.
+func readSecret() (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("--secret-prompt needs a terminal: %w", err)
+	}
+	defer tty.Close()
+
+	restore, err := disableEcho(tty)
+	if err != nil {
+		return "", fmt.Errorf("cannot turn off terminal echo: %w", err)
+	}
+	defer restore()
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	defer signal.Stop(interrupted)
+	go func() {
+		if _, ok := <-interrupted; ok {
+			restore()
+			fmt.Fprintln(tty)
+			os.Exit(130)
+		}
+	}()
+
+	fmt.Fprint(tty, secretPrompt)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	fmt.Fprintln(tty)
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading secret: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
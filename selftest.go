@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/user/jsonescape/pkg/jsonescape"
+)
+
+// How many divergences selftest prints per flag combination
+const selftestExamples = 3
+
+// selftestCombo is one combination of escaping flags
+type selftestCombo struct {
+	ascii, html bool
+	controls    string
+}
+
+func (c selftestCombo) String() string {
+	return fmt.Sprintf("ascii=%v html-safe=%v controls=%s", c.ascii, c.html, c.controls)
+}
+
+// selftestCombos returns the default flags alone, or with matrix every
+// combination of the escaping flags
+func selftestCombos(matrix bool) []selftestCombo {
+	if !matrix {
+		return []selftestCombo{{controls: "escape"}}
+	}
+	var combos []selftestCombo
+	for _, ascii := range []bool{false, true} {
+		for _, html := range []bool{false, true} {
+			for _, controls := range []string{"escape", "strip", "replace"} {
+				combos = append(combos, selftestCombo{ascii, html, controls})
+			}
+		}
+	}
+	return combos
+}
+
+// selftest implements the selftest subcommand: it escapes random strings
+// with each combination of flags and checks the results decode back to the
+// input with both jsonescape.Unescape and encoding/json, and that encoding/json's
+// own escaping of the input unescapes to it too
+func selftest(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	matrix, count, seed := false, 1000, int64(1)
+	for i := 0; i < len(args); i++ {
+		flag, value, hasValue := strings.Cut(args[i], "=")
+		if flag == "--matrix" && !hasValue {
+			matrix = true
+			continue
+		}
+		if flag != "--count" && flag != "--seed" {
+			fmt.Fprintf(stderr, "Error: unknown option: %s\n", args[i])
+			fmt.Fprintf(stderr, "Usage: %s selftest [--matrix] [--count N] [--seed N]\n", name)
+			return exitUsageError
+		}
+		if !hasValue {
+			i++
+			if i >= len(args) {
+				fmt.Fprintf(stderr, "Error: %s requires a value\n", flag)
+				return exitUsageError
+			}
+			value = args[i]
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || flag == "--count" && n < 1 {
+			fmt.Fprintf(stderr, "Error: invalid %s value %q\n", flag, value)
+			return exitUsageError
+		}
+		if flag == "--count" {
+			count = int(n)
+		} else {
+			seed = n
+		}
+	}
+
+	// Every combination sees the same strings
+	r := rand.New(rand.NewSource(seed))
+	inputs := make([]string, count)
+	for i := range inputs {
+		inputs[i] = corpusGenerators[i%len(corpusGenerators)].gen(r)
+	}
+
+	combos := selftestCombos(matrix)
+	failed := 0
+	for _, combo := range combos {
+		var problems []string
+		for _, s := range inputs {
+			if msg := selftestCheck(s, combo); msg != "" {
+				problems = append(problems, msg)
+			}
+		}
+		if len(problems) == 0 {
+			fmt.Fprintf(stdout, "ok    %s\n", combo)
+			continue
+		}
+		failed++
+		fmt.Fprintf(stdout, "FAIL  %s: %d of %d strings diverge\n", combo, len(problems), count)
+		for _, msg := range problems[:min(len(problems), selftestExamples)] {
+			fmt.Fprintf(stdout, "      %s\n", msg)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(stdout, "%d of %d combinations failed\n", failed, len(combos))
+		return exitError
+	}
+	fmt.Fprintf(stdout, "All %d combinations passed (%d strings each)\n", len(combos), count)
+	return exitSuccess
+}
+
+// selftestCheck runs the checks for one string, describing the first
+// divergence found or returning "" if there is none
+func selftestCheck(s string, combo selftestCombo) string {
+	p := &Processor{Config: &Config{
+		ASCIIOnly:   combo.ascii,
+		HTMLSafe:    combo.html,
+		Controls:    combo.controls,
+		ControlRepl: "?",
+	}}
+
+	// What escaping should preserve: the string with each invalid byte
+	// replaced, as ranging over it gives, after the control policy
+	want, _ := applyControlPolicy(string([]rune(s)), combo.controls, "?")
+
+	escaped, err := p.transform(s)
+	if err != nil {
+		return fmt.Sprintf("escaping %q failed: %v", s, err)
+	}
+	if combo.ascii && strings.IndexFunc(escaped, func(r rune) bool { return r > 127 }) >= 0 {
+		return fmt.Sprintf("escaping %q left non-ASCII characters: %q", s, escaped)
+	}
+	if combo.html && strings.ContainsAny(escaped, "<>&") {
+		return fmt.Sprintf("escaping %q left HTML characters: %q", s, escaped)
+	}
+
+	var decoded string
+	if err := json.Unmarshal([]byte(`"`+escaped+`"`), &decoded); err != nil {
+		return fmt.Sprintf("encoding/json rejects %q: %v", escaped, err)
+	}
+	if decoded != want {
+		return fmt.Sprintf("encoding/json decodes %q to %q, want %q", escaped, decoded, want)
+	}
+
+	unescaped, err := jsonescape.Unescape(escaped)
+	if err != nil {
+		return fmt.Sprintf("unescaping %q failed: %v", escaped, err)
+	}
+	if unescaped != want {
+		return fmt.Sprintf("unescaping %q gives %q, want %q", escaped, unescaped, want)
+	}
+
+	marshaled, _ := json.Marshal(want)
+	theirs, err := jsonescape.Unescape(string(marshaled[1 : len(marshaled)-1]))
+	if err != nil {
+		return fmt.Sprintf("unescaping encoding/json output %s failed: %v", marshaled, err)
+	}
+	if theirs != want {
+		return fmt.Sprintf("unescaping encoding/json output %s gives %q, want %q", marshaled, theirs, want)
+	}
+	return ""
+}
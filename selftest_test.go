@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSelftestMatrix(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"selftest", "--matrix", "--count=200"}, strings.NewReader(""), &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0\n%s%s", exitCode, stdout.String(), stderr.String())
+	}
+	if got := strings.Count(stdout.String(), "ok    "); got != 12 {
+		t.Errorf("got %d passing combinations, want 12:\n%s", got, stdout.String())
+	}
+}
+
+func TestSelftestCheck(t *testing.T) {
+	combo := selftestCombo{ascii: true, controls: "strip"}
+	for _, s := range []string{"plain", "tab\there", "\x01\x7f", "bad \xff utf-8", "😀  ", `"\`} {
+		if msg := selftestCheck(s, combo); msg != "" {
+			t.Errorf("selftestCheck(%q): %s", s, msg)
+		}
+	}
+}
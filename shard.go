@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// shardPlaceholder is replaced by the shard number in --output-pattern
+const shardPlaceholder = "{shard}"
+
+// shardWriter splits output across files named by --output-pattern, moving
+// on to the next file once a shard holds --shard-size records or bytes.
+// Records are never split between shards, so a shard limited by bytes can
+// end up to one record larger.
+type shardWriter struct {
+	pattern string
+	records int   // records per shard (0 = limited by bytes)
+	bytes   int64 // bytes per shard (0 = limited by records)
+	cur     *os.File
+	w       *bufio.Writer // buffers writes to cur
+	shards  []shardInfo
+	closed  bool
+}
+
+// shardInfo describes one shard in the manifest
+type shardInfo struct {
+	File    string `json:"file"`
+	Records int    `json:"records"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// shardManifest is written next to the shards once the run ends
+type shardManifest struct {
+	Records int         `json:"records"`
+	Shards  []shardInfo `json:"shards"`
+}
+
+func newShardWriter(config *Config) *shardWriter {
+	return &shardWriter{
+		pattern: config.OutputPattern,
+		records: config.ShardRecords,
+		bytes:   config.ShardBytes,
+	}
+}
+
+// Write writes to the current shard, starting a new one if needed
+func (s *shardWriter) Write(p []byte) (int, error) {
+	if s.cur == nil {
+		path := shardName(s.pattern, len(s.shards))
+		f, err := os.Create(path)
+		if err != nil {
+			return 0, fmt.Errorf("cannot create shard: %w", err)
+		}
+		s.cur = f
+		if s.w == nil {
+			s.w = bufio.NewWriterSize(f, outputBufferSize)
+		} else {
+			s.w.Reset(f)
+		}
+		s.shards = append(s.shards, shardInfo{File: path})
+	}
+	n, err := s.w.Write(p)
+	s.shards[len(s.shards)-1].Bytes += int64(n)
+	return n, err
+}
+
+// endRecord is called after each record has been written, and closes the
+// current shard once it is full
+func (s *shardWriter) endRecord() error {
+	if s.cur == nil {
+		return nil
+	}
+	shard := &s.shards[len(s.shards)-1]
+	shard.Records++
+	if s.records > 0 && shard.Records < s.records || s.bytes > 0 && shard.Bytes < s.bytes {
+		return nil
+	}
+	return s.closeShard()
+}
+
+// closeShard flushes and closes the current shard
+func (s *shardWriter) closeShard() error {
+	err := s.w.Flush()
+	if closeErr := s.cur.Close(); err == nil {
+		err = closeErr
+	}
+	s.cur = nil
+	return err
+}
+
+// Close closes the last shard and writes the manifest
+func (s *shardWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.cur != nil {
+		if err := s.closeShard(); err != nil {
+			return err
+		}
+	}
+
+	// Shards are listed relative to the manifest so the set can be moved
+	path := manifestName(s.pattern)
+	manifest := shardManifest{Shards: []shardInfo{}}
+	for _, shard := range s.shards {
+		if rel, err := filepath.Rel(filepath.Dir(path), shard.File); err == nil {
+			shard.File = filepath.ToSlash(rel)
+		}
+		manifest.Shards = append(manifest.Shards, shard)
+		manifest.Records += shard.Records
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// shardName returns the file name of shard n
+func shardName(pattern string, n int) string {
+	return strings.ReplaceAll(pattern, shardPlaceholder, fmt.Sprintf("%05d", n))
+}
+
+// manifestName returns the file name of the manifest: the pattern with
+// "manifest" for the shard number and a .json extension
+func manifestName(pattern string) string {
+	name := strings.ReplaceAll(pattern, shardPlaceholder, "manifest")
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".json"
+}
+
+// parseShardSize parses a --shard-size value: a number of records, or a
+// number of bytes when followed by B, K, M or G (powers of 1024, with an
+// optional trailing B)
+func parseShardSize(value string) (int, int64, error) {
+	digits := strings.TrimRight(value, "KMGBkmgb")
+	unit := strings.ToUpper(value[len(digits):])
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < 1 {
+		return 0, 0, fmt.Errorf("invalid --shard-size value %q (expected a number of records, or bytes such as 512M)", value)
+	}
+	if unit == "" {
+		return int(n), 0, nil
+	}
+
+	multipliers := map[string]int64{"B": 1, "K": 1 << 10, "KB": 1 << 10, "M": 1 << 20, "MB": 1 << 20, "G": 1 << 30, "GB": 1 << 30}
+	m, ok := multipliers[unit]
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid --shard-size unit in %q (expected B, K, M or G)", value)
+	}
+	return 0, n * m, nil
+}
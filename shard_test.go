@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSharding(t *testing.T) {
+	dir := t.TempDir()
+	pattern := filepath.Join(dir, "out-{shard}.txt")
+
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader("a\nb\nc\nd\ne\n")
+	exitCode := run([]string{"-l", "-q", "--shard-size=2", "--output-pattern", pattern}, stdin, &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+
+	for name, want := range map[string]string{
+		"out-00000.txt": "\"a\"\n\"b\"\n",
+		"out-00001.txt": "\"c\"\n\"d\"\n",
+		"out-00002.txt": "\"e\"\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q (%v), want %q", name, got, err, want)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "out-manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest shardManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	want := shardManifest{Records: 5, Shards: []shardInfo{
+		{"out-00000.txt", 2, 8},
+		{"out-00001.txt", 2, 8},
+		{"out-00002.txt", 1, 4},
+	}}
+	if !reflect.DeepEqual(manifest, want) {
+		t.Errorf("manifest = %+v, want %+v", manifest, want)
+	}
+}
+
+func TestShardingByBytes(t *testing.T) {
+	dir := t.TempDir()
+	pattern := filepath.Join(dir, "{shard}.ndjson")
+
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader("{\"a\":\"x\"}\n{\"b\":2}\n{\"c\":3}\n")
+	args := []string{"--rewrite-strings", "--ndjson-in", "--shard-size", "1K", "--output-pattern", pattern}
+	if exitCode := run(args, stdin, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "00000.ndjson"))
+	if string(got) != "{\"a\":\"x\"}\n{\"b\":2}\n{\"c\":3}\n" {
+		t.Errorf("shard = %q, want all three documents", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00001.ndjson")); err == nil {
+		t.Error("a second shard was written")
+	}
+}
+
+func TestParseShardSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		records int
+		bytes   int64
+	}{
+		{"1000", 1000, 0},
+		{"512B", 0, 512},
+		{"64k", 0, 64 << 10},
+		{"2MB", 0, 2 << 20},
+		{"1G", 0, 1 << 30},
+	}
+	for _, tt := range tests {
+		records, bytes, err := parseShardSize(tt.value)
+		if err != nil || records != tt.records || bytes != tt.bytes {
+			t.Errorf("parseShardSize(%q) = %d, %d, %v; want %d, %d", tt.value, records, bytes, err, tt.records, tt.bytes)
+		}
+	}
+
+	for _, bad := range []string{"", "0", "-5", "10X", "M", "1BB", "1.5G"} {
+		if _, _, err := parseShardSize(bad); err == nil {
+			t.Errorf("parseShardSize(%q) expected error, got nil", bad)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// How much of an input is inspected when guessing whether it is binary
+const sniffSize = 8 * 1024
+
+// looksBinary guesses whether sample is the start of a binary file: text
+// almost never contains NUL bytes, and stays mostly valid UTF-8 even when it
+// is really Latin-1 or similar. NULs are ignored for null-delimited input,
+// where they are the record separator.
+func looksBinary(sample []byte, nullDelimited bool) bool {
+	if len(sample) == 0 {
+		return false
+	}
+
+	var nuls, invalid int
+	for i := 0; i < len(sample); {
+		if sample[i] == 0 {
+			nuls++
+			i++
+			continue
+		}
+		if sample[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		if !utf8.FullRune(sample[i:]) {
+			break // truncated by the sample size, not necessarily invalid
+		}
+		r, size := utf8.DecodeRune(sample[i:])
+		if r == utf8.RuneError && size == 1 {
+			invalid++
+		}
+		i += size
+	}
+
+	if !nullDelimited && nuls*100 > len(sample) {
+		return true
+	}
+	return invalid*10 > len(sample)
+}
+
+// sniffStream reads the first chunk of r, up to sniffSize bytes, without
+// waiting for more than is available so streaming input isn't held up. It
+// returns that chunk and a reader that still yields all of r.
+func sniffStream(r io.Reader) ([]byte, io.Reader, error) {
+	buf := make([]byte, sniffSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 || err == io.EOF {
+			return buf[:n], io.MultiReader(bytes.NewReader(buf[:n]), r), nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// sniffResult is what --sniff found out about one input
+type sniffResult struct {
+	size     int
+	encoding string // best guess
+	bom      string // the encoding a byte order mark names, if there is one
+	lf       int    // newlines of each convention
+	crlf     int
+	cr       int
+	chars    int
+	escaped  int // characters escaping would rewrite
+	invalid  int // invalid sequences
+	first    int // byte offset of the first invalid sequence
+}
+
+// sniffReport analyzes an input for --sniff and writes what it found to
+// p.Output, without transforming anything
+func (p *Processor) sniffReport(r io.Reader, source string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return msgf("reading input: %w", err)
+	}
+	s := sniffData(data, p.Config.ASCIIOnly, p.Config.HTMLSafe)
+
+	var buf bytes.Buffer
+	if p.sniffed {
+		buf.WriteString("\n")
+	}
+	p.sniffed = true
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s:\n", source)
+	fmt.Fprintf(tw, "  size:\t%d bytes\n", s.size)
+	fmt.Fprintf(tw, "  encoding:\t%s\n", s.encoding)
+	bom := "none"
+	if s.bom != "" {
+		bom = s.bom
+	}
+	fmt.Fprintf(tw, "  bom:\t%s\n", bom)
+	fmt.Fprintf(tw, "  newlines:\t%s\n", s.newlines())
+	pct := 0.0
+	if s.chars > 0 {
+		pct = 100 * float64(s.escaped) / float64(s.chars)
+	}
+	fmt.Fprintf(tw, "  escaped:\t%d of %d characters (%.1f%%)\n", s.escaped, s.chars, pct)
+	if s.invalid > 0 {
+		fmt.Fprintf(tw, "  invalid:\t%d (the first at byte %d)\n", s.invalid, s.first)
+	} else {
+		fmt.Fprintf(tw, "  invalid:\tnone\n")
+	}
+	tw.Flush()
+
+	if _, err := p.Output.Write(buf.Bytes()); err != nil {
+		return &writeError{err}
+	}
+	return nil
+}
+
+// sniffData works out the likely encoding of data and, reading it as that,
+// its newline convention and how much of it escaping with the given options
+// would touch
+func sniffData(data []byte, asciiOnly, htmlSafe bool) sniffResult {
+	s := sniffResult{size: len(data)}
+	body, offset := data, 0
+	switch {
+	case bytes.HasPrefix(data, []byte("\xef\xbb\xbf")):
+		s.bom, s.encoding = "utf-8", "utf-8"
+		body, offset = data[3:], 3
+	case bytes.HasPrefix(data, []byte("\xff\xfe")):
+		s.bom, s.encoding = "utf-16le", "utf-16le"
+		body, offset = data[2:], 2
+	case bytes.HasPrefix(data, []byte("\xfe\xff")):
+		s.bom, s.encoding = "utf-16be", "utf-16be"
+		body, offset = data[2:], 2
+	default:
+		s.encoding = guessEncoding(data)
+	}
+
+	var prev rune
+	note := func(r rune, invalid bool, at int) {
+		s.chars++
+		switch {
+		case r == '\n' && prev == '\r':
+			s.cr--
+			s.crlf++
+		case r == '\n':
+			s.lf++
+		case r == '\r':
+			s.cr++
+		}
+		prev = r
+		if invalid {
+			if s.invalid == 0 {
+				s.first = at
+			}
+			s.invalid++
+		}
+		if invalid || wouldEscape(r, asciiOnly, htmlSafe) {
+			s.escaped++
+		}
+	}
+
+	if s.encoding == "utf-16le" || s.encoding == "utf-16be" {
+		order := binary.ByteOrder(binary.LittleEndian)
+		if s.encoding == "utf-16be" {
+			order = binary.BigEndian
+		}
+		for i := 0; i+1 < len(body); i += 2 {
+			u := rune(order.Uint16(body[i:]))
+			if utf16.IsSurrogate(u) && u < 0xDC00 && i+3 < len(body) {
+				if r := utf16.DecodeRune(u, rune(order.Uint16(body[i+2:]))); r != utf8.RuneError {
+					note(r, false, offset+i)
+					i += 2
+					continue
+				}
+			}
+			note(u, utf16.IsSurrogate(u), offset+i)
+		}
+		if len(body)%2 == 1 {
+			note(utf8.RuneError, true, offset+len(body)-1)
+		}
+		return s
+	}
+
+	for i := 0; i < len(body); {
+		r, size := utf8.DecodeRune(body[i:])
+		note(r, r == utf8.RuneError && size == 1, offset+i)
+		i += size
+	}
+	return s
+}
+
+// guessEncoding guesses the encoding of data that has no byte order mark.
+// UTF-16 text shows up as NULs in every other byte; anything else is UTF-8
+// if it decodes as such, and likely a legacy 8-bit encoding if it mostly does.
+func guessEncoding(data []byte) string {
+	var nuls [2]int
+	for i, c := range data {
+		if c == 0 {
+			nuls[i%2]++
+		}
+	}
+	half := len(data) / 2
+	switch {
+	case half > 0 && nuls[1]*10 > half*9 && nuls[0]*10 < half:
+		return "utf-16le"
+	case half > 0 && nuls[0]*10 > half*9 && nuls[1]*10 < half:
+		return "utf-16be"
+	case looksBinary(data, false):
+		return "binary"
+	case utf8.Valid(data):
+		for _, c := range data {
+			if c >= utf8.RuneSelf {
+				return "utf-8"
+			}
+		}
+		return "ascii"
+	}
+	return "latin-1 or another 8-bit encoding (not valid UTF-8)"
+}
+
+// wouldEscape reports whether escaping with the given options rewrites r
+func wouldEscape(r rune, asciiOnly, htmlSafe bool) bool {
+	switch {
+	case r < 0x20, r == '"', r == '\\':
+		return true
+	case r == '<', r == '>', r == '&':
+		return htmlSafe
+	}
+	return asciiOnly && r >= utf8.RuneSelf
+}
+
+// newlines describes the newline convention of the input
+func (s *sniffResult) newlines() string {
+	var kinds []string
+	for _, k := range []struct {
+		n    int
+		name string
+	}{{s.lf, "lf"}, {s.crlf, "crlf"}, {s.cr, "cr"}} {
+		if k.n > 0 {
+			kinds = append(kinds, fmt.Sprintf("%s (%d)", k.name, k.n))
+		}
+	}
+	switch len(kinds) {
+	case 0:
+		return "none"
+	case 1:
+		return kinds[0]
+	}
+	return "mixed: " + strings.Join(kinds, ", ")
+}
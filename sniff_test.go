@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLooksBinary(t *testing.T) {
+	tests := []struct {
+		name          string
+		sample        []byte
+		nullDelimited bool
+		expected      bool
+	}{
+		{"empty", nil, false, false},
+		{"plain text", []byte("hello world\n"), false, false},
+		{"utf-8 text", []byte("日本語テキスト 👋"), false, false},
+		{"png header", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x01\x00"), false, true},
+		{"utf-16 text", []byte("h\x00e\x00l\x00l\x00o\x00"), false, true},
+		{"mostly latin-1", []byte("caf\xe9 cr\xe8me br\xfbl\xe9e and a long tail of ascii"), false, false},
+		{"random high bytes", []byte("\xff\xfe\xfd\xfc\xfb\xfa\xf9\xf8"), false, true},
+		{"nul-separated text", []byte("one\x00two\x00three\x00"), true, false},
+		{"truncated rune at end", []byte("abc\xe6\x97"), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksBinary(tt.sample, tt.nullDelimited); got != tt.expected {
+				t.Errorf("looksBinary(%q, %v) = %v, want %v", tt.sample, tt.nullDelimited, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBinaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	text := filepath.Join(dir, "a.txt")
+	binary := filepath.Join(dir, "b.png")
+	if err := os.WriteFile(text, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(binary, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+		exitCode int
+	}{
+		{"refused by default", []string{"-f", text, "-f", binary}, "hello\n", 1},
+		{"skipped", []string{"--skip-binary", "-f", binary, "-f", text}, "hello\n", 0},
+		{"forced", []string{"--force-binary", "-f", binary}, `�PNG\r\n\u001a\n\u0000\u0000\u0000\rIHDR` + "\n", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			exitCode := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+			if exitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", exitCode, tt.exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestBinaryStdin(t *testing.T) {
+	flood := strings.Repeat("\x00\x01\x02", 100)
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+		exitCode int
+	}{
+		{"text", nil, strings.Repeat("text ", 30) + "\x00", strings.Repeat("text ", 30) + `\u0000` + "\n", 0},
+		{"refused", nil, flood, "", 1},
+		{"assume text", []string{"--assume-text"}, "\x00\x00", `\u0000\u0000` + "\n", 0},
+		{"forced", []string{"--force-binary"}, "\x00\x00", `\u0000\u0000` + "\n", 0},
+		{"skipped", []string{"--skip-binary"}, flood, "", 0},
+		{"null delimited", []string{"-0"}, "a\x00b\x00", "a\nb\n", 0},
+		{"unescape", []string{"-u"}, "\x00\x00", "\x00\x00\n", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			exitCode := run(append(tt.args, "--stdin"), strings.NewReader(tt.input), &stdout, &stderr)
+			if exitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", exitCode, tt.exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestSniffData(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		encoding string
+		bom      string
+		newlines string
+		escaped  int
+		invalid  int
+		first    int
+	}{
+		{"ascii", []byte("plain\ntext\n"), "ascii", "", "lf (2)", 2, 0, 0},
+		{"utf-8 with bom", []byte("\xef\xbb\xbfcafé\r\n"), "utf-8", "utf-8", "crlf (1)", 2, 0, 0},
+		{"latin-1", []byte("caf\xe9 \"x\" in a longer line"), "latin-1 or another 8-bit encoding (not valid UTF-8)", "", "none", 3, 1, 3},
+		{"mixed newlines", []byte("a\r\nb\nc\rd"), "ascii", "", "mixed: lf (1), crlf (1), cr (1)", 4, 0, 0},
+		{"utf-16le", []byte("h\x00i\x00\n\x00"), "utf-16le", "", "lf (1)", 1, 0, 0},
+		{"utf-16be with bom", []byte("\xfe\xff\x00h\xd8\x3d\xde\x00\xdc\x00"), "utf-16be", "utf-16be", "none", 1, 1, 8},
+		{"binary", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "binary", "", "mixed: lf (1), crlf (1), cr (1)", 9, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := sniffData(tt.data, false, false)
+			got := []any{s.encoding, s.bom, s.newlines(), s.escaped, s.invalid, s.first}
+			want := []any{tt.encoding, tt.bom, tt.newlines, tt.escaped, tt.invalid, tt.first}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Errorf("sniffData(%q) = %v, want %v", tt.data, got, want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestSniffReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blob.bin")
+	if err := os.WriteFile(path, []byte("\x00\x01\x02\x03binary\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"--sniff", "--ascii", "-f", path, "--label", "blob", "café"}, strings.NewReader(""), &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	for _, want := range []string{"argument 1:\n", "  escaped:   1 of 4 characters (25.0%)\n", "\n\nblob:\n", "  encoding:  binary\n"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("stdout = %q, want it to contain %q", stdout.String(), want)
+		}
+	}
+}
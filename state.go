@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How often --state-file is rewritten while records are being processed
+const checkpointInterval = time.Second
+
+// runState is the progress recorded in --state-file: how many records have
+// been written and how many bytes of output they took, and digests of the
+// options and of those records' input so a run is only resumed with the
+// same ones
+type runState struct {
+	Records int    `json:"records"`
+	Output  int64  `json:"output"`
+	Options string `json:"options"`
+	Input   string `json:"input"`
+}
+
+// checkpointer periodically saves the progress of a run writing to an output
+// file so it can be continued with --resume
+type checkpointer struct {
+	path string
+	out  *os.File
+	n    *countingWriter
+	last time.Time
+	// flush pushes buffered output through to n before it is counted
+	flush func() error
+
+	options string
+	// Digest of the input of the first inputs records, and of one fewer in
+	// prev, since the last record seen may have failed before it counted
+	sum, prev [sha256.Size]byte
+	inputs    int
+	resumed   string // the input digest to match once the skipped records are read
+	keep      bool   // leave the state file alone; it is not this run's
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// optionsDigest fingerprints the command line of a run, less --resume
+func optionsDigest(args []string) string {
+	h := sha256.New()
+	for _, arg := range args {
+		if arg != "--resume" {
+			h.Write([]byte(arg))
+			h.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// openCheckpointed opens the output file of a run using --state-file. When
+// resuming, output beyond the last checkpoint is cut off so records written
+// after it are not duplicated, and the number of records to skip is
+// returned.
+func openCheckpointed(config *Config, args []string) (*os.File, *checkpointer, int, error) {
+	var state runState
+	options := optionsDigest(args)
+	if config.Resume {
+		data, err := os.ReadFile(config.StateFile)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, 0, fmt.Errorf("cannot read state file: %w", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &state); err != nil {
+				return nil, nil, 0, fmt.Errorf("invalid state file %q: %w", config.StateFile, err)
+			}
+			if state.Records > 0 && state.Options != options {
+				return nil, nil, 0, fmt.Errorf("cannot resume from %q: the options differ from those of the interrupted run", config.StateFile)
+			}
+		}
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if state.Records == 0 {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(config.OutputFile, flags, 0o666)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("cannot create output file: %w", err)
+	}
+	if state.Records > 0 {
+		if err := f.Truncate(state.Output); err != nil {
+			f.Close()
+			return nil, nil, 0, fmt.Errorf("cannot resume output file: %w", err)
+		}
+		if _, err := f.Seek(state.Output, io.SeekStart); err != nil {
+			f.Close()
+			return nil, nil, 0, fmt.Errorf("cannot resume output file: %w", err)
+		}
+	}
+
+	c := &checkpointer{
+		path: config.StateFile,
+		out:  f,
+		n:    &countingWriter{w: f, n: state.Output},
+		last: time.Now(),
+
+		options: options,
+	}
+	if state.Records > 0 {
+		c.resumed = state.Input
+	}
+	return f, c, state.Records, nil
+}
+
+// input adds record i, whose input is s, to the input digest
+func (c *checkpointer) input(i int, s string) {
+	if i != c.inputs {
+		return
+	}
+	h := sha256.New()
+	h.Write(c.sum[:])
+	h.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	h.Write([]byte(s))
+	c.prev = c.sum
+	h.Sum(c.sum[:0])
+	c.inputs++
+}
+
+// verify checks, once the records written by the interrupted run have been
+// read again, that they are the ones it read
+func (c *checkpointer) verify() error {
+	if hex.EncodeToString(c.sum[:]) != c.resumed {
+		c.keep = true
+		return errors.New("cannot resume: the input differs from that of the interrupted run")
+	}
+	return nil
+}
+
+// recordDone saves a checkpoint if the last one is old enough
+func (c *checkpointer) recordDone(records int) error {
+	if time.Since(c.last) < checkpointInterval {
+		return nil
+	}
+	return c.save(records)
+}
+
+// save makes the output written so far durable and then records it in the
+// state file, replacing the old one atomically
+func (c *checkpointer) save(records int) error {
+	if c.keep {
+		return nil
+	}
+	c.last = time.Now()
+	if c.flush != nil {
+		if err := c.flush(); err != nil {
+			return &writeError{err}
+		}
+	}
+	if err := c.out.Sync(); err != nil {
+		return fmt.Errorf("syncing output: %w", err)
+	}
+
+	sum := c.sum
+	if records < c.inputs {
+		sum = c.prev
+	}
+	data, err := json.Marshal(runState{Records: records, Output: c.n.n, Options: c.options, Input: hex.EncodeToString(sum[:])})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	return nil
+}
+
+// finish removes the state file once the run has completed, unless the
+// input ran out before the records it was resumed after
+func (c *checkpointer) finish(skipped int) error {
+	if skipped > 0 {
+		c.keep = true
+		return errors.New("cannot resume: the input is shorter than that of the interrupted run")
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("removing state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStateFileResume(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.txt")
+	stateFile := filepath.Join(dir, "run.state")
+	args := []string{"-u", "-l", "--state-file", stateFile, "-o", out}
+
+	// The third record fails, leaving a checkpoint after the second
+	var stdout, stderr bytes.Buffer
+	exitCode := run(append(args, "--resume"), strings.NewReader("a\\tb\nc\nbad\\x\nd\n"), &stdout, &stderr)
+	if exitCode != 1 {
+		t.Fatalf("exit code = %d, want 1", exitCode)
+	}
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("state file not written: %v", err)
+	}
+	var state runState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("invalid state file: %v", err)
+	}
+	if state.Records != 2 || state.Output != 6 {
+		t.Errorf("state = %s, want 2 records and 6 bytes", data)
+	}
+
+	// Output written after the checkpoint is dropped on resume
+	f, _ := os.OpenFile(out, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("partial")
+	f.Close()
+
+	stderr.Reset()
+	exitCode = run(append(args, "--resume"), strings.NewReader("a\\tb\nc\nfixed\\u0021\nd\n"), &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	got, _ := os.ReadFile(out)
+	if string(got) != "a\tb\nc\nfixed!\nd\n" {
+		t.Errorf("output = %q, want the resumed run appended after the checkpoint", got)
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("state file still exists after a completed run")
+	}
+
+	// Resuming without a state file starts from scratch
+	exitCode = run(append(args, "--resume"), strings.NewReader("x\n"), &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	if got, _ := os.ReadFile(out); string(got) != "x\n" {
+		t.Errorf("output = %q, want a fresh run", got)
+	}
+}
+
+func TestStateFileResumeMismatch(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.txt")
+	stateFile := filepath.Join(dir, "run.state")
+	args := []string{"-u", "-l", "--state-file", stateFile, "-o", out, "--resume"}
+	input := "a\\tb\nc\nbad\\x\nd\n"
+
+	tests := []struct {
+		name  string
+		args  []string
+		input string
+		err   string
+	}{
+		{"changed input", args, "a\\tb\nC\nfixed\nd\n", "the input differs"},
+		{"short input", args, "a\\tb\n", "the input is shorter"},
+		{"changed options", append(args, "-a"), input, "the options differ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if exitCode := run(args, strings.NewReader(input), &stdout, &stderr); exitCode != 1 {
+				t.Fatalf("exit code = %d, want 1", exitCode)
+			}
+			before, err := os.ReadFile(stateFile)
+			if err != nil {
+				t.Fatalf("state file not written: %v", err)
+			}
+
+			stderr.Reset()
+			if exitCode := run(tt.args, strings.NewReader(tt.input), &stdout, &stderr); exitCode != 1 {
+				t.Fatalf("exit code = %d, want 1", exitCode)
+			}
+			if !strings.Contains(stderr.String(), tt.err) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.err)
+			}
+			if after, _ := os.ReadFile(stateFile); string(after) != string(before) {
+				t.Errorf("state file = %s, want it left as %s", after, before)
+			}
+		})
+	}
+}
+
+func TestStateFileResumeEncoding(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.txt")
+	args := []string{"-u", "-l", "--state-file", filepath.Join(dir, "run.state"), "-o", out, "--output-encoding", "utf-16le", "--resume"}
+
+	var stdout, stderr bytes.Buffer
+	run(args, strings.NewReader("a\nbad\\x\n"), &stdout, &stderr)
+	if exitCode := run(args, strings.NewReader("a\nb\n"), &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	got, _ := os.ReadFile(out)
+	if want := "\xff\xfea\x00\n\x00b\x00\n\x00"; string(got) != want {
+		t.Errorf("output = %q, want %q with one byte order mark", got, want)
+	}
+}
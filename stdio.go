@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Largest request --stdio-server accepts, so a corrupt length prefix
+// cannot make it allocate gigabytes
+const maxStdioRequest = 64 << 20
+
+// Response statuses in the --stdio-server protocol
+const (
+	stdioOK    = 0
+	stdioError = 1
+)
+
+// serveStdio runs the --stdio-server protocol until r is exhausted. Each
+// request is a 4-byte big-endian length followed by that many bytes of
+// input; each response is a status byte (0 for success, 1 for an error), a
+// 4-byte big-endian length and the output or the error message. Requests
+// are processed with the options the server was started with.
+func (p *Processor) serveStdio(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	var header [4]byte
+	for {
+		if _, err := io.ReadFull(br, header[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading request %d: %w", p.count+1, err)
+		}
+		n := binary.BigEndian.Uint32(header[:])
+		if n > maxStdioRequest {
+			return fmt.Errorf("request %d is %d bytes, more than the limit of %d", p.count+1, n, maxStdioRequest)
+		}
+		input := make([]byte, n)
+		if _, err := io.ReadFull(br, input); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("reading request %d: %w", p.count+1, err)
+		}
+
+		p.record = Record{Index: p.count, Source: "request"}
+		status := byte(stdioOK)
+		result, err := p.render(string(input))
+		if err != nil {
+			status, result = stdioError, err.Error()
+		}
+		bw.WriteByte(status)
+		binary.BigEndian.PutUint32(header[:], uint32(len(result)))
+		bw.Write(header[:])
+		bw.WriteString(result)
+
+		// The client is waiting for this response before sending more
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("writing response %d: %w", p.count+1, err)
+		}
+		p.count++
+	}
+}
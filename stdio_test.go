@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// stdioFrames builds --stdio-server requests
+func stdioFrames(inputs ...string) []byte {
+	var buf bytes.Buffer
+	for _, s := range inputs {
+		binary.Write(&buf, binary.BigEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}
+	return buf.Bytes()
+}
+
+type stdioResponse struct {
+	status byte
+	body   string
+}
+
+func readStdioResponses(t *testing.T, data []byte) []stdioResponse {
+	var responses []stdioResponse
+	for len(data) > 0 {
+		if len(data) < 5 {
+			t.Fatalf("truncated response %q", data)
+		}
+		n := binary.BigEndian.Uint32(data[1:5])
+		responses = append(responses, stdioResponse{data[0], string(data[5 : 5+n])})
+		data = data[5+n:]
+	}
+	return responses
+}
+
+func TestStdioServer(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	stdin := bytes.NewReader(stdioFrames(`say "hi"`, "", "line\nbreak"))
+	if exitCode := run([]string{"--stdio-server", "-q"}, stdin, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	got := readStdioResponses(t, stdout.Bytes())
+	want := []stdioResponse{{0, `"say \"hi\""`}, {0, `""`}, {0, `"line\nbreak"`}}
+	if len(got) != len(want) {
+		t.Fatalf("responses = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("response %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestStdioServerErrors(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	stdin := bytes.NewReader(stdioFrames(`bad\x`, `ok`))
+	if exitCode := run([]string{"--stdio-server", "-u"}, stdin, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", exitCode, stderr.String())
+	}
+	got := readStdioResponses(t, stdout.Bytes())
+	if len(got) != 2 || got[0].status != 1 || !strings.Contains(got[0].body, "invalid escape") || got[1] != (stdioResponse{0, "ok"}) {
+		t.Errorf("responses = %q", got)
+	}
+
+	// A request cut off partway ends the session with an error
+	stdout.Reset()
+	stdin = bytes.NewReader(stdioFrames("complete", "truncated")[:20])
+	if exitCode := run([]string{"--stdio-server"}, stdin, &stdout, &stderr); exitCode != 1 {
+		t.Errorf("exit code = %d, want 1 for a truncated request", exitCode)
+	}
+	if got := readStdioResponses(t, stdout.Bytes()); len(got) != 1 {
+		t.Errorf("responses = %q, want only the complete request answered", got)
+	}
+}
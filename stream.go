@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// streamChunkSize is how much input --stream reads at a time
+const streamChunkSize = 64 * 1024
+
+// minFlushBytes is the smallest --flush-bytes, room enough for a surrogate
+// pair written as two escapes with blanks in them
+const minFlushBytes = 64
+
+// processStream escapes or unescapes all of r as one record, like the
+// default mode, but a chunk at a time so that memory use doesn't grow with
+// the input
+func (p *Processor) processStream(r io.Reader, source string) error {
+	start := time.Now()
+	rec := Record{Index: p.count, Source: source, Line: 1}
+	p.record = rec
+	if p.skip > 0 {
+		return p.skipRecord(rec, start)
+	}
+
+	if err := p.streamRecord(r); err != nil {
+		var we *writeError
+		if !errors.As(err, &we) {
+			// What was written before the failure stays written
+			p.traceRecord(rec, "", start, err)
+			err = &locationError{rec.location(), err}
+		}
+		return err
+	}
+	if err := p.writeRecord(""); err != nil {
+		return err
+	}
+	return p.endRecord(start)
+}
+
+// streamRecord reads r a chunk at a time, transforming each chunk and
+// writing it out. A UTF-8 sequence or escape split across chunks is carried
+// over to the next one, as is a line ending that may turn out to end the
+// input and so be trimmed like in the default mode.
+func (p *Processor) streamRecord(r io.Reader) error {
+	// The separator held back after the last record goes out first
+	start := p.held
+	p.held = ""
+	if p.Config.WrapQuotes {
+		start += `"`
+	}
+	if _, err := io.WriteString(p.Output, start); err != nil {
+		return &writeError{err}
+	}
+
+	// Output is unbuffered under --flush-bytes, so each chunk goes out as
+	// soon as it is written
+	size := streamChunkSize
+	if p.Config.FlushBytes > 0 {
+		size = p.Config.FlushBytes
+	}
+	buf := make([]byte, size)
+	have := 0
+	invalidRun := false
+	for {
+		n, err := r.Read(buf[have:])
+		have += n
+		eof := err == io.EOF
+		if err != nil && !eof {
+			return msgf("reading input: %w", err)
+		}
+
+		end := have
+		if eof {
+			end = trimmedLen(buf[:have])
+			p.record.Newline = bytes.HasSuffix(buf[:have], []byte("\n"))
+		} else if p.Config.Unescape {
+			end -= max(carryLen(buf[:have]), escapeCarryLen(buf[:have], !p.Config.StrictHex))
+		} else {
+			end -= carryLen(buf[:have])
+		}
+		if end == 0 && have == len(buf) {
+			// No real escape fills a whole chunk; let transform reject it
+			end = have
+		}
+		if end > 0 {
+			chunk := string(buf[:end])
+			in := chunk
+			if p.Config.ReplaceUTF8 {
+				in, invalidRun = replaceInvalid(chunk, invalidRun)
+			}
+			result, err := p.transform(in)
+			p.noteStats(chunk, result, err != nil)
+			if err != nil {
+				return err
+			}
+			p.record.Changed = p.record.Changed || result != chunk
+			if _, err := io.WriteString(p.Output, result); err != nil {
+				return &writeError{err}
+			}
+		}
+		if eof {
+			break
+		}
+		have = copy(buf, buf[end:have])
+	}
+
+	if p.Config.WrapQuotes {
+		if _, err := io.WriteString(p.Output, `"`); err != nil {
+			return &writeError{err}
+		}
+	}
+	return nil
+}
+
+// carryLen returns how many bytes at the end of b to hold back for the next
+// chunk: an incomplete UTF-8 sequence, or else a trailing \n, \r or \r\n
+func carryLen(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return len(b) - i
+			}
+			break
+		}
+	}
+	return len(b) - trimmedLen(b)
+}
+
+// escapeCarryLen returns how many bytes at the end of b to hold back when
+// unescaping it a chunk at a time: an escape cut short by the end of b, or
+// a \uXXXX high surrogate whose low half may start the next chunk, along
+// with a high surrogate just before a cut-short escape
+func escapeCarryLen(b []byte, lenient bool) int {
+	// Backslashes inside escapes come in pairs, so the last one not part of
+	// a \\ starts the last escape
+	last, prev := -1, -1
+	for i := 0; i < len(b); i++ {
+		if b[i] == '\\' {
+			prev, last = last, i
+			i++
+		}
+	}
+	if last < 0 {
+		return 0
+	}
+
+	cutShort := last+1 == len(b)
+	if !cutShort && (b[last+1] == 'u' || lenient && b[last+1] == 'U') {
+		r, n, complete := partialUnicodeEscape(b[last:], lenient)
+		if complete {
+			if r >= 0xD800 && r <= 0xDBFF && last+n == len(b) {
+				return len(b) - last
+			}
+			return 0
+		}
+		cutShort = true
+	}
+	if !cutShort {
+		return 0
+	}
+	if prev >= 0 {
+		if r, n, complete := partialUnicodeEscape(b[prev:], lenient); complete && r >= 0xD800 && r <= 0xDBFF && prev+n == last {
+			return len(b) - prev
+		}
+	}
+	return len(b) - last
+}
+
+// partialUnicodeEscape reads the \uXXXX escape at the start of b as the
+// unescaper would, returning the code unit and the escape's length. It
+// reports whether b holds the whole escape; one with a bad digit counts as
+// whole, with a code unit of -1, since more input can't fix it.
+func partialUnicodeEscape(b []byte, lenient bool) (rune, int, bool) {
+	if b[1] != 'u' && !(lenient && b[1] == 'U') {
+		return -1, 0, false
+	}
+	var hex []byte
+	n := 2
+	for ; n < len(b) && len(hex) < 4; n++ {
+		if lenient && (b[n] == ' ' || b[n] == '\t') {
+			continue
+		}
+		hex = append(hex, b[n])
+	}
+	if len(hex) < 4 {
+		for _, c := range hex {
+			if _, err := parseHexRune(string(c)); err != nil {
+				return -1, n, true
+			}
+		}
+		return -1, n, false
+	}
+	r, err := parseHexRune(string(hex))
+	if err != nil {
+		return -1, n, true
+	}
+	return r, n, true
+}
+
+// replaceInvalid is strings.ToValidUTF8 for one chunk of a stream. inRun
+// says whether the chunk before ended in invalid bytes, so that a run of
+// them split across chunks still gets a single U+FFFD.
+func replaceInvalid(s string, inRun bool) (string, bool) {
+	var buf strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			if !inRun {
+				buf.WriteRune(utf8.RuneError)
+			}
+			inRun = true
+		} else {
+			buf.WriteString(s[i : i+size])
+			inRun = false
+		}
+		i += size
+	}
+	return buf.String(), inRun
+}
+
+// trimmedLen returns the length of b without a final \n and then a final
+// \r, which the default mode trims from its input
+func trimmedLen(b []byte) int {
+	n := len(b)
+	if n > 0 && b[n-1] == '\n' {
+		n--
+	}
+	if n > 0 && b[n-1] == '\r' {
+		n--
+	}
+	return n
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+)
+
+func TestStreamMatchesWholeInput(t *testing.T) {
+	inputs := []string{
+		"",
+		"plain",
+		"line1\nline2\n",
+		"crlf\r\n",
+		"two newlines\n\n",
+		"café \U0001F600 \"quoted\"\t",
+		"bad \xff\xe2\x82 bytes",
+		strings.Repeat("xé\n", streamChunkSize/2),
+	}
+	flagSets := [][]string{
+		nil,
+		{"-q"},
+		{"--ascii", "--html-safe"},
+		{"--replace"},
+		{"--controls", "strip"},
+	}
+
+	for _, input := range inputs {
+		for _, flags := range flagSets {
+			args := append([]string{"--stdin", "--assume-text"}, flags...)
+			var want, got, stderr bytes.Buffer
+			run(args, strings.NewReader(input), &want, &stderr)
+
+			// Reading a byte at a time splits every sequence that can be split
+			exitCode := run(append(args, "--stream"), iotest.OneByteReader(strings.NewReader(input)), &got, &stderr)
+			if exitCode != 0 || got.String() != want.String() {
+				t.Errorf("--stream %v on %.20q = %d, %.40q, want 0, %.40q", flags, input, exitCode, got.String(), want.String())
+			}
+		}
+	}
+}
+
+func TestStreamUnescape(t *testing.T) {
+	inputs := []string{
+		`plain`,
+		`a\\nb\\`,
+		`\"quoted\" \u00e9\n`,
+		`\ud83d\ude00`,
+		`\ud83d\ude00\ud83d`,
+		`\ud83d x \ude00`,
+		`\U0041 \u00 42 \ud83d\U de00`,
+		`bad \x escape`,
+		`cut short \u00`,
+		`\u00e9` + "\r\n",
+		strings.Repeat(`\ud83d\ude00\\`, streamChunkSize/8),
+	}
+
+	for _, input := range inputs {
+		for _, flags := range [][]string{{"-u"}, {"-u", "--strict-hex"}} {
+			args := append([]string{"--stdin"}, flags...)
+			var want, wantErr, got, gotErr bytes.Buffer
+			wantCode := run(args, strings.NewReader(input), &want, &wantErr)
+			exitCode := run(append(args, "--stream"), iotest.OneByteReader(strings.NewReader(input)), &got, &gotErr)
+			if wantCode != 0 {
+				// Output from before the error has already gone out
+				got.Reset()
+			}
+			if exitCode != wantCode || got.String() != want.String() || gotErr.String() != wantErr.String() {
+				t.Errorf("--stream %v on %.20q = %d, %.40q, %q, want %d, %.40q, %q", flags, input,
+					exitCode, got.String(), gotErr.String(), wantCode, want.String(), wantErr.String())
+			}
+		}
+	}
+}
+
+func TestStreamStrict(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"--stream", "--stdin", "--assume-text", "--strict"}, strings.NewReader("ok \xe2\x82"), &stdout, &stderr)
+	if exitCode != 1 || !strings.Contains(stderr.String(), "invalid UTF-8") {
+		t.Errorf("exit code = %d, stderr = %q, want an invalid UTF-8 error", exitCode, stderr.String())
+	}
+}
+
+// writeLog keeps each write separately
+type writeLog struct{ writes []string }
+
+func (w *writeLog) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func TestStreamFlushBytes(t *testing.T) {
+	tests := []struct {
+		args  []string
+		input string
+	}{
+		{nil, strings.Repeat("é\"\U0001F600\t", 40)},
+		{[]string{"-u"}, strings.Repeat(`é😀\\\ud83d\ude00`, 40)},
+	}
+
+	for _, tt := range tests {
+		var want, stderr bytes.Buffer
+		args := append([]string{"--stdin", "--assume-text"}, tt.args...)
+		run(args, strings.NewReader(tt.input), &want, &stderr)
+
+		var got writeLog
+		args = append(args, "--stream", "--flush-bytes", "64")
+		if exitCode := run(args, strings.NewReader(tt.input), &got, &stderr); exitCode != 0 {
+			t.Fatalf("%v: exit code = %d, want 0 (stderr: %s)", args, exitCode, stderr.String())
+		}
+		if strings.Join(got.writes, "") != want.String() {
+			t.Errorf("%v wrote %q, want %q", args, strings.Join(got.writes, ""), want.String())
+		}
+		if len(got.writes) < len(tt.input)/64 {
+			t.Errorf("%v: %d writes for %d bytes of input", args, len(got.writes), len(tt.input))
+		}
+		// Every chunk stands on its own
+		for _, w := range got.writes {
+			escaped := len(tt.args) == 0
+			if !utf8.ValidString(w) || escaped && strings.HasSuffix(strings.ReplaceAll(w, `\\`, ""), `\`) {
+				t.Errorf("%v: write %q splits a character or escape", args, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// substMatch is the data a --subst-template is executed with
+type substMatch struct {
+	Match   string   // the text the pattern matched
+	Escaped string   // the match escaped, or unescaped under --unescape
+	Groups  []string // the pattern's capture groups, from 1
+}
+
+// parseSubstTemplate compiles a --subst-template
+func parseSubstTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("subst").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --subst-template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// processSubst replaces every match of the --subst pattern in r with its
+// transformed form, or with --subst-template filled in for it, and copies
+// the rest through unchanged. Each match is a record. As with --between,
+// nothing is written unless every match transforms cleanly.
+func (p *Processor) processSubst(r io.Reader, source string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return msgf("reading input: %w", err)
+	}
+	text := string(data)
+
+	var out strings.Builder
+	pos := 0
+	for _, loc := range p.Config.Subst.FindAllStringSubmatchIndex(text, -1) {
+		match := text[loc[0]:loc[1]]
+		rec := Record{
+			Source: source,
+			Line:   1 + strings.Count(text[:loc[0]], "\n"),
+			Offset: int64(loc[0]),
+		}
+		result, err := p.transformRegion(match, rec)
+		if err != nil {
+			return err
+		}
+
+		out.WriteString(text[pos:loc[0]])
+		if tmpl := p.Config.SubstTemplate; tmpl != nil {
+			m := substMatch{Match: match, Escaped: result}
+			for i := 2; i < len(loc); i += 2 {
+				if loc[i] >= 0 {
+					m.Groups = append(m.Groups, text[loc[i]:loc[i+1]])
+				} else {
+					m.Groups = append(m.Groups, "")
+				}
+			}
+			if err := tmpl.Execute(&out, m); err != nil {
+				return &locationError{rec.location(), err}
+			}
+		} else {
+			out.WriteString(result)
+		}
+		pos = loc[1]
+	}
+	out.WriteString(text[pos:])
+
+	if _, err := io.WriteString(p.Output, out.String()); err != nil {
+		return &writeError{err}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSubst(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+		exitCode int
+	}{
+		{
+			"escapes each match",
+			[]string{"--subst", `"[^"]*"`},
+			"a \"x\" b\n\"y\"\n",
+			"a \\\"x\\\" b\n\\\"y\\\"\n",
+			0,
+		},
+		{
+			"template",
+			[]string{"--subst", `(?s)<pre>(.*?)</pre>`, "--subst-template", `{{index .Groups 0}}=>"{{.Escaped}}"`},
+			"<pre>a\tb</pre>, <pre>\n</pre>",
+			"a\tb=>\"<pre>a\\tb</pre>\", \n=>\"<pre>\\n</pre>\"",
+			0,
+		},
+		{
+			"unescape",
+			[]string{"-u", "--subst", `\\[nt]`},
+			`a\nb\tc\"`,
+			"a\nb\tc\\\"",
+			0,
+		},
+		{"no matches", []string{"--subst", "x+"}, "\"as is\"\n", "\"as is\"\n", 0},
+		{"invalid match", []string{"-u", "--subst", `\\.`}, `ok\n \q`, "", 1},
+		{"template error", []string{"--subst", "a", "--subst-template", "{{index .Groups 3}}"}, "a", "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append(tt.args, "--stdin")
+			exitCode := run(args, strings.NewReader(tt.input), &stdout, &stderr)
+			if exitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", exitCode, tt.exitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+// longOptions lists every long option parseArgs accepts, in the order of
+// the help text, for suggesting the one a mistyped option meant
+var longOptions = []string{
+	"help", "version", "unescape", "quote", "smart-quotes",
+	"output-separator", "raw", "print0", "record-separator",
+	"final-newline", "file", "label", "output", "tee", "append", "atomic",
+	"in-place", "confirm", "unbuffered", "lines", "null", "framing", "jobs",
+	"unordered", "stream", "flush-bytes", "ascii", "html-safe", "strict",
+	"replace", "strict-hex", "pedantic", "controls", "map-file",
+	"wrap-column", "wrap-style", "host", "emit-concat", "emit-bytes",
+	"heredoc", "with-original", "grep-escape", "predict-length",
+	"diff-output", "output-encoding", "shard-size", "output-pattern",
+	"rewrite-strings", "ndjson-in", "fields", "allow-comments",
+	"allow-trailing-commas", "sort-keys", "dup-keys", "between",
+	"between-regex", "subst", "subst-template", "max-expansion-ratio",
+	"skip-binary", "force-binary", "assume-text", "state-file", "resume",
+	"keep-going", "error-summary", "report", "per-file-stats", "timings",
+	"sniff", "trace", "stdin", "args-are-files", "literal-args",
+	"secret-prompt", "multiline-prompt", "stdio-server", "use-daemon",
+	"log-backend", "no-simd", "cache", "lang", "completion",
+}
+
+// suggestOption returns the known long option closest to name, if one is
+// close enough to be a likely typo
+func suggestOption(name string) (string, bool) {
+	best, bestDist := "", 3 // more than two edits away is not a typo
+	for _, opt := range longOptions {
+		if d := editDistance(name, opt); d < bestDist {
+			best, bestDist = opt, d
+		}
+	}
+	return best, best != "" && bestDist < len(name)
+}
+
+// editDistance is the Levenshtein distance between a and b, counting bytes
+// since option names are ASCII
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(min(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
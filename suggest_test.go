@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSuggestOption(t *testing.T) {
+	tests := []struct {
+		name, expected string
+		ok             bool
+	}{
+		{"asci", "ascii", true},
+		{"emit-byte", "emit-bytes", true},
+		{"unscape", "unescape", true},
+		{"html-saef", "html-safe", true},
+		{"zzz", "", false},
+		{"ab", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := suggestOption(tt.name)
+		if ok != tt.ok || ok && got != tt.expected {
+			t.Errorf("suggestOption(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.expected, tt.ok)
+		}
+	}
+
+	if _, err := parseArgs([]string{"--asci"}); err == nil || !strings.Contains(err.Error(), "did you mean --ascii?") {
+		t.Errorf("parseArgs(--asci) error = %v, want a suggestion", err)
+	}
+}
+
+func TestLongOptionsComplete(t *testing.T) {
+	for _, opt := range longOptions {
+		_, err := parseArgs([]string{"--" + opt})
+		if err != nil && strings.HasPrefix(err.Error(), "unknown option") {
+			t.Errorf("longOptions has --%s, which parseArgs does not accept", opt)
+		}
+		if !strings.Contains(bashCompletion, " --"+opt+" ") && !strings.Contains(bashCompletion, " --"+opt+`"`) {
+			t.Errorf("--%s is missing from the bash completion", opt)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		d    int
+	}{
+		{"", "", 0}, {"abc", "", 3}, {"kitten", "sitting", 3}, {"asci", "ascii", 1}, {"strcit", "strict", 2},
+	} {
+		if got := editDistance(tt.a, tt.b); got != tt.d {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.d)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+)
+
+// How many example messages --error-summary shows for each kind of error
+const summaryExamples = 3
+
+// fail handles an error from a record or an input source. Under --keep-going
+// it is reported (or collected for --error-summary) and processing carries
+// on; otherwise it is returned to stop the run.
+func (p *Processor) fail(err error) error {
+	// Once the output is broken there is nothing left to keep going for
+	var we *writeError
+	if err == nil || !p.Config.KeepGoing || errors.As(err, &we) {
+		return err
+	}
+	p.failed++
+	if p.errors != nil {
+		p.errors.add(err)
+	} else {
+		p.msgs.errorLine(p.Stderr, err)
+	}
+	return nil
+}
+
+// errorSummary groups errors by kind for --error-summary
+type errorSummary struct {
+	kinds map[string]*errorKind
+	order []string // kinds in order of first appearance
+}
+
+type errorKind struct {
+	count    int
+	examples []string
+}
+
+// locationError carries the record location separately from the message so
+// errors can be grouped without it
+type locationError struct {
+	location string
+	err      error
+}
+
+func (e *locationError) Error() string {
+	return e.location + ": " + e.err.Error()
+}
+
+func (e *locationError) Unwrap() error {
+	return e.err
+}
+
+// writeError is a failure to write the output. It ends the run even under
+// --keep-going, as every later record would fail the same way.
+type writeError struct {
+	err error
+}
+
+func (e *writeError) Error() string {
+	return "writing output: " + e.err.Error()
+}
+
+func (e *writeError) Unwrap() error {
+	return e.err
+}
+
+// Details that vary between otherwise identical errors: numbers, quoted
+// values and the character after a backslash
+var errorDetails = regexp.MustCompile(`[0-9]+|'[^']*'|"[^"]*"|\\u[0-9A-Fa-f]{0,4}|\\.`)
+
+func (s *errorSummary) add(err error) {
+	msg := err.Error()
+	var loc *locationError
+	if errors.As(err, &loc) {
+		msg = loc.err.Error()
+	}
+	k := s.kind(errorDetails.ReplaceAllString(msg, "…"))
+	k.count++
+	if len(k.examples) < summaryExamples {
+		k.examples = append(k.examples, err.Error())
+	}
+}
+
+// kind returns the entry for a kind of error, adding it if it is new
+func (s *errorSummary) kind(name string) *errorKind {
+	if s.kinds == nil {
+		s.kinds = make(map[string]*errorKind)
+	}
+	k, ok := s.kinds[name]
+	if !ok {
+		k = &errorKind{}
+		s.kinds[name] = k
+		s.order = append(s.order, name)
+	}
+	return k
+}
+
+// merge adds the errors collected in o to s
+func (s *errorSummary) merge(o *errorSummary) {
+	for _, name := range o.order {
+		k, other := s.kind(name), o.kinds[name]
+		k.count += other.count
+		for _, example := range other.examples {
+			if len(k.examples) < summaryExamples {
+				k.examples = append(k.examples, example)
+			}
+		}
+	}
+}
+
+// write prints the kinds of error from most to least frequent, each with its
+// count and the first few occurrences
+func (s *errorSummary) write(w io.Writer, total int) {
+	order := append([]string(nil), s.order...)
+	sort.SliceStable(order, func(i, j int) bool {
+		return s.kinds[order[i]].count > s.kinds[order[j]].count
+	})
+
+	fmt.Fprintf(w, "Error summary: %d failed, %d kind(s) of error\n", total, len(order))
+	for _, kind := range order {
+		k := s.kinds[kind]
+		fmt.Fprintf(w, "%8d  %s\n", k.count, kind)
+		for _, example := range k.examples {
+			fmt.Fprintf(w, "          e.g. %s\n", example)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestKeepGoing(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"-u", "-l", "--keep-going"}, strings.NewReader("a\\x\nb\nc\\q\n"), &stdout, &stderr)
+	if exitCode != 1 {
+		t.Errorf("exit code = %d, want 1", exitCode)
+	}
+	if stdout.String() != "b\n" {
+		t.Errorf("stdout = %q, want the good record", stdout.String())
+	}
+	if strings.Count(stderr.String(), "Error: ") != 2 {
+		t.Errorf("stderr = %q, want two errors", stderr.String())
+	}
+}
+
+func TestErrorSummary(t *testing.T) {
+	input := strings.Repeat("bad\\x\n", 5) + "ok\n" + "bad\\u12\n" + "bad\\q\n"
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"-u", "-l", "--keep-going", "--error-summary"}, strings.NewReader(input), &stdout, &stderr)
+	if exitCode != 1 {
+		t.Errorf("exit code = %d, want 1", exitCode)
+	}
+
+	expected := `Error summary: 7 failed, 2 kind(s) of error
+       6  unescaping: invalid escape sequence …
+          e.g. -:1: unescaping: invalid escape sequence \x
+          e.g. -:2: unescaping: invalid escape sequence \x
+          e.g. -:3: unescaping: invalid escape sequence \x
+       1  unescaping: incomplete unicode escape sequence
+          e.g. -:7: unescaping: incomplete unicode escape sequence
+`
+	if stderr.String() != expected {
+		t.Errorf("stderr = %q, want %q", stderr.String(), expected)
+	}
+}
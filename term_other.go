@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func disableEcho(f *os.File) (func(), error) {
+	return nil, errors.New("not supported on this platform")
+}
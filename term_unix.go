@@ -0,0 +1,34 @@
+//go:build linux || darwin || freebsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// disableEcho turns off echo on the terminal f and returns a function that
+// puts the previous settings back
+func disableEcho(f *os.File) (func(), error) {
+	fd := f.Fd()
+	var old syscall.Termios
+	if err := termiosIoctl(fd, ioctlGetTermios, &old); err != nil {
+		return nil, err
+	}
+
+	noEcho := old
+	noEcho.Lflag &^= syscall.ECHO
+	noEcho.Lflag |= syscall.ICANON | syscall.ISIG
+	if err := termiosIoctl(fd, ioctlSetTermios, &noEcho); err != nil {
+		return nil, err
+	}
+	return func() { termiosIoctl(fd, ioctlSetTermios, &old) }, nil
+}
+
+func termiosIoctl(fd, req uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// phaseTimer adds up the time a run spends reading input and writing
+// output, for --timings. The rest of the run is put down to transforming.
+type phaseTimer struct {
+	start time.Time
+	read  time.Duration
+	write time.Duration
+}
+
+// timedReader adds the time spent in each Read to d
+type timedReader struct {
+	r io.Reader
+	d *time.Duration
+}
+
+func (t timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.r.Read(p)
+	*t.d += time.Since(start)
+	return n, err
+}
+
+// timedWriter adds the time spent in each Write to d
+type timedWriter struct {
+	w io.Writer
+	d *time.Duration
+}
+
+func (t timedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.w.Write(p)
+	*t.d += time.Since(start)
+	return n, err
+}
+
+// timedInput returns r, timed as reading if --timings is on
+func (p *Processor) timedInput(r io.Reader) io.Reader {
+	if p.timing == nil {
+		return r
+	}
+	return timedReader{r, &p.timing.read}
+}
+
+// writeTimings prints the --timings table: each phase's time and share of
+// the run
+func (p *Processor) writeTimings(w io.Writer) error {
+	t := p.timing
+	total := time.Since(t.start)
+	phases := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"read", t.read},
+		{"transform", max(total-t.read-t.write, 0)},
+		{"write", t.write},
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tTIME\tSHARE\t")
+	for _, ph := range phases {
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(ph.d) / float64(total)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.0f%%\t\n", ph.name, ph.d.Round(time.Microsecond), share)
+	}
+	fmt.Fprintf(tw, "total\t%s\t\t\n", total.Round(time.Microsecond))
+	return tw.Flush()
+}
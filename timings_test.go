@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTimings(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"-l", "--stdin", "--timings"}, strings.NewReader("a\nb\n"), &stdout, &stderr)
+	if exitCode != 0 || stdout.String() != "a\nb\n" {
+		t.Fatalf("exit code = %d, stdout = %q, want 0 and the records", exitCode, stdout.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("stderr = %q, want a header and four rows", stderr.String())
+	}
+	for i, phase := range []string{"PHASE", "read", "transform", "write", "total"} {
+		if !strings.HasPrefix(lines[i], phase+" ") {
+			t.Errorf("line %d = %q, want the %s row", i, lines[i], phase)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Actions recorded in the --trace log
+const (
+	traceEscaped   = "escaped"
+	traceUnescaped = "unescaped"
+	traceRewritten = "rewritten" // a document under --rewrite-strings
+	traceSearched  = "searched"  // a record checked by --grep-escape
+	traceSkipped   = "skipped"   // written by an interrupted run already
+	traceFailed    = "failed"
+)
+
+// traceEntry is one line of the --trace log
+type traceEntry struct {
+	Index   int    `json:"index"`
+	Source  string `json:"source"`
+	Line    int    `json:"line,omitempty"`
+	Offset  int64  `json:"offset"`
+	Action  string `json:"action"`
+	Changed bool   `json:"changed"`
+	Micros  int64  `json:"duration_us"`
+	Error   string `json:"error,omitempty"`
+}
+
+// tracer writes the --trace log, one JSON object per record
+type tracer struct {
+	f   *os.File
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func openTrace(path string) (*tracer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create trace file: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	return &tracer{f: f, w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// Close flushes and closes the log; it is safe to call more than once
+func (t *tracer) Close() error {
+	if t.f == nil {
+		return nil
+	}
+	err := t.w.Flush()
+	if closeErr := t.f.Close(); err == nil {
+		err = closeErr
+	}
+	t.f = nil
+	return err
+}
+
+// traceRecord logs what happened to a record that started processing at
+// start
+func (p *Processor) traceRecord(rec Record, action string, start time.Time, err error) {
+	if p.tracer == nil {
+		return
+	}
+	entry := traceEntry{
+		Index:   rec.Index,
+		Source:  rec.Source,
+		Line:    rec.Line,
+		Offset:  rec.Offset,
+		Action:  action,
+		Changed: rec.Changed,
+		Micros:  time.Since(start).Microseconds(),
+	}
+	if err != nil {
+		entry.Action = traceFailed
+		entry.Changed = false
+		entry.Error = err.Error()
+	}
+	p.tracer.enc.Encode(&entry)
+}
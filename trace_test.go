@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.ndjson")
+
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader("ok\nbad\\x\nsay \\\"hi\\\"\n")
+	run([]string{"-u", "-l", "--keep-going", "--trace", path}, stdin, &stdout, &stderr)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []traceEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry traceEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid trace line %q: %v", scanner.Text(), err)
+		}
+		entry.Micros = 0
+		got = append(got, entry)
+	}
+
+	expected := []traceEntry{
+		{Index: 0, Source: "-", Line: 1, Offset: 0, Action: traceUnescaped},
+		{Index: 1, Source: "-", Line: 2, Offset: 3, Action: traceFailed, Error: "unescaping: invalid escape sequence \\x"},
+		{Index: 2, Source: "-", Line: 3, Offset: 9, Action: traceUnescaped, Changed: true},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("got %d trace entries, want %d: %+v", len(got), len(expected), got)
+	}
+	for i, want := range expected {
+		if got[i] != want {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want)
+		}
+	}
+}
+
+func TestTraceDocuments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.ndjson")
+
+	var stdout, stderr bytes.Buffer
+	run([]string{"--rewrite-strings", "--ascii", "--trace", path}, strings.NewReader(`{"a":"x"} {"b":"é"}`), &stdout, &stderr)
+
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"action":"rewritten","changed":false`) || !strings.Contains(lines[1], `"changed":true`) {
+		t.Errorf("trace = %q", data)
+	}
+}